@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apex/log"
+	"github.com/spf13/cobra"
+
+	"github.com/kubectyl/kuber/internal/hibernate"
+	"github.com/kubectyl/kuber/loggers/cli"
+)
+
+var hibernateArgs struct {
+	Ports    []string
+	Protocol string
+	Message  string
+}
+
+// newHibernateCommand returns the command run by the pod that takes the place of
+// a hibernating server. It answers on the ports of the server and reports the
+// first connection on stdout, which is followed by Kuber to start the server.
+func newHibernateCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:    "hibernate",
+		Short:  "Answer on the ports of a hibernating server until a client connects.",
+		Hidden: true,
+		Run:    hibernateCmdRun,
+	}
+
+	command.Flags().StringArrayVar(&hibernateArgs.Ports, "port", nil, "a port to listen on, such as tcp:25565 or udp:25565")
+	command.Flags().StringVar(&hibernateArgs.Protocol, "protocol", "", "the protocol spoken with clients connecting over tcp")
+	command.Flags().StringVar(&hibernateArgs.Message, "message", "Server is starting, please try again in a moment.", "the message shown to clients")
+
+	return command
+}
+
+func hibernateCmdRun(cmd *cobra.Command, _ []string) {
+	log.SetHandler(cli.Default)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l := hibernate.Listener{
+		Ports:    hibernateArgs.Ports,
+		Protocol: hibernateArgs.Protocol,
+		Message:  hibernateArgs.Message,
+		OnWake: func() {
+			fmt.Println(hibernate.WakeMessage)
+		},
+	}
+	if err := l.Listen(ctx); err != nil {
+		log.WithField("error", err).Fatal("failed to listen on server ports")
+	}
+}
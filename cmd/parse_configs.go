@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/parser"
+)
+
+var parseConfigsArgs struct {
+	File string
+	Root string
+}
+
+// newParseConfigsCommand returns the command used by the init container of a
+// server pod to update the egg configuration files on the volume of the server.
+// Any problems are written to stdout, one per line, so that they can be shown in
+// the console of the server. The command never fails since a configuration file
+// that cannot be parsed should not prevent the server from starting.
+func newParseConfigsCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:    "parse-configs",
+		Short:  "Update the configuration files of a server from within its pod.",
+		Hidden: true,
+		Run:    parseConfigsCmdRun,
+	}
+
+	command.Flags().StringVar(&parseConfigsArgs.File, "file", "/etc/kuber/configs.json", "the file containing the rendered configuration files")
+	command.Flags().StringVar(&parseConfigsArgs.Root, "root", "/home/container", "the directory the configuration files are relative to")
+
+	return command
+}
+
+func parseConfigsCmdRun(*cobra.Command, []string) {
+	log.SetHandler(discard.Default)
+
+	// The parser reads values from the configuration of the daemon, which is not available
+	// inside the pod. Any such values were already rendered before the files were handed
+	// over, so the defaults are enough here.
+	c, err := config.NewAtPath("")
+	if err != nil {
+		fmt.Printf("Failed to prepare configuration parser: %s\n", err)
+		return
+	}
+	// The token is never used here, but a configuration cannot be set without one.
+	c.AuthenticationToken = "parse-configs"
+	config.Set(c)
+
+	b, err := os.ReadFile(parseConfigsArgs.File)
+	if err != nil {
+		fmt.Printf("Failed to read configuration files: %s\n", err)
+		return
+	}
+	var files []parser.ConfigurationFile
+	if err := json.Unmarshal(b, &files); err != nil {
+		fmt.Printf("Failed to read configuration files: %s\n", err)
+		return
+	}
+
+	for _, f := range files {
+		p := filepath.Join(parseConfigsArgs.Root, filepath.Clean("/"+f.FileName))
+		if err := f.Parse(p, false); err != nil {
+			fmt.Printf("Failed to update configuration file %s: %s\n", f.FileName, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/spf13/cobra"
+
+	"github.com/kubectyl/kuber/loggers/cli"
+)
+
+var prepullArgs struct {
+	Install string
+}
+
+// newPrePullCommand returns the command run by the containers of the pre-pull
+// DaemonSet. The kuber binary is first copied into a volume shared with those
+// containers, which then run it to keep their image in use on the node.
+func newPrePullCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:    "prepull",
+		Short:  "Keep the image of the container in use until terminated.",
+		Hidden: true,
+		Run:    prepullCmdRun,
+	}
+
+	command.Flags().StringVar(&prepullArgs.Install, "install", "", "copy the kuber binary to the given path and exit")
+
+	return command
+}
+
+func prepullCmdRun(cmd *cobra.Command, _ []string) {
+	log.SetHandler(cli.Default)
+
+	if prepullArgs.Install != "" {
+		if err := installBinary(prepullArgs.Install); err != nil {
+			log.WithField("error", err).Fatal("failed to copy kuber binary")
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+}
+
+// installBinary copies the running executable to the given path.
+func installBinary(dst string) error {
+	src, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(out.Close())
+}
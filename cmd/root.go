@@ -27,12 +27,17 @@ import (
 
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/environment/kubernetes"
 	"github.com/kubectyl/kuber/internal/cron"
 	"github.com/kubectyl/kuber/internal/database"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/internal/prepull"
+	"github.com/kubectyl/kuber/internal/reconciler"
 	"github.com/kubectyl/kuber/loggers/cli"
 	"github.com/kubectyl/kuber/remote"
 	"github.com/kubectyl/kuber/router"
 	"github.com/kubectyl/kuber/server"
+	"github.com/kubectyl/kuber/sftp"
 	"github.com/kubectyl/kuber/system"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -88,6 +93,10 @@ func init() {
 	rootCommand.AddCommand(versionCommand)
 	rootCommand.AddCommand(configureCmd)
 	rootCommand.AddCommand(newDiagnosticsCommand())
+	rootCommand.AddCommand(newParseConfigsCommand())
+	rootCommand.AddCommand(newHibernateCommand())
+	rootCommand.AddCommand(newPrePullCommand())
+	rootCommand.AddCommand(newSuperviseCommand())
 }
 
 func rootCmdRun(cmd *cobra.Command, _ []string) {
@@ -134,6 +143,23 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		log.WithField("error", err).Fatal("failed to initialize database")
 	}
 
+	if config.Get().Cluster.HighAvailability.Enabled {
+		if err := ha.Initialize(); err != nil {
+			log.WithField("error", err).Fatal("failed to initialize high availability mode")
+		}
+		log.WithField("identity", ha.Identity()).Info("running in high availability mode")
+	}
+
+	if op := config.Get().Cluster.Operator; op.Enabled && op.InstallDefinition {
+		if err := kubernetes.EnsureGameServerDefinition(cmd.Context()); err != nil {
+			log.WithField("error", err).Fatal("failed to install gameserver resource definition")
+		}
+	}
+
+	if err := kubernetes.EnsurePriorityClasses(cmd.Context()); err != nil {
+		log.WithField("error", err).Fatal("failed to create priority classes")
+	}
+
 	manager, err := server.NewManager(cmd.Context(), pclient)
 	if err != nil {
 		log.WithField("error", err).Fatal("failed to load server configurations")
@@ -238,6 +264,7 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 				// make a call to set that state just to ensure we don't ever accidentally end up with some invalid
 				// state being tracked.
 				s.Environment.SetState(environment.ProcessOfflineState)
+				s.ResumeHibernation(ctx)
 			}
 
 			if state := s.Environment.State(); state == environment.ProcessStartingState || state == environment.ProcessRunningState {
@@ -259,6 +286,27 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		}
 	}()
 
+	if err := reconciler.Initialize(manager); err != nil {
+		log.WithField("error", err).Fatal("failed to initialize cluster reconciler")
+	}
+	if config.Get().Cluster.Reconciliation.Enabled {
+		go reconciler.Instance().Watch(cmd.Context())
+	}
+	if err := prepull.Initialize(manager); err != nil {
+		log.WithField("error", err).Fatal("failed to initialize image pre-puller")
+	}
+	if config.Get().Cluster.Images.PrePull.Enabled && !ha.Enabled() {
+		go prePullImages(cmd.Context())
+	}
+	if ha.Enabled() {
+		go ha.Run(cmd.Context(), func(ctx context.Context) {
+			reconciler.Instance().Trigger()
+			if config.Get().Cluster.Images.PrePull.Enabled {
+				prePullImages(ctx)
+			}
+		})
+	}
+
 	if s, err := cron.Scheduler(cmd.Context(), manager); err != nil {
 		log.WithField("error", err).Fatal("failed to initialize cron system")
 	} else {
@@ -266,6 +314,16 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		s.StartAsync()
 	}
 
+	if config.Get().System.Sftp.Enabled {
+		go func() {
+			// Run the SFTP server.
+			if err := sftp.New(manager).Run(); err != nil {
+				log.WithError(err).Fatal("failed to initialize the sftp server")
+				return
+			}
+		}()
+	}
+
 	go func() {
 		log.Info("updating server states on Panel: marking installing/restoring servers as normal")
 		// Update all the servers on the Panel to be in a valid state if they're
@@ -421,3 +479,11 @@ for this issue, it will be closed.[reset]
 `))
 	os.Exit(1)
 }
+
+// prePullImages updates the images pre-pulled onto the nodes of the cluster,
+// this is also done periodically by the cron system.
+func prePullImages(ctx context.Context) {
+	if err := prepull.Instance().Run(ctx); err != nil && !errors.Is(err, prepull.ErrPrePullRunning) {
+		log.WithField("error", err).Error("failed to pre-pull server images")
+	}
+}
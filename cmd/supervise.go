@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apex/log"
+	"github.com/spf13/cobra"
+
+	"github.com/kubectyl/kuber/internal/supervisor"
+	"github.com/kubectyl/kuber/loggers/cli"
+)
+
+var superviseArgs struct {
+	Install string
+	Socket  string
+	Dir     string
+	Configs string
+	Control string
+}
+
+// newSuperviseCommand returns the command used as the entrypoint of server pods
+// that are able to restart in place. The same command is executed within the
+// pod by Kuber to control the startup command of the server.
+func newSuperviseCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:    "supervise [flags] -- entrypoint [args...]",
+		Short:  "Run the entrypoint of a server and keep the container running once it exits.",
+		Hidden: true,
+		Run:    superviseCmdRun,
+	}
+
+	command.Flags().StringVar(&superviseArgs.Install, "install", "", "copy the kuber binary to the given path and exit")
+	command.Flags().StringVar(&superviseArgs.Socket, "socket", "/kuber/supervisor.sock", "the path of the control socket")
+	command.Flags().StringVar(&superviseArgs.Dir, "dir", "/home/container", "the working directory of the startup command")
+	command.Flags().StringVar(&superviseArgs.Configs, "configs", "", "the file holding the configuration files updated before every restart")
+	command.Flags().StringVar(&superviseArgs.Control, "control", "", "send the command to the running supervisor and print its reply")
+
+	return command
+}
+
+func superviseCmdRun(cmd *cobra.Command, args []string) {
+	log.SetHandler(cli.Default)
+
+	if superviseArgs.Install != "" {
+		if err := installBinary(superviseArgs.Install); err != nil {
+			log.WithField("error", err).Fatal("failed to copy kuber binary")
+		}
+		return
+	}
+
+	if superviseArgs.Control != "" {
+		reply, err := supervisor.Control(superviseArgs.Socket, superviseArgs.Control)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(reply)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := supervisor.Supervisor{
+		Args:    args,
+		Dir:     superviseArgs.Dir,
+		Socket:  superviseArgs.Socket,
+		Configs: superviseArgs.Configs,
+	}
+	if err := s.Run(ctx); err != nil {
+		log.WithField("error", err).Fatal("failed to run startup command")
+	}
+}
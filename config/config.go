@@ -194,11 +194,26 @@ type SystemConfiguration struct {
 
 	CrashDetection CrashDetection `yaml:"crash_detection"`
 
+	Sftp SftpConfiguration `yaml:"sftp"`
+
 	Backups Backups `yaml:"backups"`
 
 	Transfers Transfers `yaml:"transfers"`
 }
 
+// SftpConfiguration defines the configuration of the internal SFTP server.
+type SftpConfiguration struct {
+	// Enabled controls whether the SFTP server is started.
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+	// Address is the bind address of the SFTP server.
+	Address string `default:"0.0.0.0" json:"bind_address" yaml:"bind_address"`
+	// Port is the bind port of the SFTP server.
+	Port int `default:"2022" json:"bind_port" yaml:"bind_port"`
+	// ReadOnly controls if the SFTP server only allows reading files, regardless of the
+	// permissions a user has been granted.
+	ReadOnly bool `default:"false" json:"read_only" yaml:"read_only"`
+}
+
 type CrashDetection struct {
 	// CrashDetectionEnabled sets if crash detection is enabled globally for all servers on this node.
 	CrashDetectionEnabled bool `default:"true" yaml:"enabled"`
@@ -493,6 +508,9 @@ func FromFile(path string) error {
 	if err := yaml.Unmarshal(b, c); err != nil {
 		return err
 	}
+	if err := c.Cluster.Storage.Validate(); err != nil {
+		return err
+	}
 
 	// Store this configuration in the global state.
 	Set(c)
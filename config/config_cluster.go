@@ -1,6 +1,15 @@
 package config
 
-import "sort"
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/kubectyl/kuber/system"
+)
 
 type ClusterConfiguration struct {
 	Namespace string `default:"default" yaml:"namespace"`
@@ -13,10 +22,18 @@ type ClusterConfiguration struct {
 
 	StorageClass string `default:"manual" yaml:"storage_class"`
 
+	// Storage defines the storage tiers the volumes of servers are created with, servers not
+	// using one of them get a volume from the storage class above.
+	Storage ClusterStorage `json:"storage" yaml:"storage"`
+
 	Insecure bool `yaml:"insecure" default:"false"`
 
 	Network ClusterNetworkConfiguration `json:"network" yaml:"network"`
 
+	// ExternalDNS publishes a DNS record for every server through ExternalDNS running in the
+	// cluster, so that players are able to connect using a hostname.
+	ExternalDNS ClusterExternalDNS `json:"external_dns" yaml:"external_dns"`
+
 	// InstallerLimits defines the limits on the installer containers that prevents a server's
 	// installation process from unintentionally consuming more resources than expected. This
 	// is used in conjunction with the server's defined limits. Whichever value is higher will
@@ -30,6 +47,81 @@ type ClusterConfiguration struct {
 	// software such as the JVM not staying below the maximum memory limit.
 	Overhead Overhead `json:"overhead" yaml:"overhead"`
 
+	// Overcommit controls how much of the resources assigned to a server are reserved for it
+	// by the scheduler, allowing more servers on a node than the sum of their limits.
+	Overcommit Overcommit `json:"overcommit" yaml:"overcommit"`
+
+	// Limits describes the capabilities of the nodes in the cluster that are used to apply
+	// the limits of a server that have no direct equivalent in Kubernetes.
+	Limits ClusterLimits `json:"limits" yaml:"limits"`
+
+	// Tmp defines the volume mounted at /tmp for servers that do not override it.
+	Tmp TmpVolume `json:"tmp" yaml:"tmp"`
+
+	// EphemeralStorage is the amount of disk space in megabytes a server may use on the node
+	// outside of its persistent volume, such as the writable layer of the container and its
+	// logs. A server exceeding it is evicted from the node. Set to 0 for no limit.
+	EphemeralStorage int64 `default:"1024" json:"ephemeral_storage" yaml:"ephemeral_storage"`
+
+	// Priorities assigns priority classes to the pods of servers depending on their plan, so
+	// that servers on lower plans are preempted first when a node runs short on resources.
+	Priorities ClusterPriorities `json:"priorities" yaml:"priorities"`
+
+	// Hibernation stops servers that have been idle for a while, answering on their ports
+	// until the first client connects and the server is started again.
+	Hibernation ClusterHibernation `json:"hibernation" yaml:"hibernation"`
+
+	// Images controls how the images of servers are pulled onto the nodes of the cluster.
+	Images ClusterImages `json:"images" yaml:"images"`
+
+	// FastRestart allows servers to be restarted within their existing pod when the pod
+	// has not changed, rather than always recreating it.
+	FastRestart ClusterFastRestart `json:"fast_restart" yaml:"fast_restart"`
+
+	// Workload is the kind of object managing the pod of every server, either "pod" for
+	// pods created and removed by Kuber itself, or "statefulset" for a StatefulSet with a
+	// single replica that Kubernetes reschedules onto a healthy node when its node fails.
+	// The StatefulSet is scaled between zero and one replica as the server is started and
+	// stopped, and the server process always runs through the supervisor of fast restarts.
+	// Pods on a node that stopped responding are forcefully removed by the reconciler so
+	// that they are replaced, see NodeFailureTimeout. Servers should be stopped before
+	// changing this value.
+	Workload string `default:"pod" json:"workload" yaml:"workload"`
+
+	// NodeFailureTimeout is the amount of time in seconds the node running the pod of a
+	// StatefulSet must have been not ready before the pod is forcefully removed, allowing
+	// the StatefulSet to create it on another node. Pods on a node tainted as out of service
+	// are removed right away. The volume of the server must not be writable from the failed
+	// node anymore once it is removed, so this should be longer than it takes the cluster to
+	// fence a node. Set to 0 to only remove pods of nodes tainted as out of service.
+	NodeFailureTimeout int `default:"300" json:"node_failure_timeout" yaml:"node_failure_timeout"`
+
+	// Reconciliation controls the background process that compares the objects in the
+	// cluster against the servers known to this node and repairs any differences.
+	Reconciliation Reconciliation `json:"reconciliation" yaml:"reconciliation"`
+
+	// Operator controls if servers are represented in the cluster by a GameServer custom
+	// resource which owns the objects created for that server, except for its volume.
+	Operator Operator `json:"operator" yaml:"operator"`
+
+	// HighAvailability allows multiple replicas of Kuber to serve the same node, coordinating
+	// through objects stored in the cluster.
+	HighAvailability HighAvailability `json:"high_availability" yaml:"high_availability"`
+
+	// Files controls where file management operations for servers are performed.
+	Files ClusterFiles `json:"files" yaml:"files"`
+
+	// Transfers controls how servers are moved to other nodes managing the same cluster.
+	Transfers ClusterTransfers `json:"transfers" yaml:"transfers"`
+
+	// Sidecars are containers that run next to the server process of the servers that
+	// enable them, sharing the network of the server process.
+	Sidecars []Sidecar `json:"sidecars" yaml:"sidecars"`
+
+	// ConfigurationFiles controls how the configuration files defined by the egg of a
+	// server are updated before the server process starts.
+	ConfigurationFiles ClusterConfigurationFiles `json:"configuration_files" yaml:"configuration_files"`
+
 	// CertData string `yaml:"certdata"`
 
 	// KeyData string `yaml:"keydata"`
@@ -39,6 +131,235 @@ type ClusterConfiguration struct {
 
 type ClusterNetworkConfiguration struct {
 	Dns []string `default:"[\"1.1.1.1\", \"1.0.0.1\"]"`
+
+	// DnsPolicy controls how servers resolve names, either "none" to only use the nameservers
+	// above, "clusterfirst" to resolve the services of the cluster before falling back to the
+	// resolver of the node, or "default" to only use the resolver of the node.
+	DnsPolicy string `default:"none" json:"dns_policy" yaml:"dns_policy"`
+
+	// DnsSearches are the search domains used to resolve names that are not fully qualified.
+	DnsSearches []string `json:"dns_searches" yaml:"dns_searches"`
+
+	// HostNetwork allows servers that opt in to run in the network namespace of the node they
+	// are scheduled on, binding their ports on the node directly. Nodes where another server
+	// already uses one of the ports are avoided.
+	HostNetwork bool `default:"false" json:"host_network" yaml:"host_network"`
+
+	// IPFamilyPolicy is the IP family policy of the services of servers, either "singlestack",
+	// "preferdualstack" or "requiredualstack". The default of the cluster is used if left empty.
+	IPFamilyPolicy string `json:"ip_family_policy" yaml:"ip_family_policy"`
+
+	// IPFamilies are the IP families of the services of servers in order of preference, either
+	// "ipv4" or "ipv6". The default of the cluster is used if left empty.
+	IPFamilies []string `json:"ip_families" yaml:"ip_families"`
+
+	// GroupLabel is the server label holding the network group of a server. Servers in the same
+	// group are able to reach the ports of internal servers in the group, other pods are not.
+	// Groups are separate for every user, servers of different owners never share a group.
+	GroupLabel string `default:"group" json:"group_label" yaml:"group_label"`
+
+	// ClusterDomain is the domain of the cluster, which the internal hostnames of servers are
+	// created under. Servers only resolve these with the "clusterfirst" DNS policy.
+	ClusterDomain string `default:"cluster.local" json:"cluster_domain" yaml:"cluster_domain"`
+}
+
+// ClusterExternalDNS defines the DNS records published for servers. The services of servers
+// are annotated with their hostname, which ExternalDNS publishes as an A or AAAA record for
+// the load balancer or the nodes of the service. SRV records are published through DNSEndpoint
+// resources, which requires the crd source of ExternalDNS to be enabled.
+type ClusterExternalDNS struct {
+	// Enabled controls whether DNS records are published for servers.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// Domain is the base domain the hostnames of servers are created under, such as
+	// "play.example.com".
+	Domain string `json:"domain" yaml:"domain"`
+
+	// Label is the server label holding the name of a server below the base domain. Servers
+	// without the label are named after the first segment of their UUID. A server is not
+	// started while its name is already used by another server in the namespace.
+	Label string `default:"subdomain" json:"label" yaml:"label"`
+
+	// TTL is the time to live of the records in seconds.
+	TTL int `default:"300" json:"ttl" yaml:"ttl"`
+
+	// Srv is the service and protocol of the SRV record pointing at the default port of the
+	// server, such as "_minecraft._tcp". No SRV record is published if left empty.
+	Srv string `json:"srv" yaml:"srv"`
+}
+
+// IPFamilyConfiguration defines the IP families the service of a server is reachable over,
+// see ClusterNetworkConfiguration for the accepted values.
+type IPFamilyConfiguration struct {
+	Policy   string   `json:"policy" yaml:"policy"`
+	Families []string `json:"families" yaml:"families"`
+}
+
+// DnsConfiguration defines how a server resolves names, see ClusterNetworkConfiguration for
+// the accepted policies.
+type DnsConfiguration struct {
+	Policy      string   `json:"policy" yaml:"policy"`
+	Nameservers []string `json:"nameservers" yaml:"nameservers"`
+	Searches    []string `json:"searches" yaml:"searches"`
+}
+
+// Reconciliation defines the behavior of the cluster reconciliation process. Only objects
+// labelled with the UUID of this node are ever considered, so multiple nodes can safely
+// share the same namespace.
+type Reconciliation struct {
+	// Enabled controls whether the reconciliation process runs on this node.
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// Interval is the amount of time in seconds between periodic reconciliation runs. A run
+	// is also triggered whenever a server pod is removed from the cluster.
+	Interval int `default:"60" json:"interval" yaml:"interval"`
+
+	// GracePeriod is the amount of time in seconds an object belonging to an unknown server
+	// must remain orphaned before it is deleted from the cluster. Persistent volume claims are
+	// never deleted, they are only labelled as orphaned once this period has passed.
+	GracePeriod int `default:"600" json:"grace_period" yaml:"grace_period"`
+}
+
+// Operator defines the behavior of operator mode. When enabled each server is stored as a
+// namespaced GameServer resource, and the pods, services and volumes created for it are
+// owned by that resource so that deleting it cascades to everything belonging to the server.
+type Operator struct {
+	// Enabled controls whether servers are managed through GameServer resources.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// InstallDefinition controls if the GameServer CustomResourceDefinition is created when
+	// Kuber boots. Disable this if the definition is managed outside of Kuber and the
+	// configured credentials are not allowed to create cluster scoped resources.
+	InstallDefinition bool `default:"true" json:"install_definition" yaml:"install_definition"`
+}
+
+// HighAvailability defines how multiple replicas of Kuber coordinate with each other. When
+// enabled a Lease is used to elect the replica that runs reconciliation, power actions are
+// guarded by a Lease per server, and server states are stored in a ConfigMap so that every
+// replica is able to serve API and websocket requests.
+type HighAvailability struct {
+	// Enabled controls whether this instance runs in high availability mode.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// Identity is the unique name of this replica. If left empty the POD_NAME environment
+	// variable is used, falling back to the hostname of the machine.
+	Identity string `json:"identity" yaml:"identity"`
+
+	// LeaseDuration is the amount of time in seconds that non-leader replicas wait before
+	// attempting to take over leadership.
+	LeaseDuration int `default:"15" json:"lease_duration" yaml:"lease_duration"`
+
+	// RenewDeadline is the amount of time in seconds the leader keeps retrying to refresh
+	// its leadership before giving it up.
+	RenewDeadline int `default:"10" json:"renew_deadline" yaml:"renew_deadline"`
+
+	// RetryPeriod is the amount of time in seconds between leader election attempts.
+	RetryPeriod int `default:"2" json:"retry_period" yaml:"retry_period"`
+}
+
+// ClusterFiles defines how the files of a server are accessed. Servers store their data
+// on a persistent volume in the cluster, which is not visible to Kuber itself, so by default
+// a small helper pod with the volume mounted is used to perform all file operations.
+type ClusterFiles struct {
+	// Backend is either "volume" to manage files on the persistent volume of the server
+	// through a helper pod, or "local" to manage them in the data directory on this machine.
+	Backend string `default:"volume" json:"backend" yaml:"backend"`
+
+	// Image is the image used for the helper pod. It must provide a shell along with the
+	// common coreutils, find, tar and base64 commands.
+	Image string `default:"busybox:1.36" json:"image" yaml:"image"`
+
+	// IdleTimeout is the amount of time in seconds the helper pod is kept after the last
+	// file operation before it is removed, which releases the volume of the server. Set
+	// this to 0 to keep the pod until the server is deleted.
+	IdleTimeout int `default:"300" json:"idle_timeout" yaml:"idle_timeout"`
+}
+
+// ClusterTransfers defines how the data of a server is moved during a transfer. When the
+// source and target node use the same cluster and storage class the persistent volume can be
+// handed over directly, otherwise the files are streamed to the target node as an archive.
+type ClusterTransfers struct {
+	// Volume is either "rebind" to move the existing persistent volume over to the claim of
+	// the target node, "clone" to have the CSI driver copy the volume into the namespace of
+	// the target node, or "disabled" to always stream an archive. Cloning into a different
+	// namespace requires the CrossNamespaceVolumeDataSource feature gate in the cluster.
+	Volume string `default:"rebind" json:"volume" yaml:"volume"`
+}
+
+// ClusterConfigurationFiles defines how egg configuration files are updated for servers
+// whose files are stored on a persistent volume. Rather than reading and writing every file
+// through the helper pod, an init container in the pod of the server parses the files in
+// place right before the server process is started.
+type ClusterConfigurationFiles struct {
+	// InitContainer controls whether the files are parsed by an init container. When
+	// disabled, which is the default, the files are updated through the helper pod instead.
+	InitContainer bool `default:"false" json:"init_container" yaml:"init_container"`
+
+	// Image is the image used for the init container, it must provide the kuber binary at
+	// /usr/bin/kuber. Defaults to the image of the running version of Kuber.
+	Image string `json:"image" yaml:"image"`
+}
+
+// KuberImage returns the given image, or the image of the running version of Kuber
+// if it is empty. Containers running the kuber binary default to it, since the
+// binary must understand the arguments passed by this version.
+func KuberImage(image string) string {
+	if image != "" {
+		return image
+	}
+	return "ghcr.io/kubectyl/kuber:" + system.Version
+}
+
+// Sidecar defines a container that is added to the pod of a server, such as a metrics
+// exporter or a log shipper. A sidecar is enabled for servers using one of the listed eggs,
+// or for servers that have all the listed labels.
+type Sidecar struct {
+	// Name is the name of the container, it must be unique within the pod and cannot be
+	// "process" since that is the name of the server process container.
+	Name string `json:"name" yaml:"name"`
+
+	Image   string            `json:"image" yaml:"image"`
+	Command []string          `json:"command" yaml:"command"`
+	Args    []string          `json:"args" yaml:"args"`
+	Env     map[string]string `json:"env" yaml:"env"`
+
+	// Eggs is the list of egg IDs the sidecar is enabled for.
+	Eggs []string `json:"eggs" yaml:"eggs"`
+
+	// Labels enables the sidecar for every server that has all of these labels.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+
+	// Storage is either "none", "readonly" or "readwrite" and controls how the volume of
+	// the server is mounted into the sidecar at MountPath, which defaults to the location
+	// the volume is mounted at in the server process. Nothing is mounted if left empty.
+	Storage   string `json:"storage" yaml:"storage"`
+	MountPath string `json:"mount_path" yaml:"mount_path"`
+
+	// Limits are the amount of memory in megabytes and the percentage of a CPU available
+	// to the sidecar, these are not taken from the limits of the server.
+	Limits struct {
+		Memory int64 `json:"memory" yaml:"memory"`
+		Cpu    int64 `json:"cpu" yaml:"cpu"`
+	} `json:"limits" yaml:"limits"`
+}
+
+// EnabledFor reports if the sidecar should be added to a server using the given
+// egg and labels.
+func (s Sidecar) EnabledFor(egg string, labels map[string]string) bool {
+	for _, e := range s.Eggs {
+		if e == egg {
+			return true
+		}
+	}
+	if len(s.Labels) == 0 {
+		return false
+	}
+	for k, v := range s.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
 }
 
 // Overhead controls the memory overhead given to all containers to circumvent certain
@@ -67,6 +388,354 @@ type Overhead struct {
 	Multipliers map[int]float64 `json:"multipliers" yaml:"multipliers"`
 }
 
+// Overcommit defines the ratios between the limits of a server and the resources requested
+// for it in the cluster. A ratio of 2 requests half of the limit, so twice as many servers
+// fit on a node while each server is still capped at its limit. Ratios below 1 are ignored
+// since a request can never exceed the limit.
+type Overcommit struct {
+	// Cpu is the ratio between the CPU limit and the CPU request of a server.
+	Cpu float64 `default:"1" json:"cpu" yaml:"cpu"`
+
+	// Memory is the ratio between the memory limit and the memory request of a server.
+	Memory float64 `default:"1" json:"memory" yaml:"memory"`
+
+	// DefaultCpuRequest is the amount of CPU in millicores requested for servers that do not
+	// have a CPU limit.
+	DefaultCpuRequest int64 `default:"100" json:"default_cpu_request" yaml:"default_cpu_request"`
+}
+
+// CpuRequest returns the CPU request in millicores for the given CPU limit in
+// millicores. Servers without a limit request the default amount.
+func (o Overcommit) CpuRequest(limit int64) int64 {
+	if limit <= 0 {
+		return o.DefaultCpuRequest
+	}
+	return overcommit(limit, o.Cpu)
+}
+
+// MemoryRequest returns the memory request in bytes for the given memory limit
+// in bytes.
+func (o Overcommit) MemoryRequest(limit int64) int64 {
+	return overcommit(limit, o.Memory)
+}
+
+func overcommit(limit int64, ratio float64) int64 {
+	if ratio <= 1 {
+		return limit
+	}
+	return int64(math.Ceil(float64(limit) / ratio))
+}
+
+// ClusterLimits defines how the thread, swap, IO weight and OOM killer limits of a server
+// are applied. Kubernetes has no per-pod setting for any of these, so each of them depends
+// on how the nodes of the cluster are set up and is not applied unless configured here.
+type ClusterLimits struct {
+	// StaticCpuManager should be enabled when the kubelets use the static CPU manager policy.
+	// Servers pinned to threads then run as Guaranteed pods requesting a whole CPU for every
+	// thread, which the kubelet gives exclusive use of that many CPUs. Which CPUs are used is
+	// decided by the kubelet, only the number of threads is honored.
+	StaticCpuManager bool `default:"false" json:"static_cpu_manager" yaml:"static_cpu_manager"`
+
+	// NodeSwap should be enabled when the kubelets allow swap with the LimitedSwap behavior.
+	// Servers with swap then request less memory than their limit, since only Burstable pods
+	// are allowed to swap. The amount of swap is decided by the kubelet in proportion to the
+	// memory requested by the pod, so the swap of servers is never reported as enforced.
+	NodeSwap bool `default:"false" json:"node_swap" yaml:"node_swap"`
+
+	// IoWeightAnnotation is the pod annotation the IO weight of a server is written to, for
+	// use by a runtime hook on the nodes. The IO weight is not applied if left empty.
+	IoWeightAnnotation string `json:"io_weight_annotation" yaml:"io_weight_annotation"`
+
+	// OOMDisabledAnnotation is the pod annotation set to "true" for servers that have the OOM
+	// killer disabled, for use by a runtime hook on the nodes. The OOM killer is never disabled
+	// if left empty.
+	OOMDisabledAnnotation string `json:"oom_disabled_annotation" yaml:"oom_disabled_annotation"`
+}
+
+// TmpVolume defines the volume mounted at /tmp in the container of a server.
+type TmpVolume struct {
+	// Medium is either "memory" to keep the files in the memory of the node, where they
+	// count towards the memory limit of the server, or "disk" to store them on the node,
+	// where they count towards the ephemeral storage limit of the server.
+	Medium string `default:"memory" json:"medium" yaml:"medium"`
+
+	// Size is the maximum size of the volume in megabytes. Writes beyond it fail when kept in
+	// memory, and the server is evicted from the node when stored on disk.
+	Size int64 `default:"100" json:"size" yaml:"size"`
+}
+
+// ClusterStorage defines the storage tiers available to servers, such as fast local disks
+// or replicated volumes that can be attached to multiple nodes.
+type ClusterStorage struct {
+	// TierLabel is the server label holding the name of the storage tier of the server. When
+	// missing, the first tier enabled for the egg of the server is used.
+	TierLabel string `default:"storage_tier" json:"tier_label" yaml:"tier_label"`
+
+	Tiers []StorageTier `json:"tiers" yaml:"tiers"`
+}
+
+// StorageTier defines the kind of volume created for the servers using the tier.
+type StorageTier struct {
+	Name         string `json:"name" yaml:"name"`
+	StorageClass string `json:"storage_class" yaml:"storage_class"`
+
+	// AccessMode is the access mode of the volumes, such as "ReadWriteOnce" or "ReadWriteMany".
+	// Defaults to "ReadWriteOnce".
+	AccessMode string `json:"access_mode" yaml:"access_mode"`
+
+	// VolumeMode must be "Filesystem" if set, the files of a server are only accessible on
+	// filesystem volumes. Tiers using raw block volumes are rejected.
+	VolumeMode string `json:"volume_mode" yaml:"volume_mode"`
+
+	// Eggs is the list of egg IDs the tier is used for by default.
+	Eggs []string `json:"eggs" yaml:"eggs"`
+}
+
+// Validate returns an error if a storage tier is not able to hold the volumes of
+// servers. The name of a tier is stored as a label on the volumes using it, so it
+// must be a valid label value.
+func (s ClusterStorage) Validate() error {
+	seen := make(map[string]bool, len(s.Tiers))
+	for _, t := range s.Tiers {
+		if t.Name == "" {
+			return errors.New("config: storage tier without a name")
+		}
+		if errs := validation.IsValidLabelValue(t.Name); len(errs) > 0 {
+			return errors.Errorf("config: invalid name of storage tier \"%s\": %s", t.Name, strings.Join(errs, ", "))
+		}
+		if seen[t.Name] {
+			return errors.Errorf("config: storage tier \"%s\" is defined more than once", t.Name)
+		}
+		seen[t.Name] = true
+		if t.VolumeMode != "" && t.VolumeMode != "Filesystem" {
+			return errors.Errorf("config: unsupported volume mode \"%s\" of storage tier \"%s\", only Filesystem is supported", t.VolumeMode, t.Name)
+		}
+	}
+	return nil
+}
+
+// StorageTier returns the storage tier for a server using the given egg and labels. The
+// storage class of the cluster is returned as the "default" tier if no other tier applies.
+func (c ClusterConfiguration) StorageTier(egg string, labels map[string]string) StorageTier {
+	tier, ok := c.Storage.find(egg, labels)
+	if !ok {
+		tier = StorageTier{Name: "default"}
+	}
+	if tier.StorageClass == "" {
+		tier.StorageClass = c.StorageClass
+	}
+	if tier.AccessMode == "" {
+		tier.AccessMode = "ReadWriteOnce"
+	}
+	if tier.VolumeMode == "" {
+		tier.VolumeMode = "Filesystem"
+	}
+	return tier
+}
+
+func (s ClusterStorage) find(egg string, labels map[string]string) (StorageTier, bool) {
+	if name := labels[s.TierLabel]; name != "" {
+		for _, t := range s.Tiers {
+			if t.Name == name {
+				return t, true
+			}
+		}
+	}
+	for _, t := range s.Tiers {
+		for _, e := range t.Eggs {
+			if e == egg {
+				return t, true
+			}
+		}
+	}
+	return StorageTier{}, false
+}
+
+// StorageClasses returns the storage classes of all the storage tiers, including the storage
+// class of the cluster.
+func (c ClusterConfiguration) StorageClasses() []string {
+	out := []string{c.StorageClass}
+	for _, t := range c.Storage.Tiers {
+		if t.StorageClass != "" {
+			out = append(out, t.StorageClass)
+		}
+	}
+	return out
+}
+
+// ClusterPriorities maps the plans of servers to the priority classes used for their pods.
+type ClusterPriorities struct {
+	// PlanLabel is the server label holding the identifier of the plan of the server.
+	PlanLabel string `default:"plan" json:"plan_label" yaml:"plan_label"`
+
+	// Plans maps plan identifiers to the priority class used for servers on that plan.
+	Plans map[string]PriorityClass `json:"plans" yaml:"plans"`
+
+	// Default is the priority class used for servers without a plan, or with a plan that is
+	// not listed.
+	Default PriorityClass `json:"default" yaml:"default"`
+
+	// Installer is the priority class used for the pods installing servers. A class below
+	// the one of running servers that never preempts other pods ensures installations are
+	// not able to starve running servers.
+	Installer PriorityClass `json:"installer" yaml:"installer"`
+}
+
+// PriorityClass defines a PriorityClass in the cluster that is assigned to pods.
+type PriorityClass struct {
+	// Name is the name of the PriorityClass. No priority class is assigned if left empty.
+	Name string `json:"name" yaml:"name"`
+
+	// Value is the priority of the class. When set, the class is created when Kuber boots if
+	// it does not exist yet. Existing classes are never modified since neither their value nor
+	// their preemption policy can be changed.
+	Value int32 `json:"value" yaml:"value"`
+
+	// PreemptionPolicy is either "PreemptLowerPriority" to allow pods to preempt pods of a
+	// lower priority, or "Never". Defaults to "PreemptLowerPriority".
+	PreemptionPolicy string `json:"preemption_policy" yaml:"preemption_policy"`
+}
+
+// Classes returns all the priority classes that are defined.
+func (p ClusterPriorities) Classes() []PriorityClass {
+	out := []PriorityClass{p.Default, p.Installer}
+	for _, c := range p.Plans {
+		out = append(out, c)
+	}
+	return out
+}
+
+// ForLabels returns the priority class for a server with the given labels.
+func (p ClusterPriorities) ForLabels(labels map[string]string) PriorityClass {
+	if c, ok := p.Plans[labels[p.PlanLabel]]; ok {
+		return c
+	}
+	return p.Default
+}
+
+// The pull policies that can be used for the images of servers.
+const (
+	// PullPolicyAlways pulls the image every time a server starts.
+	PullPolicyAlways = "always"
+	// PullPolicyIfNotPresent only pulls the image if it is not on the node yet.
+	PullPolicyIfNotPresent = "if_not_present"
+	// PullPolicyDigest only pulls images pinned to a digest if they are not on the node
+	// yet, and pulls images referenced by a tag every time a server starts.
+	PullPolicyDigest = "digest"
+)
+
+// ClusterImages defines how the images of servers are pulled onto the nodes of the cluster.
+type ClusterImages struct {
+	// PullPolicy is the pull policy used for the images of servers, one of "always",
+	// "if_not_present" or "digest". When unset images pinned to a digest are only ever
+	// pulled if they are not on the node, and other images default to "if_not_present"
+	// when images are pre-pulled, since they are already on the nodes, and to "always"
+	// otherwise.
+	PullPolicy string `json:"pull_policy" yaml:"pull_policy"`
+
+	// PrePull keeps the images of servers on every eligible node of the cluster, so that
+	// servers start quickly and are able to start while the registry is unavailable.
+	PrePull PrePull `json:"pre_pull" yaml:"pre_pull"`
+}
+
+// PrePull defines the DaemonSet that pulls the images used by servers onto the nodes of the
+// cluster. The images are kept in use by the DaemonSet so they are never garbage collected
+// by the nodes.
+type PrePull struct {
+	// Enabled controls whether images are pre-pulled onto the nodes of the cluster.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// Interval is the amount of time in seconds between updates of the images that are
+	// pre-pulled.
+	Interval int `default:"600" json:"interval" yaml:"interval"`
+
+	// Eggs also pre-pulls every image offered by the eggs on the Panel, rather than only
+	// the images used by servers on this node.
+	Eggs bool `default:"false" json:"eggs" yaml:"eggs"`
+
+	// Images are pre-pulled in addition to the images used by servers.
+	Images []string `json:"images" yaml:"images"`
+
+	// NodeSelector limits the nodes images are pre-pulled onto. Images are pre-pulled onto
+	// every node if left empty.
+	NodeSelector map[string]string `json:"node_selector" yaml:"node_selector"`
+
+	// Image is the image the kuber binary is copied from into the pre-pull pods, it must
+	// provide the binary at /usr/bin/kuber. Defaults to the image of the running version
+	// of Kuber.
+	Image string `json:"image" yaml:"image"`
+}
+
+// The kinds of objects able to manage the pods of servers.
+const (
+	WorkloadPod         = "pod"
+	WorkloadStatefulSet = "statefulset"
+)
+
+// ClusterFastRestart defines how servers are restarted in place. The entrypoint of the image
+// of the server is run by a supervisor, which keeps the pod running once the server process
+// exits so that it is able to start the process again. The pod is only recreated when the
+// image, limits, environment or ports of the server changed.
+type ClusterFastRestart struct {
+	// Enabled controls whether the pods of servers are reused when restarting.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// KeepAlive is the amount of time in seconds the pod of a stopped server is kept for
+	// it to be started again, before it is removed to release its resources.
+	KeepAlive int `default:"60" json:"keep_alive" yaml:"keep_alive"`
+
+	// Entrypoint is the entrypoint of the images of servers along with its arguments, which
+	// the supervisor executes without a shell. The cluster does not expose the entrypoint of
+	// an image, so it must match the images used by the eggs of this node. The default is
+	// the entrypoint of the official images, which runs the startup command of the server.
+	Entrypoint []string `default:"[\"/entrypoint.sh\"]" json:"entrypoint" yaml:"entrypoint"`
+
+	// Image is the image the kuber binary is copied from into the pods of servers, it must
+	// provide the binary at /usr/bin/kuber. Defaults to the image of the running version.
+	Image string `json:"image" yaml:"image"`
+}
+
+// ClusterHibernation defines when servers hibernate. While hibernating the pod of a server is
+// removed, keeping its volume and service, and a small pod takes its place that answers on the
+// ports of the server and starts it on the first incoming connection.
+type ClusterHibernation struct {
+	// Enabled controls whether servers are able to hibernate on this node.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// Labels limits hibernation to servers that have all of these labels. Every server is
+	// able to hibernate if left empty.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+
+	// IdleTimeout is the amount of time in minutes a server must be idle before it hibernates.
+	IdleTimeout int `default:"30" json:"idle_timeout" yaml:"idle_timeout"`
+
+	// Threshold is the amount of bytes a server may receive over the network within a minute
+	// while still being considered idle. It is not used for servers whose egg defines a query
+	// for the number of players.
+	Threshold uint64 `default:"16384" json:"threshold" yaml:"threshold"`
+
+	// Message is shown to clients connecting while the server is hibernating, where the
+	// protocol of the server allows it.
+	Message string `default:"Server is starting, please try again in a moment." json:"message" yaml:"message"`
+
+	// Image is the image of the pod answering while a server is hibernating, it must provide
+	// the kuber binary at /usr/bin/kuber. Defaults to the image of the running version of Kuber.
+	Image string `json:"image" yaml:"image"`
+}
+
+// EnabledFor reports if a server with the given labels is able to hibernate.
+func (h ClusterHibernation) EnabledFor(labels map[string]string) bool {
+	if !h.Enabled {
+		return false
+	}
+	for k, v := range h.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
 func (o Overhead) GetMultiplier(memoryLimit int64) float64 {
 	// Default multiplier values.
 	if !o.Override {
@@ -98,4 +767,4 @@ func (o Overhead) GetMultiplier(memoryLimit int64) float64 {
 	}
 
 	return o.DefaultMultiplier
-}
\ No newline at end of file
+}
@@ -1,9 +1,25 @@
 package environment
 
 import (
-	"github.com/kubectyl/kuber/config"
+	"context"
+
+	"emperror.dev/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	"github.com/kubectyl/kuber/config"
+)
+
+const (
+	// ServerLabel is the label applied to every cluster object created for a
+	// server, the value is the UUID of the server.
+	ServerLabel = "uuid"
+
+	// NodeLabel is the label applied to every cluster object created by this
+	// instance, the value is the UUID of the node in the Panel. This allows
+	// multiple nodes to share a namespace without touching each other's objects.
+	NodeLabel = "node"
 )
 
 func Cluster() (c *rest.Config, clientset *kubernetes.Clientset, err error) {
@@ -23,3 +39,30 @@ func Cluster() (c *rest.Config, clientset *kubernetes.Clientset, err error) {
 	}
 	return c, client, err
 }
+
+// ObjectLabels returns the base set of labels that should be applied to any
+// cluster object created for the given server.
+func ObjectLabels(uuid string) map[string]string {
+	return map[string]string{
+		ServerLabel: uuid,
+		NodeLabel:   config.Get().Uuid,
+	}
+}
+
+// NodeSelector returns the label selector matching every server object that
+// was created by this node.
+func NodeSelector() string {
+	return ServerLabel + "," + NodeLabel + "=" + config.Get().Uuid
+}
+
+// ClusterIdentity returns a value that uniquely identifies the cluster the
+// client is connected to. Kubernetes has no notion of a cluster ID, so the UID
+// of the kube-system namespace is used, which never changes for the lifetime of
+// a cluster.
+func ClusterIdentity(ctx context.Context, client kubernetes.Interface) (string, error) {
+	ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "environment: failed to get cluster identity")
+	}
+	return string(ns.UID), nil
+}
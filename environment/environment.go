@@ -14,6 +14,7 @@ const (
 	DockerImagePullStarted   = "docker image pull started"
 	DockerImagePullStatus    = "docker image pull status"
 	DockerImagePullCompleted = "docker image pull completed"
+	DaemonMessageEvent       = "daemon message"
 )
 
 const (
@@ -23,6 +24,25 @@ const (
 	ProcessStoppingState = "stopping"
 )
 
+// Reasons returned by ExitReason when the process did not exit on its own.
+const (
+	// ExitReasonLivenessProbe is returned when the process was killed because it
+	// failed its health check.
+	ExitReasonLivenessProbe = "liveness_probe"
+
+	// ExitReasonEphemeralStorage is returned when the process was evicted because
+	// it used more temporary storage than it is allowed to.
+	ExitReasonEphemeralStorage = "ephemeral_storage"
+
+	// ExitReasonEvicted is returned when the process was evicted for any other
+	// reason, such as the node running low on resources.
+	ExitReasonEvicted = "evicted"
+
+	// ExitReasonPreempted is returned when the process was removed to make room
+	// for a process with a higher priority.
+	ExitReasonPreempted = "preempted"
+)
+
 // Defines the basic interface that all environments need to implement so that
 // a server can be properly controlled.
 type ProcessEnvironment interface {
@@ -82,6 +102,10 @@ type ProcessEnvironment interface {
 	// determines if the process was killed by the system OOM killer.
 	ExitState() (uint32, bool, error)
 
+	// ExitReason returns the reason the process was stopped by the environment itself,
+	// or an empty string if the process exited on its own.
+	ExitReason() (string, error)
+
 	// Creates the necessary environment for running the server process. For example,
 	// in the Docker environment create will create a new container instance for the
 	// server.
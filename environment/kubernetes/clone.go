@@ -0,0 +1,157 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// CloneVolume creates the persistent volume claim of the server as a copy of the
+// claim of the source server, which must not be running. The CSI driver clones
+// the claim when the tier uses the storage class and volume mode of the source
+// claim. Otherwise, or if the driver does not support cloning, the files are
+// streamed from the files pod of the source server into the one of this server
+// as a tar archive.
+func (e *Environment) CloneVolume(ctx context.Context, source *Environment, tier config.StorageTier) error {
+	ns := config.Get().Cluster.Namespace
+	claims := e.client.CoreV1().PersistentVolumeClaims(ns)
+
+	src, err := claims.Get(ctx, source.claimName(), metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to get persistent volume claim")
+	}
+
+	// A clone cannot be smaller than its source.
+	size := *resource.NewQuantity(e.Configuration.Limits().DiskSpace*1024*1024, resource.BinarySI)
+	if c, ok := src.Status.Capacity[corev1.ResourceStorage]; ok && c.Cmp(size) > 0 {
+		size = c
+	}
+	labels := environment.ObjectLabels(e.Id)
+	labels[StorageTierLabel] = tier.Name
+	mode := corev1.PersistentVolumeMode(tier.VolumeMode)
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   e.claimName(),
+			Labels: labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.PersistentVolumeAccessMode(tier.AccessMode),
+			},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+			StorageClassName: &tier.StorageClass,
+			VolumeMode:       &mode,
+		},
+	}
+
+	cloned := false
+	if ok, reason := cloneSupported(ctx, e.client, src, tier); !ok {
+		e.log().WithField("reason", reason).Debug("persistent volume claim cannot be cloned, copying the files instead")
+	} else {
+		if err := e.cloneVolume(ctx, src, pvc.DeepCopy()); err != nil {
+			e.log().WithField("error", err).Warn("failed to clone persistent volume claim, copying the files instead")
+			if err := e.removeVolume(ctx); err != nil {
+				return err
+			}
+		} else {
+			cloned = true
+		}
+	}
+
+	if !cloned {
+		if _, err := claims.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+			return errors.Wrap(err, "environment/kubernetes: failed to create persistent volume claim")
+		}
+		if err := e.copyVolume(ctx, source); err != nil {
+			return err
+		}
+	}
+	e.SetStorageTier(tier.Name)
+
+	// The installer of the server may be scheduled onto another node than the files pod,
+	// which would keep it from attaching a volume that only supports a single node.
+	var zero int64 = 0
+	err = e.client.CoreV1().Pods(ns).Delete(ctx, e.filesPodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to remove files pod")
+	}
+	return nil
+}
+
+// cloneSupported reports if the claim is able to be cloned into a claim of the
+// storage tier by the CSI driver provisioning it, along with the reason when it
+// is not. Only CSI drivers are able to clone claims, provisioners without a
+// CSIDriver object are therefore never asked to.
+func cloneSupported(ctx context.Context, client kubernetes.Interface, src *corev1.PersistentVolumeClaim, tier config.StorageTier) (bool, string) {
+	if src.Spec.StorageClassName == nil || *src.Spec.StorageClassName != tier.StorageClass {
+		return false, "storage class differs"
+	}
+	if src.Spec.VolumeMode != nil && *src.Spec.VolumeMode != corev1.PersistentVolumeMode(tier.VolumeMode) {
+		return false, "volume mode differs"
+	}
+
+	class, err := client.StorageV1().StorageClasses().Get(ctx, tier.StorageClass, metav1.GetOptions{})
+	if err != nil {
+		return false, "storage class not found: " + err.Error()
+	}
+	if _, err := client.StorageV1().CSIDrivers().Get(ctx, class.Provisioner, metav1.GetOptions{}); err != nil {
+		return false, "provisioner is not a csi driver: " + err.Error()
+	}
+	return true, ""
+}
+
+// copyVolume streams every file on the volume of the source server onto the
+// volume of this server.
+func (e *Environment) copyVolume(ctx context.Context, source *Environment) error {
+	e.log().WithField("source", source.Id).Debug("copying files of persistent volume claim")
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(source.VolumeBackend("").Tar(ctx, "", nil, pw))
+	}()
+	if err := e.VolumeBackend("").Untar(ctx, "", pr); err != nil {
+		pr.CloseWithError(err)
+		return errors.Wrap(err, "environment/kubernetes: failed to copy files of persistent volume claim")
+	}
+	return nil
+}
+
+// removeVolume removes the persistent volume claim of the server along with the
+// files pod using it, and waits for the claim to be gone.
+func (e *Environment) removeVolume(ctx context.Context) error {
+	ns := config.Get().Cluster.Namespace
+	var zero int64 = 0
+
+	err := e.client.CoreV1().Pods(ns).Delete(ctx, e.filesPodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to remove files pod")
+	}
+
+	claims := e.client.CoreV1().PersistentVolumeClaims(ns)
+	if err := claims.Delete(ctx, e.claimName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to remove persistent volume claim")
+	}
+	err = wait.PollImmediateWithContext(ctx, time.Second, time.Minute*2, func(ctx context.Context) (bool, error) {
+		_, err := claims.Get(ctx, e.claimName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	return errors.Wrap(err, "environment/kubernetes: persistent volume claim was not removed")
+}
@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/franela/goblin"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubectyl/kuber/config"
+)
+
+func TestCloneSupported(t *testing.T) {
+	g := Goblin(t)
+	ctx := context.Background()
+
+	claim := func(class string, mode corev1.PersistentVolumeMode) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &class, VolumeMode: &mode},
+		}
+	}
+	tier := config.StorageTier{Name: "fast", StorageClass: "fast", VolumeMode: "Filesystem"}
+
+	g.Describe("cloneSupported", func() {
+		g.It("clones claims provisioned by a csi driver", func() {
+			client := fake.NewSimpleClientset(
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, Provisioner: "ebs.csi.aws.com"},
+				&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "ebs.csi.aws.com"}},
+			)
+
+			ok, _ := cloneSupported(ctx, client, claim("fast", corev1.PersistentVolumeFilesystem), tier)
+			g.Assert(ok).IsTrue()
+		})
+
+		g.It("copies the files of claims in another storage class", func() {
+			client := fake.NewSimpleClientset(
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, Provisioner: "ebs.csi.aws.com"},
+				&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "ebs.csi.aws.com"}},
+			)
+
+			ok, reason := cloneSupported(ctx, client, claim("slow", corev1.PersistentVolumeFilesystem), tier)
+			g.Assert(ok).IsFalse()
+			g.Assert(reason).Equal("storage class differs")
+		})
+
+		g.It("copies the files of claims with another volume mode", func() {
+			client := fake.NewSimpleClientset(
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, Provisioner: "ebs.csi.aws.com"},
+				&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "ebs.csi.aws.com"}},
+			)
+
+			ok, reason := cloneSupported(ctx, client, claim("fast", corev1.PersistentVolumeBlock), tier)
+			g.Assert(ok).IsFalse()
+			g.Assert(reason).Equal("volume mode differs")
+		})
+
+		g.It("copies the files of claims provisioned without a csi driver", func() {
+			client := fake.NewSimpleClientset(
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, Provisioner: "rancher.io/local-path"},
+			)
+
+			ok, _ := cloneSupported(ctx, client, claim("fast", corev1.PersistentVolumeFilesystem), tier)
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("copies the files when the storage class does not exist", func() {
+			client := fake.NewSimpleClientset()
+
+			ok, _ := cloneSupported(ctx, client, claim("fast", corev1.PersistentVolumeFilesystem), tier)
+			g.Assert(ok).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/goccy/go-json"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/parser"
+)
+
+// configureMountPath is the directory the configuration files are mounted at
+// within the init container.
+const configureMountPath = "/etc/kuber"
+
+// configsHashAnnotation holds the hash of the configuration files of the server
+// on its pod, so that changing them causes the pod to be recreated.
+const configsHashAnnotation = GameServerGroup + "/configs-hash"
+
+// configsName returns the name of the ConfigMap holding the configuration files
+// of the server.
+func (e *Environment) configsName() string {
+	return e.Id + "-configs"
+}
+
+// configurePod adds the init container updating the configuration files of the
+// server to the pod. Values read from the configuration of Kuber are rendered
+// beforehand, so the init container only needs the files themselves. Nothing is
+// changed when the server has no configuration files.
+func (e *Environment) configurePod(ctx context.Context, pod *corev1.Pod, sc *corev1.SecurityContext) error {
+	e.mu.RLock()
+	files := e.meta.ConfigurationFiles
+	e.mu.RUnlock()
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	rendered := make([]parser.ConfigurationFile, 0, len(files))
+	for _, f := range files {
+		r, err := f.Render()
+		if err != nil {
+			return errors.WrapIf(err, "environment/kubernetes: failed to render configuration file")
+		}
+		rendered = append(rendered, r)
+	}
+	b, err := json.Marshal(rendered)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	sum := sha256.Sum256(b)
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string, 1)
+	}
+	pod.Annotations[configsHashAnnotation] = hex.EncodeToString(sum[:])
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            e.configsName(),
+			Labels:          environment.ObjectLabels(e.Id),
+			OwnerReferences: pod.OwnerReferences,
+		},
+		Data: map[string]string{"configs.json": string(b)},
+	}
+
+	configmaps := e.client.CoreV1().ConfigMaps(config.Get().Cluster.Namespace)
+	if _, err := configmaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return errors.Wrap(err, "environment/kubernetes: failed to create configuration files configmap")
+		}
+		if _, err := configmaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrap(err, "environment/kubernetes: failed to update configuration files configmap")
+		}
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "configs",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: e.configsName()},
+			},
+		},
+	})
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{
+		Name:  "configure",
+		Image: config.KuberImage(config.Get().Cluster.ConfigurationFiles.Image),
+		Command: []string{
+			"/usr/bin/kuber", "parse-configs",
+			"--file", configureMountPath + "/configs.json",
+			"--root", volumePath,
+		},
+		SecurityContext: sc.DeepCopy(),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "storage", MountPath: volumePath},
+			{Name: "configs", MountPath: configureMountPath, ReadOnly: true},
+		},
+	})
+
+	return nil
+}
+
+// publishConfigureOutput publishes any problems reported by the init container
+// while updating the configuration files, so they are shown in the console of
+// the server before the output of the server process.
+func (e *Environment) publishConfigureOutput(ctx context.Context) {
+	pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
+	if err != nil || len(pod.Spec.InitContainers) == 0 {
+		return
+	}
+
+	stream, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).GetLogs(e.PodName(), &corev1.PodLogOptions{Container: "configure"}).Stream(ctx)
+	if err != nil {
+		e.log().WithField("error", err).Warn("failed to read output of configuration files init container")
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			e.Events().Publish(environment.DaemonMessageEvent, line)
+		}
+	}
+}
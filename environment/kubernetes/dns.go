@@ -0,0 +1,207 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// The annotations ExternalDNS reads from the services of servers.
+const (
+	externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+	externalDNSTTLAnnotation      = "external-dns.alpha.kubernetes.io/ttl"
+)
+
+// HostnameLabel holds the name of a server below the base domain on the services
+// publishing its hostname, so that no two servers are published under the same
+// hostname.
+const HostnameLabel = GameServerGroup + "/hostname"
+
+// DNSEndpointResource is the resource used to access the DNSEndpoint objects of
+// ExternalDNS through the dynamic client, which publish the SRV records.
+var DNSEndpointResource = schema.GroupVersionResource{
+	Group:    "externaldns.k8s.io",
+	Version:  "v1alpha1",
+	Resource: "dnsendpoints",
+}
+
+var invalidHostnameRegex = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Hostname returns the hostname the DNS records of the server are published
+// under, or an empty string if no records are published.
+func (e *Environment) Hostname() string {
+	name := e.hostLabel()
+	if name == "" {
+		return ""
+	}
+	return name + "." + strings.Trim(config.Get().Cluster.ExternalDNS.Domain, ".")
+}
+
+// hostLabel returns the name of the server below the base domain, or an empty
+// string if no records are published.
+func (e *Environment) hostLabel() string {
+	cfg := config.Get().Cluster.ExternalDNS
+	// Internal servers are not reachable from outside of the cluster.
+	if !cfg.Enabled || cfg.Domain == "" || e.privateNetwork().Internal {
+		return ""
+	}
+
+	name := strings.ToLower(e.Configuration.Labels()[cfg.Label])
+	name = strings.Trim(invalidHostnameRegex.ReplaceAllString(name, "-"), "-")
+	if len(name) > 63 {
+		name = strings.Trim(name[:63], "-")
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(e.Id, "-")
+	}
+	return name
+}
+
+// checkHostname returns an error if the hostname of the server is already
+// published for another server. The label of servers is chosen freely, so two
+// servers could otherwise end up competing for the same records.
+func (e *Environment) checkHostname(ctx context.Context) error {
+	name := e.hostLabel()
+	if name == "" {
+		return nil
+	}
+
+	list, err := e.client.CoreV1().Services(config.Get().Cluster.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: HostnameLabel + "=" + name,
+	})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to list services")
+	}
+	for _, svc := range list.Items {
+		if owner := svc.Labels[environment.ServerLabel]; owner != e.Id {
+			return errors.Errorf("environment/kubernetes: hostname %s is already used by server %s", e.Hostname(), owner)
+		}
+	}
+	return nil
+}
+
+// dnsEndpointName returns the name of the DNSEndpoint publishing the SRV record
+// of the server.
+func (e *Environment) dnsEndpointName() string {
+	return e.Id + "-dns"
+}
+
+// dnsAnnotations returns the annotations for ExternalDNS to publish the
+// hostname of the server for its services.
+func (e *Environment) dnsAnnotations() map[string]string {
+	host := e.Hostname()
+	if host == "" {
+		return nil
+	}
+	return map[string]string{
+		externalDNSHostnameAnnotation: host,
+		externalDNSTTLAnnotation:      strconv.Itoa(config.Get().Cluster.ExternalDNS.TTL),
+	}
+}
+
+// publishDNS points the SRV record of the server at the port it is reachable
+// on, or removes the record of a server that is no longer published.
+func (e *Environment) publishDNS(ctx context.Context, refs []metav1.OwnerReference) error {
+	if e.Hostname() == "" {
+		return e.deleteSrvRecord(ctx)
+	}
+	if config.Get().Cluster.ExternalDNS.Srv == "" {
+		return nil
+	}
+
+	svc, err := e.client.CoreV1().Services(config.Get().Cluster.Namespace).Get(ctx, "svc-"+e.Id, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "environment/kubernetes: failed to get service")
+	}
+	return e.ensureSrvRecord(ctx, svc, refs)
+}
+
+// ensureSrvRecord creates or updates the DNSEndpoint publishing the SRV record
+// of the server, which points at the port the default allocation of the server
+// is reachable on from outside the cluster.
+func (e *Environment) ensureSrvRecord(ctx context.Context, svc *corev1.Service, refs []metav1.OwnerReference) error {
+	cfg := config.Get().Cluster.ExternalDNS
+	if cfg.Srv == "" {
+		return nil
+	}
+	host := e.Hostname()
+
+	protocol := corev1.ProtocolTCP
+	if strings.HasSuffix(cfg.Srv, "._udp") {
+		protocol = corev1.ProtocolUDP
+	}
+	allocation := e.Configuration.Allocations().DefaultPort
+	port := allocation
+	if svc.Spec.Type == corev1.ServiceTypeNodePort {
+		for _, p := range svc.Spec.Ports {
+			if p.Protocol == protocol && int(p.Port) == allocation && p.NodePort != 0 {
+				port = int(p.NodePort)
+			}
+		}
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": DNSEndpointResource.Group + "/" + DNSEndpointResource.Version,
+		"kind":       "DNSEndpoint",
+		"spec": map[string]interface{}{
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"dnsName":    cfg.Srv + "." + host,
+					"recordType": "SRV",
+					"recordTTL":  int64(cfg.TTL),
+					"targets":    []interface{}{fmt.Sprintf("0 0 %d %s", port, host)},
+				},
+			},
+		},
+	}}
+	u.SetName(e.dnsEndpointName())
+	u.SetLabels(environment.ObjectLabels(e.Id))
+	u.SetOwnerReferences(refs)
+
+	client := e.dynamic.Resource(DNSEndpointResource).Namespace(config.Get().Cluster.Namespace)
+	existing, err := client.Get(ctx, u.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "environment/kubernetes: failed to get dnsendpoint")
+		}
+		if _, err := client.Create(ctx, u, metav1.CreateOptions{}); err != nil {
+			return errors.Wrap(err, "environment/kubernetes: failed to create dnsendpoint")
+		}
+		return nil
+	}
+
+	u.SetResourceVersion(existing.GetResourceVersion())
+	if _, err := client.Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to update dnsendpoint")
+	}
+	return nil
+}
+
+// deleteSrvRecord removes the DNSEndpoint publishing the SRV record of the
+// server, if SRV records are published.
+func (e *Environment) deleteSrvRecord(ctx context.Context) error {
+	cfg := config.Get().Cluster.ExternalDNS
+	if !cfg.Enabled || cfg.Srv == "" {
+		return nil
+	}
+	err := e.dynamic.Resource(DNSEndpointResource).Namespace(config.Get().Cluster.Namespace).Delete(ctx, e.dnsEndpointName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to delete dnsendpoint")
+	}
+	return nil
+}
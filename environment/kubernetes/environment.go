@@ -12,6 +12,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
@@ -20,6 +21,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -29,13 +31,22 @@ import (
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
 	"github.com/kubectyl/kuber/events"
+	"github.com/kubectyl/kuber/parser"
 	"github.com/kubectyl/kuber/remote"
 	"github.com/kubectyl/kuber/system"
 )
 
 type Metadata struct {
-	Image string
-	Stop  remote.ProcessStopConfiguration
+	Image              string
+	Stop               remote.ProcessStopConfiguration
+	HealthCheck        *remote.HealthCheck
+	Sidecars           []config.Sidecar
+	ConfigurationFiles []parser.ConfigurationFile
+	Tmp                config.TmpVolume
+	Dns                config.DnsConfiguration
+	HostNetwork        bool
+	IPFamilies         config.IPFamilyConfiguration
+	Private            PrivateNetwork
 }
 
 // Ensure that the Docker environment is always implementing all the methods
@@ -55,8 +66,9 @@ type Environment struct {
 	meta *Metadata
 
 	// The Docker client being used for this instance.
-	config *rest.Config
-	client *kubernetes.Clientset
+	config  *rest.Config
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
 
 	// Controls the hijacked response stream which exists only when we're attached to
 	// the running container instance.
@@ -73,7 +85,31 @@ type Environment struct {
 	// Tracks the environment state.
 	st *system.AtomicString
 
+	// Serializes updates to the status of the GameServer resource in operator mode.
+	statusMu sync.Mutex
+
+	// The exit state of the server process, kept when the pod is removed to stop the
+	// sidecars once the process has exited.
+	exit *exitState
+
+	// The run of the server process the console is attached to, when the process is
+	// run by the supervisor.
+	run int
+
+	// The addresses the server is reachable at, and when they were last looked up.
+	addresses       *environment.Addresses
+	addressesAt     time.Time
+	addressesLookup system.AtomicBool
+
+	// The storage tier recorded on the volume of the server, and when it was last looked up.
+	storageTier       string
+	storageTierAt     time.Time
+	storageTierLookup system.AtomicBool
+
 	diskUsed int64
+
+	// The helper pod used to access the files on the volume of the server.
+	files filesPodState
 }
 
 // New creates a new base Docker environment. The ID passed through will be the
@@ -85,6 +121,10 @@ func New(id string, m *Metadata, c *environment.Configuration) (*Environment, er
 	if err != nil {
 		return nil, err
 	}
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
 
 	e := &Environment{
 		Id:            id,
@@ -92,6 +132,7 @@ func New(id string, m *Metadata, c *environment.Configuration) (*Environment, er
 		meta:          m,
 		config:        config,
 		client:        cli,
+		dynamic:       dyn,
 		st:            system.NewAtomicString(environment.ProcessOfflineState),
 		emitter:       events.NewBus(),
 	}
@@ -139,7 +180,7 @@ func (e *Environment) DiskUsage(allowStaleValue bool) (int64, error) {
 		Get().
 		Namespace(config.Get().Cluster.Namespace).
 		Resource("pods").
-		Name(e.Id).
+		Name(e.PodName()).
 		SubResource("exec").
 		VersionedParams(&v1.PodExecOptions{
 			Container: "process",
@@ -203,7 +244,7 @@ func (e *Environment) ReturnJSON() ([]byte, error) {
 		return nil, err
 	}
 
-	pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.Id, metav1.GetOptions{})
+	pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.PodName(), metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +293,7 @@ func (e *Environment) Events() *events.Bus {
 // name as the lookup parameter in addition to the longer ID auto-assigned when
 // the container is created.
 func (e *Environment) Exists() (bool, error) {
-	_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.Background(), e.Id, metav1.GetOptions{})
+	_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.Background(), e.PodName(), metav1.GetOptions{})
 	if err != nil {
 		// If this error is because the container instance wasn't found via Docker we
 		// can safely ignore the error and just return false.
@@ -274,20 +315,17 @@ func (e *Environment) Exists() (bool, error) {
 //
 // @see docker/client/errors.go
 func (e *Environment) IsRunning(ctx context.Context) (bool, error) {
-	c, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.Id, metav1.GetOptions{})
+	c, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
 	if err != nil {
 		return false, err
 	}
-	if c.Status.Phase == v1.PodRunning {
-		return true, nil
-	}
-	return false, nil
+	return processRunning(c), nil
 }
 
 // ExitState returns the container exit state, the exit code and whether or not
 // the container was killed by the OOM killer.
 func (e *Environment) ExitState() (uint32, bool, error) {
-	c, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.Background(), e.Id, metav1.GetOptions{})
+	c, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.Background(), e.PodName(), metav1.GetOptions{})
 	if err != nil {
 		// I'm not entirely sure how this can happen to be honest. I tried deleting a
 		// container _while_ a server was running and wings gracefully saw the crash and
@@ -299,20 +337,28 @@ func (e *Environment) ExitState() (uint32, bool, error) {
 		//
 		// @see https://github.com/pterodactyl/panel/issues/2003
 		if apierrors.IsNotFound(err) {
+			if ex := e.lastExit(); ex != nil {
+				return ex.code, ex.oom, nil
+			}
 			return 1, false, nil
 		}
 		return 0, false, err
 	}
 
-	if c.Status.Phase != v1.PodRunning && len(c.Status.ContainerStatuses) != 0 {
-		if c.Status.ContainerStatuses[0].State.Terminated != nil {
-			// OOMKilled
-			if c.Status.ContainerStatuses[0].State.Terminated.ExitCode == 137 {
-				return 137, true, nil
-			}
+	// The container of a supervised process keeps running after the process exited.
+	if supervised(c) {
+		if ex := e.lastExit(); ex != nil {
+			return ex.code, ex.oom, nil
+		}
+	}
 
-			return uint32(c.Status.ContainerStatuses[0].State.Terminated.ExitCode), false, nil
+	if cs := processStatus(c); cs != nil && cs.State.Terminated != nil {
+		// OOMKilled
+		if cs.State.Terminated.ExitCode == 137 {
+			return 137, true, nil
 		}
+
+		return uint32(cs.State.Terminated.ExitCode), false, nil
 	}
 	return 1, false, nil
 }
@@ -333,6 +379,63 @@ func (e *Environment) SetStopConfiguration(c remote.ProcessStopConfiguration) {
 	e.mu.Unlock()
 }
 
+// SetHealthCheck sets the health check that is applied to the server process
+// the next time it is started.
+func (e *Environment) SetHealthCheck(hc *remote.HealthCheck) {
+	e.mu.Lock()
+	e.meta.HealthCheck = hc
+	e.mu.Unlock()
+}
+
+// SetSidecars sets the sidecar containers that are added to the pod the next
+// time the server is started.
+func (e *Environment) SetSidecars(s []config.Sidecar) {
+	e.mu.Lock()
+	e.meta.Sidecars = s
+	e.mu.Unlock()
+}
+
+// SetTmpVolume sets the volume mounted at /tmp the next time the server is
+// started.
+func (e *Environment) SetTmpVolume(t config.TmpVolume) {
+	e.mu.Lock()
+	e.meta.Tmp = t
+	e.mu.Unlock()
+}
+
+// SetNetwork sets how the server resolves names, and if it runs in the network
+// namespace of its node, the next time the server is started.
+func (e *Environment) SetNetwork(dns config.DnsConfiguration, hostNetwork bool) {
+	e.mu.Lock()
+	e.meta.Dns = dns
+	e.meta.HostNetwork = hostNetwork
+	e.mu.Unlock()
+}
+
+// SetIPFamilies sets the IP families of the service of the server, which are
+// used the next time the service is created.
+func (e *Environment) SetIPFamilies(f config.IPFamilyConfiguration) {
+	e.mu.Lock()
+	e.meta.IPFamilies = f
+	e.mu.Unlock()
+}
+
+// SetPrivateNetwork sets how the server is reachable by the other servers in the
+// cluster, which is applied the next time the server is started.
+func (e *Environment) SetPrivateNetwork(n PrivateNetwork) {
+	e.mu.Lock()
+	e.meta.Private = n
+	e.mu.Unlock()
+}
+
+// SetConfigurationFiles sets the configuration files that are updated by an
+// init container the next time the server is started.
+func (e *Environment) SetConfigurationFiles(f []parser.ConfigurationFile) {
+	e.mu.Lock()
+	e.meta.ConfigurationFiles = f
+	e.mu.Unlock()
+}
+
 func (e *Environment) SetImage(i string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -360,6 +463,10 @@ func (e *Environment) SetState(state string) {
 		// If the state changed make sure we update the internal tracking to note that.
 		e.st.Store(state)
 		e.Events().Publish(environment.StateChangeEvent, state)
+
+		if config.Get().Cluster.Operator.Enabled {
+			go e.syncGameServerStatus()
+		}
 	}
 }
 
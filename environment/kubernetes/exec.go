@@ -0,0 +1,278 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// The amount of output kept from each stream of a command run through
+// RunCommand, anything beyond it is discarded.
+const commandOutputLimit = 1024 * 1024
+
+// CommandResult is the outcome of a command run through RunCommand.
+type CommandResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Debug is set when the command ran in a short-lived pod, since the server
+	// process was not running.
+	Debug bool `json:"debug"`
+}
+
+// Exec runs the command in the server process container without a terminal,
+// streaming its output to the given writers until it exits.
+func (e *Environment) Exec(ctx context.Context, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return e.exec(ctx, e.PodName(), "process", command, stdin, stdout, stderr)
+}
+
+func (e *Environment) exec(ctx context.Context, pod string, container string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	req := e.client.CoreV1().RESTClient().
+		Post().
+		Namespace(config.Get().Cluster.Namespace).
+		Resource("pods").
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+			TTY:       false,
+		}, scheme.ParameterCodec)
+
+	executor, err := e.executor(ctx, req.URL())
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to create executor")
+	}
+
+	return executor.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+// commandScript runs the command given as its second argument through the shell,
+// killing it along with every process it started once the number of seconds given
+// as its first argument has passed. The timeout utility is used when the image
+// provides it, otherwise the processes started by the command are found through
+// the proc filesystem.
+const commandScript = `if command -v timeout >/dev/null 2>&1; then exec timeout -s KILL "$0" sh -c "$1"; fi
+kill_tree() {
+	kill -STOP "$1" 2>/dev/null
+	for c in $(cat /proc/"$1"/task/*/children 2>/dev/null); do kill_tree "$c"; done
+	kill -KILL "$1" 2>/dev/null
+}
+sh -c "$1" &
+pid=$!
+(sleep "$0"; kill_tree "$pid") &
+timer=$!
+wait "$pid"
+code=$?
+kill_tree "$timer"
+exit "$code"`
+
+// RunCommand runs a one-off command through the shell of the server image and
+// returns its output once it exits. The command runs in the server process
+// container if it is running, otherwise in a short-lived pod running the image
+// of the server with the same volume mounted, which is removed once the command
+// exited. The command is killed once the timeout has passed.
+func (e *Environment) RunCommand(ctx context.Context, command string, timeout time.Duration) (*CommandResult, error) {
+	seconds := int(math.Ceil(timeout.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	res := &CommandResult{}
+	pod, container := e.PodName(), "process"
+
+	p, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil || p.DeletionTimestamp != nil || !processRunning(p) {
+		res.Debug = true
+		if pod, err = e.commandPod(ctx, seconds); err != nil {
+			return nil, err
+		}
+		container = "command"
+		defer e.removeCommandPod(pod)
+	}
+
+	// The command is killed within the container once the timeout passed, the context
+	// only guards against the connection to the cluster hanging.
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(seconds)*time.Second+time.Second*10)
+	defer cancel()
+
+	stdout := &limitedBuffer{limit: commandOutputLimit}
+	stderr := &limitedBuffer{limit: commandOutputLimit}
+	err = e.exec(ctx, pod, container, []string{"sh", "-c", commandScript, strconv.Itoa(seconds), command}, nil, stdout, stderr)
+	res.Stdout, res.Stderr = stdout.String(), stderr.String()
+
+	var ee exec.ExitError
+	if errors.As(err, &ee) {
+		res.ExitCode = ee.ExitStatus()
+	} else if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "environment/kubernetes: command did not finish in time")
+		}
+		return nil, errors.Wrap(err, "environment/kubernetes: failed to run command")
+	}
+
+	return res, nil
+}
+
+// commandPod creates a pod running the image of the server with its volume
+// mounted in the same place, and waits for it to be running before returning
+// its name. It runs as the user of the server process, on the node the volume is
+// currently used on, and exits by itself shortly after the timeout passed.
+func (e *Environment) commandPod(ctx context.Context, seconds int) (string, error) {
+	e.mu.RLock()
+	image := e.meta.Image
+	e.mu.RUnlock()
+
+	pods := e.client.CoreV1().Pods(config.Get().Cluster.Namespace)
+
+	// Volumes that can only be attached to a single node must be accessed from the node
+	// they are already used on.
+	var node string
+	for _, name := range []string{e.PodName(), e.filesPodName()} {
+		if p, err := pods.Get(ctx, name, metav1.GetOptions{}); err == nil && p.Spec.NodeName != "" {
+			node = p.Spec.NodeName
+			break
+		} else if err != nil && !apierrors.IsNotFound(err) {
+			return "", errors.Wrap(err, "environment/kubernetes: failed to inspect container")
+		}
+	}
+
+	refs, err := e.OwnerReferences(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	labels := environment.ObjectLabels(e.Id)
+	labels["ContainerType"] = "server_command"
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            e.Id + "-command-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+			Labels:          labels,
+			OwnerReferences: refs,
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: "storage",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: e.claimName(),
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            "command",
+					Image:           image,
+					ImagePullPolicy: PullPolicy(image),
+					Command:         []string{"sleep", strconv.Itoa(seconds + 10)},
+					WorkingDir:      volumePath,
+					SecurityContext: securityContext(),
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "storage",
+							MountPath: volumePath,
+						},
+					},
+				},
+			},
+			// Pods left behind when Kuber stopped before removing them are stopped by the
+			// cluster, pulling the image is included in this deadline.
+			ActiveDeadlineSeconds:         &[]int64{int64(seconds) + 300}[0],
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: &[]int64{0}[0],
+		},
+	}
+	if node != "" {
+		pod.Spec.Affinity = &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{
+							MatchFields: []corev1.NodeSelectorRequirement{
+								{
+									Key:      "metadata.name",
+									Operator: corev1.NodeSelectorOpIn,
+									Values:   []string{node},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	if _, err := pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return "", errors.Wrap(err, "environment/kubernetes: failed to create command pod")
+	}
+
+	err = wait.PollImmediateWithContext(ctx, time.Second, time.Minute*2, func(ctx context.Context) (bool, error) {
+		p, err := pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if p.Status.Phase == corev1.PodFailed || p.Status.Phase == corev1.PodSucceeded {
+			return false, errors.Errorf("command pod exited: %s", p.Status.Reason)
+		}
+		return p.Status.Phase == corev1.PodRunning, nil
+	})
+	if err != nil {
+		e.removeCommandPod(pod.Name)
+		return "", errors.Wrap(err, "environment/kubernetes: command pod did not start")
+	}
+
+	return pod.Name, nil
+}
+
+// removeCommandPod removes the pod a command was run in.
+func (e *Environment) removeCommandPod(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{0}[0]})
+	if err != nil && !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to remove command pod")
+	}
+}
+
+// limitedBuffer is a buffer that discards anything written to it beyond its
+// limit, without failing the write.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.Len(); n < len(p) {
+		if n > 0 {
+			b.Buffer.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
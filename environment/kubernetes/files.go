@@ -0,0 +1,898 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gabriel-vasile/mimetype"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/server/filesystem"
+)
+
+// The directory the persistent volume of the server is mounted at within the
+// helper pod, this matches the location used by the server process itself.
+const volumePath = "/home/container"
+
+// The directory the persistent volume is additionally mounted at as read-only,
+// which archives of the volume are created from so that they can never change
+// any of the files.
+const readOnlyVolumePath = "/mnt/container"
+
+// The amount of time the metadata of files read from the helper pod is reused
+// for, as long as no file is changed in the meantime. Resolving and inspecting a
+// path is usually followed by more operations on the same path right away.
+const metadataTTL = time.Second * 2
+
+// filesScript is executed by the helper pod for every file operation. The first
+// argument is the operation to perform, followed by the arguments for it. Missing
+// files exit with a code of 2, existing files with 3 and directories that were
+// expected to be files with 4.
+const filesScript = `
+exists() { [ -e "$1" ] || [ -L "$1" ]; }
+info() {
+	s=$(stat $1 -c '%s %f %Y %Z' "$2") || exit 1
+	n=$(printf '%s' "$3" | base64 -w0)
+	if [ -d "$2" ]; then h=-; elif [ -f "$2" ]; then h=f$(head -c 3072 "$2" | base64 -w0); else h=; fi
+	echo "$s $n $h"
+}
+op=$1
+shift
+case "$op" in
+stat) [ -e "$1" ] || exit 2; info -L "$1" "$(basename "$1")" ;;
+lstat) exists "$1" || exit 2; info "" "$1" "$(basename "$1")" ;;
+list)
+	[ -e "$1" ] || exit 2
+	cd "$1" || exit 1
+	for f in .* *; do
+		{ [ "$f" = . ] || [ "$f" = .. ]; } && continue
+		exists "$f" || continue
+		info "" "$f" "$f"
+	done ;;
+realpath) [ -e "$1" ] || exit 2; r=$(realpath "$1") || exit 1; echo "$r"; info -L "$r" "$(basename "$r")" ;;
+read) [ -e "$1" ] || exit 2; [ -d "$1" ] && exit 4; cat "$1" ;;
+write) [ -d "$1" ] && exit 4; mkdir -p "$(dirname "$1")" && cat > "$1" ;;
+mkdir) mkdir -p -m "$1" "$2" ;;
+rename) exists "$1" || exit 2; exists "$2" && exit 3; mv "$1" "$2" ;;
+remove)
+	if [ "$1" = /home/container ]; then
+		find "$1" -mindepth 1 -maxdepth 1 -exec rm -rf {} +
+	else
+		rm -rf "$1"
+	fi ;;
+chown) exists "$2" || exit 2; find "$2" -exec chown -h "$1" {} + ;;
+chmod) exists "$2" || exit 2; chmod "$1" "$2" ;;
+touch) exists "$2" || exit 2; touch -c -d "@$1" "$2" ;;
+du) exists "$1" || exit 2; find "$1" -type f -exec stat -c %s {} + | awk '{ s += $1 } END { print s + 0 }' ;;
+archive) dst=$1; cd "$2" || exit 2; shift 2; tar -czf "$dst" "$@" ;;
+tar) cd "$1" || exit 2; shift; tar -cf - "$@" . ;;
+untar) mkdir -p "$1" && tar -xf - -C "$1" ;;
+*) echo "unknown operation: $op" >&2; exit 1 ;;
+esac
+`
+
+// Ensure that the volume backend implements every method required by the server
+// filesystem.
+var _ filesystem.Backend = (*VolumeBackend)(nil)
+
+// VolumeBackend performs file operations directly on the persistent volume of a
+// server. The volume is mounted into a small helper pod which is created when it
+// is first needed, and every operation is executed within that pod. The pod is
+// removed again once it has not been used for the configured idle timeout.
+type VolumeBackend struct {
+	env  *Environment
+	root string
+}
+
+// filesPodState tracks the helper pod of a server, which is shared by every
+// backend of the environment.
+type filesPodState struct {
+	mu     sync.Mutex
+	ready  bool
+	active int
+	used   time.Time
+	timer  *time.Timer
+
+	// Closed once the operation currently starting the pod finished, nil if no
+	// operation is starting it.
+	starting chan struct{}
+
+	// The metadata of files read from the helper pod, by their path on the volume.
+	meta map[string]cachedMetadata
+}
+
+type cachedMetadata struct {
+	stat *filesystem.Stat
+	real string
+	at   time.Time
+}
+
+// VolumeBackend returns a filesystem backend that operates on the persistent
+// volume of the server. Paths passed to the backend are expected to be within
+// the given root directory, which is mapped onto the root of the volume.
+func (e *Environment) VolumeBackend(root string) *VolumeBackend {
+	return &VolumeBackend{env: e, root: strings.TrimSuffix(root, "/")}
+}
+
+// filesPodName returns the name of the helper pod used to access the files of
+// the server.
+func (e *Environment) filesPodName() string {
+	return e.Id + "-files"
+}
+
+// volumePath translates a path within the root directory into the location of
+// that file on the volume mounted in the helper pod.
+func (b *VolumeBackend) volumePath(p string) string {
+	if p == b.root {
+		return volumePath
+	}
+	return path.Join(volumePath, strings.TrimPrefix(p, b.root+"/"))
+}
+
+// localPath translates a path on the volume back into the root directory. Paths
+// that are not on the volume are returned unchanged, and will therefore never be
+// considered to be within the root directory of the server.
+func (b *VolumeBackend) localPath(p string) string {
+	if p == volumePath {
+		return b.root
+	}
+	if strings.HasPrefix(p, volumePath+"/") {
+		return path.Join(b.root, strings.TrimPrefix(p, volumePath+"/"))
+	}
+	return p
+}
+
+func (b *VolumeBackend) Stat(p string) (filesystem.Stat, error) {
+	if m, ok := b.cached(b.volumePath(p)); ok && m.stat != nil {
+		return *m.stat, nil
+	}
+	out, err := b.run(context.Background(), nil, "stat", b.volumePath(p))
+	if err != nil {
+		return filesystem.Stat{}, pathError("stat", p, err)
+	}
+	st, err := parseFileInfo(strings.TrimSpace(out))
+	if err != nil {
+		return st, err
+	}
+	b.cache(b.volumePath(p), cachedMetadata{stat: &st})
+	return st, nil
+}
+
+func (b *VolumeBackend) Lstat(p string) (os.FileInfo, error) {
+	out, err := b.run(context.Background(), nil, "lstat", b.volumePath(p))
+	if err != nil {
+		return nil, pathError("lstat", p, err)
+	}
+	st, err := parseFileInfo(strings.TrimSpace(out))
+	if err != nil {
+		return nil, err
+	}
+	return st.FileInfo, nil
+}
+
+func (b *VolumeBackend) ReadDir(p string) ([]filesystem.Stat, error) {
+	out, err := b.run(context.Background(), nil, "list", b.volumePath(p))
+	if err != nil {
+		return nil, pathError("readdir", p, err)
+	}
+	var stats []filesystem.Stat
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	// Lines include the base64 encoded header of the file, so allow for lines that
+	// are larger than the default buffer size.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		st, err := parseFileInfo(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+		// Listing a directory is usually followed by operations on its entries, so their
+		// metadata is kept. Symlinks are skipped since their target is not listed.
+		if st.Mode()&os.ModeSymlink == 0 {
+			st := st
+			b.cache(path.Join(b.volumePath(p), st.Name()), cachedMetadata{stat: &st})
+		}
+	}
+	return stats, errors.WithStack(scanner.Err())
+}
+
+func (b *VolumeBackend) EvalSymlinks(p string) (string, error) {
+	if m, ok := b.cached(b.volumePath(p)); ok && m.real != "" {
+		return b.localPath(m.real), nil
+	}
+	out, err := b.run(context.Background(), nil, "realpath", b.volumePath(p))
+	if err != nil {
+		return "", pathError("evalsymlinks", p, err)
+	}
+	// The resolved path is returned along with the metadata of the file it points to,
+	// which is almost always needed right after resolving it.
+	resolved, info, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	if st, err := parseFileInfo(info); err == nil {
+		b.cache(b.volumePath(p), cachedMetadata{real: resolved})
+		b.cache(resolved, cachedMetadata{stat: &st, real: resolved})
+	}
+	return b.localPath(resolved), nil
+}
+
+func (b *VolumeBackend) Open(p string) (io.ReadCloser, error) {
+	release, err := b.acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, w := io.Pipe()
+	go func() {
+		defer release()
+		defer cancel()
+		err := b.exec(ctx, nil, w, "read", b.volumePath(p))
+		if err != nil {
+			err = pathError("open", p, err)
+		}
+		w.CloseWithError(err)
+	}()
+	return &cancelReader{ReadCloser: r, cancel: cancel}, nil
+}
+
+func (b *VolumeBackend) WriteFile(p string, r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	if _, err := b.run(context.Background(), cr, "write", b.volumePath(p)); err != nil {
+		return cr.n, pathError("write", p, err)
+	}
+	return cr.n, nil
+}
+
+func (b *VolumeBackend) MkdirAll(p string, perm os.FileMode) error {
+	_, err := b.run(context.Background(), nil, "mkdir", strconv.FormatUint(uint64(perm.Perm()), 8), b.volumePath(p))
+	return pathError("mkdir", p, err)
+}
+
+func (b *VolumeBackend) Rename(from string, to string) error {
+	_, err := b.run(context.Background(), nil, "rename", b.volumePath(from), b.volumePath(to))
+	return pathError("rename", from, err)
+}
+
+func (b *VolumeBackend) RemoveAll(p string) error {
+	_, err := b.run(context.Background(), nil, "remove", b.volumePath(p))
+	return pathError("remove", p, err)
+}
+
+func (b *VolumeBackend) Chmod(p string, mode os.FileMode) error {
+	_, err := b.run(context.Background(), nil, "chmod", strconv.FormatUint(uint64(mode.Perm()), 8), b.volumePath(p))
+	return pathError("chmod", p, err)
+}
+
+func (b *VolumeBackend) Chtimes(p string, atime time.Time, mtime time.Time) error {
+	_, err := b.run(context.Background(), nil, "touch", strconv.FormatInt(mtime.Unix(), 10), b.volumePath(p))
+	return pathError("chtimes", p, err)
+}
+
+// Chown changes the owner of the path to the user the server process runs as,
+// which differs from the given user when running rootless containers.
+func (b *VolumeBackend) Chown(p string, uid int, gid int) error {
+	sc := securityContext()
+	_, err := b.run(context.Background(), nil, "chown", fmt.Sprintf("%d:%d", *sc.RunAsUser, *sc.RunAsGroup), b.volumePath(p))
+	return pathError("chown", p, err)
+}
+
+func (b *VolumeBackend) DirectorySize(p string) (int64, error) {
+	out, err := b.run(context.Background(), nil, "du", b.volumePath(p))
+	if err != nil {
+		return 0, pathError("du", p, err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	return size, errors.WithStack(err)
+}
+
+func (b *VolumeBackend) Archive(ctx context.Context, dir string, files []string, dst string) error {
+	if len(files) == 0 {
+		files = []string{"."}
+	}
+	args := append([]string{"archive", b.volumePath(dst), b.volumePath(dir), "--"}, files...)
+	_, err := b.run(ctx, nil, args...)
+	return pathError("archive", dir, err)
+}
+
+func (b *VolumeBackend) Tar(ctx context.Context, dir string, exclude []string, w io.Writer) error {
+	release, err := b.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	args := []string{"tar", readOnlyVolumePath + strings.TrimPrefix(b.volumePath(dir), volumePath)}
+	for _, p := range exclude {
+		args = append(args, "--exclude="+p)
+	}
+	return pathError("tar", dir, b.exec(ctx, nil, w, args...))
+}
+
+func (b *VolumeBackend) Untar(ctx context.Context, dir string, r io.Reader) error {
+	_, err := b.run(ctx, r, "untar", b.volumePath(dir))
+	return pathError("untar", dir, err)
+}
+
+// run executes a file operation in the helper pod and returns everything written
+// to the standard output. The metadata read from the pod is discarded for every
+// operation that may change files.
+func (b *VolumeBackend) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	release, err := b.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	switch args[0] {
+	case "stat", "lstat", "list", "realpath", "read", "du", "tar":
+	default:
+		defer b.invalidate()
+	}
+	var stdout bytes.Buffer
+	if err := b.exec(ctx, stdin, &stdout, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+func (b *VolumeBackend) exec(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) error {
+	// Changing the owner of files requires privileges the server user does not
+	// have, so it is the only operation performed by the separate chown container.
+	container := "files"
+	if args[0] == "chown" {
+		container = "chown"
+	}
+
+	e := b.env
+	req := e.client.CoreV1().RESTClient().
+		Post().
+		Namespace(config.Get().Cluster.Namespace).
+		Resource("pods").
+		Name(e.filesPodName()).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   append([]string{"sh", "-c", filesScript, "sh"}, args...),
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       false,
+		}, scheme.ParameterCodec)
+
+	executor, err := e.executor(ctx, req.URL())
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	err = executor.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: &stderr,
+	})
+	if err == nil {
+		return nil
+	}
+
+	var ee exec.ExitError
+	if errors.As(err, &ee) {
+		switch ee.ExitStatus() {
+		case 2:
+			return os.ErrNotExist
+		case 3:
+			return os.ErrExist
+		case 4:
+			return syscall.EISDIR
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return errors.WithStack(err)
+	}
+
+	// Anything other than the command failing means the helper pod may no longer
+	// be available, so check it again before the next operation.
+	f := &b.env.files
+	f.mu.Lock()
+	f.ready = false
+	f.mu.Unlock()
+
+	return errors.Wrap(err, "environment/kubernetes: failed to execute file operation")
+}
+
+// acquire ensures that the helper pod is running and keeps it from being removed
+// until the returned function is called.
+func (b *VolumeBackend) acquire(ctx context.Context) (func(), error) {
+	if err := b.ensure(ctx); err != nil {
+		return nil, err
+	}
+	f := &b.env.files
+	f.mu.Lock()
+	f.active++
+	f.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			f.active--
+			b.env.touchFilesPod()
+			f.mu.Unlock()
+		})
+	}, nil
+}
+
+// ensure creates the helper pod for the server if it does not already exist and
+// waits for it to be running. Only one operation starts the pod at a time, any
+// other waits for it without holding the lock of the pod state.
+func (b *VolumeBackend) ensure(ctx context.Context) error {
+	f := &b.env.files
+	for {
+		f.mu.Lock()
+		if f.ready {
+			b.env.touchFilesPod()
+			f.mu.Unlock()
+			return nil
+		}
+		starting := f.starting
+		if starting == nil {
+			break
+		}
+		f.mu.Unlock()
+		select {
+		case <-starting:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	f.starting = done
+	f.mu.Unlock()
+
+	err := b.start(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.starting = nil
+	close(done)
+	if err != nil {
+		return err
+	}
+	f.ready = true
+	b.env.touchFilesPod()
+	return nil
+}
+
+// start creates the helper pod, replacing it if it is outdated, and waits for it
+// to be running.
+func (b *VolumeBackend) start(ctx context.Context) error {
+	e := b.env
+	pods := e.client.CoreV1().Pods(config.Get().Cluster.Namespace)
+
+	// Volumes that can only be attached to a single node must be accessed from the node the
+	// server process is running on.
+	var node string
+	if p, err := pods.Get(ctx, e.PodName(), metav1.GetOptions{}); err == nil {
+		node = p.Spec.NodeName
+	} else if !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to inspect container")
+	}
+
+	pod, err := pods.Get(ctx, e.filesPodName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to inspect files pod")
+	}
+	if err == nil && (pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded || (node != "" && pod.Spec.NodeName != "" && pod.Spec.NodeName != node) || !isCurrentFilesPod(pod)) {
+		var zero int64 = 0
+		if err := pods.Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &zero}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "environment/kubernetes: failed to remove files pod")
+		}
+		err = apierrors.NewNotFound(corev1.Resource("pods"), pod.Name)
+	}
+	if apierrors.IsNotFound(err) {
+		e.log().Debug("creating files pod for server")
+		spec, err := e.filesPod(ctx, node)
+		if err != nil {
+			return err
+		}
+		if _, err := pods.Create(ctx, spec, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return errors.Wrap(err, "environment/kubernetes: failed to create files pod")
+		}
+	}
+
+	err = wait.PollImmediateWithContext(ctx, time.Second, time.Minute*2, func(ctx context.Context) (bool, error) {
+		p, err := pods.Get(ctx, e.filesPodName(), metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return p.Status.Phase == corev1.PodRunning, nil
+	})
+	return errors.Wrap(err, "environment/kubernetes: files pod did not become ready")
+}
+
+// touchFilesPod records that the helper pod was just used and schedules its
+// removal once it has been idle for the configured timeout. The caller must hold
+// the lock of the pod state.
+func (e *Environment) touchFilesPod() {
+	f := &e.files
+	f.used = time.Now()
+	idle := time.Duration(config.Get().Cluster.Files.IdleTimeout) * time.Second
+	if idle <= 0 {
+		return
+	}
+	if f.timer == nil {
+		f.timer = time.AfterFunc(idle, e.removeIdleFilesPod)
+	} else {
+		f.timer.Reset(idle)
+	}
+}
+
+// removeIdleFilesPod removes the helper pod of the server if no file operation
+// used it within the idle timeout. The lock is held while the pod is removed so
+// that no operation starts using it in the meantime.
+func (e *Environment) removeIdleFilesPod() {
+	f := &e.files
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	idle := time.Duration(config.Get().Cluster.Files.IdleTimeout) * time.Second
+	if f.active > 0 || f.starting != nil || time.Since(f.used) < idle {
+		return
+	}
+	f.ready = false
+	f.meta = nil
+
+	e.log().Debug("removing idle files pod of server")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	var zero int64 = 0
+	err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, e.filesPodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero})
+	if err != nil && !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to remove idle files pod")
+	}
+}
+
+// cached returns the metadata read for a path on the volume, if it was read
+// recently and nothing changed since.
+func (b *VolumeBackend) cached(p string) (cachedMetadata, bool) {
+	f := &b.env.files
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.meta[p]
+	if !ok || time.Since(m.at) > metadataTTL {
+		return cachedMetadata{}, false
+	}
+	return m, true
+}
+
+func (b *VolumeBackend) cache(p string, m cachedMetadata) {
+	f := &b.env.files
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.meta == nil {
+		f.meta = make(map[string]cachedMetadata)
+	}
+	if prev, ok := f.meta[p]; ok && time.Since(prev.at) <= metadataTTL {
+		if m.stat == nil {
+			m.stat = prev.stat
+		}
+		if m.real == "" {
+			m.real = prev.real
+		}
+	}
+	m.at = time.Now()
+	f.meta[p] = m
+}
+
+// invalidate discards all the metadata read from the helper pod.
+func (b *VolumeBackend) invalidate() {
+	f := &b.env.files
+	f.mu.Lock()
+	f.meta = nil
+	f.mu.Unlock()
+}
+
+// filesPod returns the definition of the helper pod that mounts the persistent
+// volume of the server. If the server process is running the pod is scheduled on
+// the same node, otherwise it prefers to be scheduled next to it, so that volumes
+// which can only be attached to a single node remain usable.
+func (e *Environment) filesPod(ctx context.Context, node string) (*corev1.Pod, error) {
+	labels := environment.ObjectLabels(e.Id)
+	labels["ContainerType"] = "server_files"
+
+	// The helper only ever touches the volume, so it runs as the user of the server
+	// process without being able to modify its own filesystem.
+	sc := securityContext()
+	sc.ReadOnlyRootFilesystem = &[]bool{true}[0]
+	sc.AllowPrivilegeEscalation = &[]bool{false}[0]
+	sc.Capabilities = &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+
+	// Files created by the installer or a restore may belong to another user, which
+	// only root is able to change. That container is not able to do anything else.
+	chown := &corev1.SecurityContext{
+		RunAsNonRoot:             &[]bool{false}[0],
+		RunAsUser:                &[]int64{0}[0],
+		RunAsGroup:               &[]int64{0}[0],
+		ReadOnlyRootFilesystem:   &[]bool{true}[0],
+		AllowPrivilegeEscalation: &[]bool{false}[0],
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+			Add:  []corev1.Capability{"CHOWN", "DAC_READ_SEARCH"},
+		},
+	}
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			"cpu":    resource.MustParse("500m"),
+			"memory": resource.MustParse("128Mi"),
+		},
+		Requests: corev1.ResourceList{
+			"cpu":    resource.MustParse("10m"),
+			"memory": resource.MustParse("16Mi"),
+		},
+	}
+
+	refs, err := e.OwnerReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            e.filesPodName(),
+			Labels:          labels,
+			OwnerReferences: refs,
+		},
+		Spec: corev1.PodSpec{
+			Affinity: &corev1.Affinity{
+				PodAffinity: &corev1.PodAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+						{
+							Weight: 100,
+							PodAffinityTerm: corev1.PodAffinityTerm{
+								LabelSelector: &metav1.LabelSelector{
+									MatchLabels: map[string]string{
+										environment.ServerLabel: e.Id,
+										"ContainerType":         "server_process",
+									},
+								},
+								TopologyKey: "kubernetes.io/hostname",
+							},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "storage",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: e.Id + "-pvc",
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            "files",
+					Image:           config.Get().Cluster.Files.Image,
+					Command:         []string{"sleep", "2147483647"},
+					SecurityContext: sc,
+					Resources:       resources,
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "storage",
+							MountPath: volumePath,
+						},
+						{
+							Name:      "storage",
+							MountPath: readOnlyVolumePath,
+							ReadOnly:  true,
+						},
+					},
+				},
+				{
+					Name:            "chown",
+					Image:           config.Get().Cluster.Files.Image,
+					Command:         []string{"sleep", "2147483647"},
+					SecurityContext: chown,
+					Resources:       resources,
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "storage",
+							MountPath: volumePath,
+						},
+					},
+				},
+			},
+			// A pod that stopped is replaced before the next file operation.
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: &[]int64{0}[0],
+		},
+	}
+
+	if node != "" {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchFields: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "metadata.name",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{node},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return pod, nil
+}
+
+// isCurrentFilesPod returns true if the helper pod mounts the volume as read-only
+// as well and has a container to change the owner of files, which pods created
+// by older versions do not.
+func isCurrentFilesPod(pod *corev1.Pod) bool {
+	var mount, chown bool
+	for _, c := range pod.Spec.Containers {
+		if c.Name == "chown" {
+			chown = true
+		}
+		for _, m := range c.VolumeMounts {
+			if m.MountPath == readOnlyVolumePath && m.ReadOnly {
+				mount = true
+			}
+		}
+	}
+	return mount && chown
+}
+
+// pathError wraps an error returned by a file operation so that it matches the
+// errors returned by the os package for the same operation.
+func pathError(op string, p string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrExist) || errors.Is(err, syscall.EISDIR) {
+		return &os.PathError{Op: op, Path: p, Err: err}
+	}
+	return err
+}
+
+// parseFileInfo parses a single line of file information returned by the helper
+// pod into a Stat.
+func parseFileInfo(line string) (filesystem.Stat, error) {
+	parts := strings.Split(line, " ")
+	if len(parts) != 6 {
+		return filesystem.Stat{}, errors.Errorf("environment/kubernetes: malformed file information: %q", line)
+	}
+	size, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return filesystem.Stat{}, errors.WithStack(err)
+	}
+	mode, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return filesystem.Stat{}, errors.WithStack(err)
+	}
+	mtime, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return filesystem.Stat{}, errors.WithStack(err)
+	}
+	name, err := base64.StdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return filesystem.Stat{}, errors.WithStack(err)
+	}
+
+	st := filesystem.Stat{
+		FileInfo: &fileInfo{
+			name:  string(name),
+			size:  size,
+			mode:  fileMode(uint32(mode)),
+			mtime: time.Unix(mtime, 0),
+		},
+		Mimetype: "application/octet-stream",
+	}
+	switch {
+	case parts[5] == "-":
+		st.Mimetype = "inode/directory"
+	case strings.HasPrefix(parts[5], "f"):
+		head, err := base64.StdEncoding.DecodeString(parts[5][1:])
+		if err != nil {
+			return filesystem.Stat{}, errors.WithStack(err)
+		}
+		st.Mimetype = mimetype.Detect(head).String()
+	}
+	return st, nil
+}
+
+// fileMode converts the raw mode of a file returned by stat into an os.FileMode.
+func fileMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0o777)
+	switch m & 0o170000 {
+	case 0o040000:
+		mode |= os.ModeDir
+	case 0o120000:
+		mode |= os.ModeSymlink
+	case 0o010000:
+		mode |= os.ModeNamedPipe
+	case 0o140000:
+		mode |= os.ModeSocket
+	case 0o020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0o060000:
+		mode |= os.ModeDevice
+	}
+	if m&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// fileInfo implements os.FileInfo for files stored on a persistent volume.
+type fileInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return f.size }
+func (f *fileInfo) Mode() os.FileMode  { return f.mode }
+func (f *fileInfo) ModTime() time.Time { return f.mtime }
+func (f *fileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f *fileInfo) Sys() interface{}   { return nil }
+
+// cancelReader stops the file operation backing a reader when it is closed.
+type cancelReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Close() error {
+	r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// countingReader counts the number of bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,346 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+const (
+	GameServerGroup   = "kubectyl.io"
+	GameServerVersion = "v1alpha1"
+	GameServerKind    = "GameServer"
+)
+
+// GameServerResource is the resource used to access GameServer objects through
+// the dynamic client.
+var GameServerResource = schema.GroupVersionResource{
+	Group:    GameServerGroup,
+	Version:  GameServerVersion,
+	Resource: "gameservers",
+}
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// The phases reported in the status of a GameServer resource. These map directly
+// to the process states of the environment.
+const (
+	GameServerPhaseOffline  = "Offline"
+	GameServerPhaseStarting = "Starting"
+	GameServerPhaseRunning  = "Running"
+	GameServerPhaseStopping = "Stopping"
+)
+
+// GameServer is the custom resource representing a single server when operator
+// mode is enabled. All the objects created for a server are owned by it, except
+// for the persistent volume claim, so that removing the resource never removes
+// the data of the server. The spec is kept in line with the configuration of the
+// server by the reconciler.
+type GameServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GameServerSpec   `json:"spec"`
+	Status GameServerStatus `json:"status,omitempty"`
+}
+
+// GameServerSpec holds the desired state of the server process.
+type GameServerSpec struct {
+	Image       string                  `json:"image"`
+	Limits      environment.Limits      `json:"limits"`
+	Allocations environment.Allocations `json:"allocations"`
+	Env         []corev1.EnvVar         `json:"env,omitempty"`
+	Mounts      []environment.Mount     `json:"mounts,omitempty"`
+}
+
+// GameServerStatus holds the observed state of the server process.
+type GameServerStatus struct {
+	Phase     string   `json:"phase,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	ExitCode  *int32   `json:"exitCode,omitempty"`
+	OOMKilled bool     `json:"oomKilled,omitempty"`
+}
+
+// EnsureGameServerDefinition creates the GameServer CustomResourceDefinition in
+// the cluster if it does not already exist.
+func EnsureGameServerDefinition(ctx context.Context) error {
+	c, _, err := environment.Cluster()
+	if err != nil {
+		return err
+	}
+	client, err := dynamic.NewForConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to create dynamic client")
+	}
+
+	preserve := map[string]interface{}{
+		"type":                                 "object",
+		"x-kubernetes-preserve-unknown-fields": true,
+	}
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name": GameServerResource.Resource + "." + GameServerGroup,
+		},
+		"spec": map[string]interface{}{
+			"group": GameServerGroup,
+			"scope": "Namespaced",
+			"names": map[string]interface{}{
+				"plural":     GameServerResource.Resource,
+				"singular":   "gameserver",
+				"kind":       GameServerKind,
+				"listKind":   GameServerKind + "List",
+				"shortNames": []interface{}{"gs"},
+			},
+			"versions": []interface{}{
+				map[string]interface{}{
+					"name":    GameServerVersion,
+					"served":  true,
+					"storage": true,
+					"schema": map[string]interface{}{
+						"openAPIV3Schema": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"spec":   preserve,
+								"status": preserve,
+							},
+						},
+					},
+					"subresources": map[string]interface{}{
+						"status": map[string]interface{}{},
+					},
+					"additionalPrinterColumns": []interface{}{
+						map[string]interface{}{"name": "Phase", "type": "string", "jsonPath": ".status.phase"},
+						map[string]interface{}{"name": "Image", "type": "string", "jsonPath": ".spec.image"},
+						map[string]interface{}{"name": "Exit Code", "type": "integer", "jsonPath": ".status.exitCode"},
+						map[string]interface{}{"name": "Age", "type": "date", "jsonPath": ".metadata.creationTimestamp"},
+					},
+				},
+			},
+		},
+	}}
+
+	if _, err := client.Resource(crdResource).Create(ctx, crd, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to create gameserver resource definition")
+	}
+	return nil
+}
+
+// OwnerReferences returns the owner references that should be attached to every
+// object created for this server, except for its persistent volume claim. Outside
+// of operator mode this returns nothing, otherwise the GameServer resource is
+// created or updated to match the current configuration of the server and a
+// reference to it is returned. Callers creating several objects resolve these
+// once and pass them along.
+func (e *Environment) OwnerReferences(ctx context.Context) ([]metav1.OwnerReference, error) {
+	if !config.Get().Cluster.Operator.Enabled {
+		return nil, nil
+	}
+
+	gs, _, err := e.ensureGameServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []metav1.OwnerReference{{
+		APIVersion:         gs.GetAPIVersion(),
+		Kind:               gs.GetKind(),
+		Name:               gs.GetName(),
+		UID:                gs.GetUID(),
+		Controller:         &[]bool{true}[0],
+		BlockOwnerDeletion: &[]bool{true}[0],
+	}}, nil
+}
+
+// SyncGameServer recreates the GameServer resource of the server if it was
+// removed, and reverts any change made to its spec in the cluster. The first
+// return value reports if the resource had to be changed.
+func (e *Environment) SyncGameServer(ctx context.Context) (bool, error) {
+	if !config.Get().Cluster.Operator.Enabled {
+		return false, nil
+	}
+	_, changed, err := e.ensureGameServer(ctx)
+	return changed, err
+}
+
+// ensureGameServer creates the GameServer resource for this environment, or
+// updates the spec of the existing resource if it differs.
+func (e *Environment) ensureGameServer(ctx context.Context) (*unstructured.Unstructured, bool, error) {
+	e.mu.RLock()
+	image := e.meta.Image
+	e.mu.RUnlock()
+
+	gs := GameServer{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       GameServerKind,
+			APIVersion: GameServerGroup + "/" + GameServerVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   e.Id,
+			Labels: environment.ObjectLabels(e.Id),
+		},
+		Spec: GameServerSpec{
+			Image:       image,
+			Limits:      e.Configuration.Limits(),
+			Allocations: e.Configuration.Allocations(),
+			Env:         e.envVars(),
+			Mounts:      e.Configuration.Mounts(),
+		},
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&gs)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	// The status is only ever written through the status subresource.
+	delete(obj, "status")
+	u := &unstructured.Unstructured{Object: obj}
+
+	client := e.dynamic.Resource(GameServerResource).Namespace(config.Get().Cluster.Namespace)
+	existing, err := client.Get(ctx, e.Id, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, false, errors.Wrap(err, "environment/kubernetes: failed to get gameserver")
+		}
+		created, err := client.Create(ctx, u, metav1.CreateOptions{})
+		if err != nil {
+			return nil, false, errors.Wrap(err, "environment/kubernetes: failed to create gameserver")
+		}
+		return created, true, nil
+	}
+
+	if equality.Semantic.DeepEqual(existing.Object["spec"], u.Object["spec"]) && equality.Semantic.DeepEqual(existing.GetLabels(), u.GetLabels()) {
+		return existing, false, nil
+	}
+	u.SetResourceVersion(existing.GetResourceVersion())
+	updated, err := client.Update(ctx, u, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, false, errors.Wrap(err, "environment/kubernetes: failed to update gameserver")
+	}
+	return updated, true, nil
+}
+
+// withoutServerOwners removes the references to the objects Kuber creates for a
+// server from the owners of an object.
+func withoutServerOwners(refs []metav1.OwnerReference) []metav1.OwnerReference {
+	var out []metav1.OwnerReference
+	for _, ref := range refs {
+		if ref.Kind == GameServerKind || ref.Kind == "StatefulSet" {
+			continue
+		}
+		out = append(out, ref)
+	}
+	return out
+}
+
+// syncGameServerStatus writes the current state of the environment to the status
+// of the GameServer resource. Updates are serialized so that the last state of
+// the environment is always the one that ends up being written.
+func (e *Environment) syncGameServerStatus() {
+	e.statusMu.Lock()
+	defer e.statusMu.Unlock()
+
+	ctx := context.Background()
+	ns := config.Get().Cluster.Namespace
+
+	status := GameServerStatus{Phase: gameServerPhase(e.State())}
+	if svc, err := e.client.CoreV1().Services(ns).Get(ctx, "svc-"+e.Id, metav1.GetOptions{}); err == nil {
+		status.Addresses = serviceAddresses(svc)
+	}
+	if status.Phase == GameServerPhaseOffline {
+		if pod, err := e.client.CoreV1().Pods(ns).Get(ctx, e.PodName(), metav1.GetOptions{}); err == nil {
+			for _, cs := range pod.Status.ContainerStatuses {
+				if cs.Name == "process" && cs.State.Terminated != nil {
+					status.ExitCode = &cs.State.Terminated.ExitCode
+					status.OOMKilled = cs.State.Terminated.Reason == "OOMKilled"
+				}
+			}
+		}
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return
+	}
+	if _, err := e.dynamic.Resource(GameServerResource).Namespace(ns).Patch(ctx, e.Id, types.MergePatchType, b, metav1.PatchOptions{}, "status"); err != nil && !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to update gameserver status")
+	}
+}
+
+// deleteGameServer removes the GameServer resource, and with it every object
+// that is owned by it.
+func (e *Environment) deleteGameServer(ctx context.Context) error {
+	policy := metav1.DeletePropagationForeground
+	err := e.dynamic.Resource(GameServerResource).Namespace(config.Get().Cluster.Namespace).Delete(ctx, e.Id, metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to delete gameserver")
+	}
+	return nil
+}
+
+// envVars returns the environment variables for the server process, skipping
+// over any variable that does not have a value.
+func (e *Environment) envVars() []corev1.EnvVar {
+	var out []corev1.EnvVar
+	for _, k := range e.Configuration.EnvironmentVariables() {
+		a := strings.SplitN(k, "=", 2)
+
+		// If a variable is empty, skip it
+		if len(a) == 2 && a[0] != "" && a[1] != "" {
+			out = append(out, corev1.EnvVar{Name: a[0], Value: a[1]})
+		}
+	}
+	return out
+}
+
+func gameServerPhase(state string) string {
+	switch state {
+	case environment.ProcessStartingState:
+		return GameServerPhaseStarting
+	case environment.ProcessRunningState:
+		return GameServerPhaseRunning
+	case environment.ProcessStoppingState:
+		return GameServerPhaseStopping
+	default:
+		return GameServerPhaseOffline
+	}
+}
+
+// serviceAddresses returns all the addresses a service can be reached at.
+func serviceAddresses(svc *corev1.Service) []string {
+	var out []string
+	for _, ip := range svc.Spec.ClusterIPs {
+		if ip != "" && ip != corev1.ClusterIPNone {
+			out = append(out, ip)
+		}
+	}
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if ing.IP != "" {
+			out = append(out, ing.IP)
+		}
+		if ing.Hostname != "" {
+			out = append(out, ing.Hostname)
+		}
+	}
+	out = append(out, svc.Spec.ExternalIPs...)
+	return out
+}
@@ -0,0 +1,156 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/remote"
+)
+
+// The values used for a health check when they are not defined by it.
+const (
+	defaultHealthInterval       = 10
+	defaultHealthTimeout        = 5
+	defaultHealthFailures       = 3
+	defaultHealthStartupTimeout = 300
+)
+
+// probes returns the startup, readiness and liveness probes for the server
+// process. The startup probe holds off the other probes until the process has
+// become healthy for the first time, so slow starting servers are not killed
+// while booting. Nothing is returned if no health check is configured.
+func (e *Environment) probes() (startup *corev1.Probe, readiness *corev1.Probe, liveness *corev1.Probe) {
+	e.mu.RLock()
+	hc := e.meta.HealthCheck
+	e.mu.RUnlock()
+
+	if hc == nil || hc.Type == "" {
+		return nil, nil, nil
+	}
+
+	handler, err := e.probeHandler(hc)
+	if err != nil {
+		e.log().WithField("error", err).Warn("ignoring invalid health check for server")
+		return nil, nil, nil
+	}
+
+	interval := valueOr(hc.Interval, defaultHealthInterval)
+	timeout := valueOr(hc.Timeout, defaultHealthTimeout)
+	failures := valueOr(hc.Failures, defaultHealthFailures)
+	// Round up, the process always gets at least the configured amount of time to start.
+	attempts := (valueOr(hc.StartupTimeout, defaultHealthStartupTimeout) + interval - 1) / interval
+
+	probe := func(failures int) *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    int32(interval),
+			TimeoutSeconds:   int32(timeout),
+			FailureThreshold: int32(failures),
+		}
+	}
+
+	return probe(attempts), probe(failures), probe(failures)
+}
+
+// probeHandler returns the action performed by the cluster to check the health
+// of the server process.
+func (e *Environment) probeHandler(hc *remote.HealthCheck) (corev1.ProbeHandler, error) {
+	port := hc.Port
+	if port == 0 {
+		port = e.Configuration.Allocations().DefaultPort
+	}
+
+	switch hc.Type {
+	case "tcp":
+		return corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(port)},
+		}, nil
+	case "udp":
+		// Kubernetes is not able to probe UDP ports, so the payload is sent from within the
+		// container through the /dev/udp device of bash, waiting for the first byte of any
+		// response to arrive. This requires the image of the server to provide bash.
+		payload, err := hex.DecodeString(hc.Payload)
+		if err != nil {
+			return corev1.ProbeHandler{}, errors.Wrap(err, "environment/kubernetes: invalid udp health check payload")
+		}
+		var b strings.Builder
+		for _, c := range payload {
+			fmt.Fprintf(&b, "\\x%02x", c)
+		}
+		timeout := valueOr(hc.Timeout, defaultHealthTimeout)
+		script := fmt.Sprintf("exec 3<>/dev/udp/127.0.0.1/%d && printf '%s' >&3 && read -r -t %d -N 1 -u 3 _", port, b.String(), timeout)
+		return corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"bash", "-c", script}},
+		}, nil
+	case "exec":
+		if hc.Command == "" {
+			return corev1.ProbeHandler{}, errors.New("environment/kubernetes: exec health check is missing a command")
+		}
+		return corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"sh", "-c", hc.Command}},
+		}, nil
+	default:
+		return corev1.ProbeHandler{}, errors.Errorf("environment/kubernetes: unknown health check type \"%s\"", hc.Type)
+	}
+}
+
+// ExitReason returns the reason the server process was stopped by the cluster.
+// Evictions and preemptions are recorded on the pod itself, but the kubelet does
+// not record why it killed a container in the status of the container, so the
+// events of the pod are inspected for failed health checks instead.
+func (e *Environment) ExitReason() (string, error) {
+	ctx := context.Background()
+	ns := config.Get().Cluster.Namespace
+
+	pod, err := e.client.CoreV1().Pods(ns).Get(ctx, e.PodName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			if ex := e.lastExit(); ex != nil {
+				return ex.reason, nil
+			}
+			return "", nil
+		}
+		return "", errors.Wrap(err, "environment/kubernetes: failed to inspect container")
+	}
+
+	if reason := evictionReason(pod); reason != "" {
+		return reason, nil
+	}
+	if reason := e.preemptionReason(ctx, pod); reason != "" {
+		return reason, nil
+	}
+
+	if len(pod.Spec.Containers) > 0 && pod.Spec.Containers[0].LivenessProbe != nil {
+		selector := fields.Set{"involvedObject.uid": string(pod.UID), "reason": "Killing"}
+		events, err := e.client.CoreV1().Events(ns).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+		if err != nil {
+			return "", errors.Wrap(err, "environment/kubernetes: failed to list pod events")
+		}
+		for _, ev := range events.Items {
+			if strings.Contains(ev.Message, "failed liveness probe") {
+				return environment.ExitReasonLivenessProbe, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// valueOr returns v if it is set, otherwise the fallback value.
+func valueOr(v int, fallback int) int {
+	if v <= 0 {
+		return fallback
+	}
+	return v
+}
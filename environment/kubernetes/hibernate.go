@@ -0,0 +1,196 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/internal/hibernate"
+)
+
+// ErrNotHibernating is returned when waiting for a server to be woken up while
+// it is not hibernating.
+var ErrNotHibernating = errors.Sentinel("environment/kubernetes: server is not hibernating")
+
+// hibernationPodName returns the name of the pod answering on the ports of the
+// server while it is hibernating.
+func (e *Environment) hibernationPodName() string {
+	return e.Id + "-hibernate"
+}
+
+// Hibernate replaces the stopped server process with a pod that answers on the
+// ports of the server, and points the service of the server at it. The volume
+// and service of the server are kept as they are.
+func (e *Environment) Hibernate(ctx context.Context, protocol string) error {
+	cfg := config.Get()
+
+	args := []string{"/usr/bin/kuber", "hibernate", "--message", cfg.Cluster.Hibernation.Message}
+	if protocol != "" {
+		args = append(args, "--protocol", protocol)
+	}
+	ports := e.ports()
+	for _, p := range ports {
+		args = append(args, "--port", strings.ToLower(string(p.Protocol))+":"+strconv.Itoa(int(p.ContainerPort)))
+	}
+
+	labels := environment.ObjectLabels(e.Id)
+	labels["ContainerType"] = "server_hibernated"
+
+	refs, err := e.OwnerReferences(ctx)
+	if err != nil {
+		return err
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            e.hibernationPodName(),
+			Labels:          labels,
+			OwnerReferences: refs,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "hibernate",
+					Image:   config.KuberImage(cfg.Cluster.Hibernation.Image),
+					Command: args,
+					Ports:   ports,
+					SecurityContext: &corev1.SecurityContext{
+						RunAsUser:  &[]int64{int64(cfg.System.User.Uid)}[0],
+						RunAsGroup: &[]int64{int64(cfg.System.User.Gid)}[0],
+					},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("100m"),
+							corev1.ResourceMemory: resource.MustParse("64Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("10m"),
+							corev1.ResourceMemory: resource.MustParse("16Mi"),
+						},
+					},
+				},
+			},
+			RestartPolicy:     corev1.RestartPolicyAlways,
+			PriorityClassName: cfg.Cluster.Priorities.ForLabels(e.Configuration.Labels()).Name,
+		},
+	}
+
+	if _, err := e.client.CoreV1().Pods(cfg.Cluster.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to create hibernation pod")
+	}
+
+	return e.selectService(ctx, "server_hibernated")
+}
+
+// Hibernating reports if the server is currently hibernating.
+func (e *Environment) Hibernating(ctx context.Context) (bool, error) {
+	_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.hibernationPodName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "environment/kubernetes: failed to inspect hibernation pod")
+	}
+	return true, nil
+}
+
+// WaitForWake blocks until a client connects to the hibernating server. If the
+// server stops hibernating in the meantime ErrNotHibernating is returned.
+func (e *Environment) WaitForWake(ctx context.Context) error {
+	pods := e.client.CoreV1().Pods(config.Get().Cluster.Namespace)
+	for {
+		pod, err := pods.Get(ctx, e.hibernationPodName(), metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return ErrNotHibernating
+			}
+			return errors.Wrap(err, "environment/kubernetes: failed to inspect hibernation pod")
+		}
+
+		if pod.Status.Phase == corev1.PodRunning {
+			woken, err := e.followHibernation(ctx)
+			if err != nil {
+				e.log().WithField("error", err).Debug("failed to follow output of hibernation pod")
+			}
+			if woken {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * 2):
+		}
+	}
+}
+
+// followHibernation follows the output of the hibernation pod, reporting if it
+// saw a client connect before the output ended.
+func (e *Environment) followHibernation(ctx context.Context) (bool, error) {
+	stream, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).GetLogs(e.hibernationPodName(), &corev1.PodLogOptions{Follow: true}).Stream(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == hibernate.WakeMessage {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// EndHibernation points the service back at the server process and removes the
+// hibernation pod, if there is one.
+func (e *Environment) EndHibernation(ctx context.Context) {
+	hibernating, err := e.Hibernating(ctx)
+	if err != nil || !hibernating {
+		return
+	}
+	if err := e.selectService(ctx, "server_process"); err != nil {
+		e.log().WithField("error", err).Warn("failed to point service back at server process")
+		return
+	}
+	err = e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, e.hibernationPodName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to remove hibernation pod")
+	}
+}
+
+// selectService points the services of the server at the pods of the server
+// with the given container type.
+func (e *Environment) selectService(ctx context.Context, containerType string) error {
+	services := e.client.CoreV1().Services(config.Get().Cluster.Namespace)
+	for i, name := range e.serviceNames() {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			svc, err := services.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if svc.Spec.Selector["ContainerType"] == containerType {
+				return nil
+			}
+			svc.Spec.Selector["ContainerType"] = containerType
+			_, err = services.Update(ctx, svc, metav1.UpdateOptions{})
+			return err
+		})
+		// Only the first service always exists, the service for IPv6 is optional.
+		if err != nil && (i == 0 || !apierrors.IsNotFound(err)) {
+			return errors.Wrap(err, "environment/kubernetes: failed to update service selector")
+		}
+	}
+	return nil
+}
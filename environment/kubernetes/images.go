@@ -0,0 +1,35 @@
+package kubernetes
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubectyl/kuber/config"
+)
+
+// PullPolicy returns the pull policy to use for the image of a server.
+func PullPolicy(image string) corev1.PullPolicy {
+	// An image pinned to a digest never changes, so there is no need to check the
+	// registry for a newer version of it.
+	pinned := strings.Contains(image, "@")
+
+	cfg := config.Get().Cluster.Images
+	switch cfg.PullPolicy {
+	case config.PullPolicyIfNotPresent:
+		return corev1.PullIfNotPresent
+	case config.PullPolicyAlways:
+		return corev1.PullAlways
+	case config.PullPolicyDigest:
+		if pinned {
+			return corev1.PullIfNotPresent
+		}
+		return corev1.PullAlways
+	}
+	// Pre-pulled images are already on the node, pulling them again would make servers
+	// depend on the registry once more.
+	if pinned || cfg.PrePull.Enabled {
+		return corev1.PullIfNotPresent
+	}
+	return corev1.PullAlways
+}
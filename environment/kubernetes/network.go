@@ -0,0 +1,339 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// configureNetwork sets the name resolution of the pod, and runs it in the
+// network namespace of its node if the server opted in to it. The ports of the
+// server are then bound on the node directly.
+func (e *Environment) configureNetwork(pod *corev1.Pod) {
+	e.mu.RLock()
+	dns, host := e.meta.Dns, e.meta.HostNetwork
+	e.mu.RUnlock()
+
+	pod.Spec.DNSPolicy, pod.Spec.DNSConfig = dnsPolicy(dns, host)
+	if !host {
+		return
+	}
+
+	pod.Spec.HostNetwork = true
+	// The scheduler keeps the pod off nodes where another pod already binds one of
+	// these ports on the node.
+	ports := pod.Spec.Containers[0].Ports
+	for i := range ports {
+		ports[i].HostPort = ports[i].ContainerPort
+	}
+}
+
+// checkHostPorts returns an error naming the servers that already bind the ports
+// of the pod on every node it is able to run on. The scheduler keeps the pod off
+// nodes where only some of them are used, but a pod that fits on no node would
+// otherwise remain pending without explaining why.
+func checkHostPorts(ctx context.Context, client kubernetes.Interface, namespace string, id string, pod *corev1.Pod) error {
+	type binding struct {
+		port     int32
+		protocol corev1.Protocol
+	}
+	wanted := make(map[binding]bool)
+	for _, p := range pod.Spec.Containers[0].Ports {
+		if p.HostPort != 0 {
+			wanted[binding{p.HostPort, p.Protocol}] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "ContainerType=server_process",
+	})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to list server pods")
+	}
+	conflicts := make(map[string]string)
+	for _, p := range pods.Items {
+		if !p.Spec.HostNetwork || p.Spec.NodeName == "" || p.Labels[environment.ServerLabel] == id {
+			continue
+		}
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, c := range p.Spec.Containers {
+			for _, cp := range c.Ports {
+				if _, ok := conflicts[p.Spec.NodeName]; ok || !wanted[binding{cp.ContainerPort, cp.Protocol}] {
+					continue
+				}
+				conflicts[p.Spec.NodeName] = fmt.Sprintf("port %d/%s is used by server %s on node %s", cp.ContainerPort, cp.Protocol, p.Labels[environment.ServerLabel], p.Spec.NodeName)
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(pod.Spec.NodeSelector).String(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to list nodes")
+	}
+	var reasons []string
+	for _, n := range nodes.Items {
+		if n.Spec.Unschedulable {
+			continue
+		}
+		reason, ok := conflicts[n.Name]
+		if !ok {
+			return nil
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	sort.Strings(reasons)
+	return errors.Errorf("environment/kubernetes: no node has the ports of the server available: %s", strings.Join(reasons, "; "))
+}
+
+// dnsPolicy returns the DNS policy and configuration of a pod. The nameservers
+// are only used with the "none" policy, the other policies resolve names through
+// the cluster or the node.
+func dnsPolicy(dns config.DnsConfiguration, hostNetwork bool) (corev1.DNSPolicy, *corev1.PodDNSConfig) {
+	cfg := &corev1.PodDNSConfig{Searches: dns.Searches}
+	switch strings.ToLower(dns.Policy) {
+	case "clusterfirst":
+		// Pods on the network of the node fall back to the resolver of the node unless the
+		// dedicated policy is used.
+		if hostNetwork {
+			return corev1.DNSClusterFirstWithHostNet, cfg
+		}
+		return corev1.DNSClusterFirst, cfg
+	case "default":
+		return corev1.DNSDefault, cfg
+	}
+	cfg.Nameservers = dns.Nameservers
+	return corev1.DNSNone, cfg
+}
+
+// serviceNames returns the names of the services of the server, the second one
+// only exists when the server has separate allocations for IPv6.
+func (e *Environment) serviceNames() []string {
+	return []string{"svc-" + e.Id, "svc-" + e.Id + "-ipv6"}
+}
+
+// applyIPFamilies sets the IP families of the service. A server with separate
+// allocations for IPv6 gets a second service for those, so the service of the
+// regular allocations only uses IPv4.
+func (e *Environment) applyIPFamilies(svc *corev1.Service, a environment.Allocations) {
+	if a.IPv6 != nil {
+		policy := corev1.IPFamilyPolicySingleStack
+		svc.Spec.IPFamilyPolicy = &policy
+		svc.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol}
+		return
+	}
+
+	e.mu.RLock()
+	f := e.meta.IPFamilies
+	e.mu.RUnlock()
+
+	for _, p := range []corev1.IPFamilyPolicy{corev1.IPFamilyPolicySingleStack, corev1.IPFamilyPolicyPreferDualStack, corev1.IPFamilyPolicyRequireDualStack} {
+		if strings.EqualFold(f.Policy, string(p)) {
+			policy := p
+			svc.Spec.IPFamilyPolicy = &policy
+		}
+	}
+	for _, family := range f.Families {
+		for _, v := range []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol} {
+			if strings.EqualFold(family, string(v)) {
+				svc.Spec.IPFamilies = append(svc.Spec.IPFamilies, v)
+			}
+		}
+	}
+}
+
+// sameIPFamilies reports if the service uses the IP families of the desired
+// service. Those left unset on the desired service are chosen by the cluster,
+// so any value is accepted for them.
+func sameIPFamilies(svc *corev1.Service, desired *corev1.Service) bool {
+	if desired.Spec.IPFamilyPolicy != nil && (svc.Spec.IPFamilyPolicy == nil || *svc.Spec.IPFamilyPolicy != *desired.Spec.IPFamilyPolicy) {
+		return false
+	}
+	if len(desired.Spec.IPFamilies) > len(svc.Spec.IPFamilies) {
+		return false
+	}
+	for i, f := range desired.Spec.IPFamilies {
+		if svc.Spec.IPFamilies[i] != f {
+			return false
+		}
+	}
+	return true
+}
+
+// ipv6Service returns the service exposing the separate IPv6 allocations of the
+// server, or nil if it has none. The ports are mapped onto the regular ports of
+// the server in order, ports beyond those are passed through as they are.
+func (e *Environment) ipv6Service() *corev1.Service {
+	a := e.Configuration.Allocations()
+	if a.IPv6 == nil {
+		return nil
+	}
+
+	svc := e.service()
+	svc.Name = e.serviceNames()[1]
+	policy := corev1.IPFamilyPolicySingleStack
+	svc.Spec.IPFamilyPolicy = &policy
+	svc.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv6Protocol}
+	svc.Spec.Ports = nil
+
+	targets := append([]string{strconv.Itoa(a.DefaultPort)}, a.AdditionalPorts...)
+	for i, v := range append([]string{strconv.Itoa(a.IPv6.DefaultPort)}, a.IPv6.AdditionalPorts...) {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			continue
+		}
+		target := port
+		if i < len(targets) {
+			if t, err := strconv.Atoi(targets[i]); err == nil && t > 0 {
+				target = t
+			}
+		}
+		for _, protocol := range []corev1.Protocol{corev1.ProtocolTCP, corev1.ProtocolUDP} {
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+				Name:       strings.ToLower(string(protocol)) + v,
+				Protocol:   protocol,
+				Port:       int32(port),
+				TargetPort: intstr.FromInt(target),
+			})
+		}
+	}
+	return svc
+}
+
+// Addresses returns the addresses the server is reachable at from outside of the
+// cluster, which are the addresses of its load balancers, or those of the node
+// running the server when its ports are bound on the node. The addresses of
+// services only reachable within the cluster are never returned. They are
+// looked up in the background at most every 30 seconds, so that the API
+// responses listing every server do not wait on the cluster. Nothing is
+// returned until the first lookup finished.
+func (e *Environment) Addresses() *environment.Addresses {
+	e.mu.RLock()
+	a, at := e.addresses, e.addressesAt
+	e.mu.RUnlock()
+
+	if time.Since(at) > time.Second*30 && e.addressesLookup.SwapIf(true) {
+		go e.lookupAddresses()
+	}
+	return a
+}
+
+func (e *Environment) lookupAddresses() {
+	defer e.addressesLookup.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	list, err := e.client.CoreV1().Services(config.Get().Cluster.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(environment.ObjectLabels(e.Id)).String(),
+	})
+	if err != nil {
+		e.log().WithField("error", err).Warn("failed to look up addresses of server")
+		return
+	}
+
+	var values []string
+	var nodePorts bool
+	for _, svc := range list.Items {
+		switch svc.Spec.Type {
+		case corev1.ServiceTypeLoadBalancer:
+			for _, ing := range svc.Status.LoadBalancer.Ingress {
+				values = append(values, ing.IP, ing.Hostname)
+			}
+		case corev1.ServiceTypeNodePort:
+			nodePorts = true
+		}
+		values = append(values, svc.Spec.ExternalIPs...)
+	}
+
+	e.mu.RLock()
+	host := e.meta.HostNetwork
+	e.mu.RUnlock()
+	if nodePorts || host {
+		v, err := e.nodeAddresses(ctx)
+		if err != nil {
+			e.log().WithField("error", err).Warn("failed to look up node addresses of server")
+			return
+		}
+		values = append(values, v...)
+	}
+
+	a := &environment.Addresses{IPv4: []string{}, IPv6: []string{}}
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		ip := net.ParseIP(v)
+		switch {
+		case ip == nil:
+			a.Hostnames = append(a.Hostnames, v)
+		case ip.To4() != nil:
+			a.IPv4 = append(a.IPv4, v)
+		default:
+			a.IPv6 = append(a.IPv6, v)
+		}
+	}
+
+	e.mu.Lock()
+	e.addresses, e.addressesAt = a, time.Now()
+	e.mu.Unlock()
+}
+
+// nodeAddresses returns the external addresses of the node running the server,
+// falling back to its internal addresses if it has none. Nothing is returned
+// while the server is not scheduled onto a node.
+func (e *Environment) nodeAddresses(ctx context.Context) ([]string, error) {
+	pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || (err == nil && pod.Spec.NodeName == "") {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	node, err := e.client.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var external, internal []string
+	for _, addr := range node.Status.Addresses {
+		switch addr.Type {
+		case corev1.NodeExternalIP, corev1.NodeExternalDNS:
+			external = append(external, addr.Address)
+		case corev1.NodeInternalIP:
+			internal = append(internal, addr.Address)
+		}
+	}
+	if len(external) > 0 {
+		return external, nil
+	}
+	return internal, nil
+}
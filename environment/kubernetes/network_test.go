@@ -0,0 +1,73 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubectyl/kuber/environment"
+)
+
+func TestCheckHostPorts(t *testing.T) {
+	g := Goblin(t)
+	ctx := context.Background()
+
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	server := func(id string, node string, port int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      id,
+				Namespace: "default",
+				Labels:    map[string]string{environment.ServerLabel: id, "ContainerType": "server_process"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName:    node,
+				HostNetwork: true,
+				Containers: []corev1.Container{{
+					Ports: []corev1.ContainerPort{{ContainerPort: port, HostPort: port, Protocol: corev1.ProtocolTCP}},
+				}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+
+	g.Describe("checkHostPorts", func() {
+		g.It("allows pods when a node has the ports available", func() {
+			client := fake.NewSimpleClientset(node("a"), node("b"), server("other", "a", 25565))
+
+			err := checkHostPorts(ctx, client, "default", "self", server("self", "", 25565))
+			g.Assert(err).IsNil()
+		})
+
+		g.It("ignores the pods of the server itself", func() {
+			client := fake.NewSimpleClientset(node("a"), server("self", "a", 25565))
+
+			err := checkHostPorts(ctx, client, "default", "self", server("self", "", 25565))
+			g.Assert(err).IsNil()
+		})
+
+		g.It("names the conflicting server when every node uses the ports", func() {
+			client := fake.NewSimpleClientset(node("a"), server("other", "a", 25565))
+
+			err := checkHostPorts(ctx, client, "default", "self", server("self", "", 25565))
+			g.Assert(err == nil).IsFalse()
+			g.Assert(strings.Contains(err.Error(), "port 25565/TCP is used by server other on node a")).IsTrue()
+		})
+
+		g.It("ignores nodes that are not schedulable", func() {
+			cordoned := node("b")
+			cordoned.Spec.Unschedulable = true
+			client := fake.NewSimpleClientset(node("a"), cordoned, server("other", "a", 25565))
+
+			err := checkHostPorts(ctx, client, "default", "self", server("self", "", 25565))
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
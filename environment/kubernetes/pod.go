@@ -3,6 +3,7 @@ package kubernetes
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"strconv"
@@ -11,18 +12,19 @@ import (
 	"emperror.dev/errors"
 	"github.com/apex/log"
 	"github.com/docker/docker/api/types/mount"
-	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
 
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/internal/supervisor"
 	"github.com/kubectyl/kuber/system"
 
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 var ErrNotAttached = errors.Sentinel("not attached to instance")
@@ -48,6 +50,13 @@ func (nw noopWriter) Write(b []byte) (int, error) {
 // for the purposes of attaching to the container, a second context is created
 // within the function for managing polling.
 func (e *Environment) Attach(ctx context.Context) error {
+	return e.attach(ctx, false)
+}
+
+// attach follows the output of the server process. If newOnly is set only output
+// written from now on is followed, which is used when the process is restarted
+// within its existing pod so that the output of previous runs is not replayed.
+func (e *Environment) attach(ctx context.Context, newOnly bool) error {
 	// if e.IsAttached() {
 	// 	return nil
 	// }
@@ -67,14 +76,33 @@ func (e *Environment) Attach(ctx context.Context) error {
 	// 	e.SetStream(&st)
 	// }
 
+	opts := &corev1.PodLogOptions{
+		Container: "process",
+		Follow:    true,
+	}
+	if newOnly {
+		opts.TailLines = &[]int64{0}[0]
+	}
+
+	// The output of a supervised process continues after the process exited, so the
+	// stream is closed once the exit of the process is marked in the output.
+	streamCtx, closeStream := context.WithCancel(context.Background())
+	podLogs, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).GetLogs(e.PodName(), opts).Stream(streamCtx)
+	if err != nil {
+		closeStream()
+		return errors.Wrap(err, "environment/kubernetes: failed to follow output of server process")
+	}
+
 	go func() {
 		// Don't use the context provided to the function, that'll cause the polling to
 		// exit unexpectedly. We want a custom context for this, the one passed to the
 		// function is to avoid a hang situation when trying to attach to a container.
 		pollCtx, cancel := context.WithCancel(context.Background())
 		defer cancel()
+		defer closeStream()
 		// defer e.stream.Close()
 		defer func() {
+			e.releaseSidecars()
 			e.SetState(environment.ProcessOfflineState)
 			// e.SetStream(nil)
 		}()
@@ -89,20 +117,23 @@ func (e *Environment) Attach(ctx context.Context) error {
 			}
 		}()
 
-		reader := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).GetLogs(e.Id, &corev1.PodLogOptions{
-			Follow: true,
-		})
-		podLogs, err := reader.Stream(context.TODO())
-		if err != nil {
-			return
-		}
 		defer podLogs.Close()
 
+		var exited bool
 		if err := system.ScanReader(podLogs, func(v []byte) {
+			// Markers of previous runs are replayed when attaching to a running process.
+			if run, code, ok := supervisor.ParseExitMarker(v); ok {
+				if !exited && run >= e.currentRun() {
+					exited = true
+					e.supervisedExit(code)
+					closeStream()
+				}
+				return
+			}
 			e.logCallbackMx.Lock()
 			defer e.logCallbackMx.Unlock()
 			e.logCallback(v)
-		}); err != nil && err != io.EOF {
+		}); err != nil && err != io.EOF && !exited {
 			log.WithField("error", err).WithField("container_id", e.Id).Warn("error processing scanner line in console output")
 			return
 		}
@@ -153,15 +184,31 @@ func (e *Environment) Create() error {
 	// If the container already exists don't hit the user with an error, just return
 	// the current information about it which is what we would do when creating the
 	// container anyways.
-	if _, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.Id, metav1.GetOptions{}); err == nil {
+	if _, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{}); err == nil {
 		return nil
 	} else if !apierrors.IsNotFound(err) {
 		return errors.Wrap(err, "environment/docker: failed to inspect container")
 	}
 
+	pod, err := e.pod(ctx)
+	if err != nil {
+		return err
+	}
+	return e.createPod(ctx, pod)
+}
+
+// pod returns the pod running the server process, annotated with the hash of
+// its spec. The configuration files of the server are updated in the cluster
+// while building it.
+func (e *Environment) pod(ctx context.Context) (*corev1.Pod, error) {
 	cfg := config.Get()
-	a := e.Configuration.Allocations()
-	evs := e.Configuration.EnvironmentVariables()
+
+	// Every object created alongside the pod is owned by the same resource, which is only
+	// resolved once here and passed down through the pod.
+	refs, err := e.OwnerReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Merge user-provided labels with system labels
 	confLabels := e.Configuration.Labels()
@@ -170,11 +217,13 @@ func (e *Environment) Create() error {
 	for key := range confLabels {
 		labels[key] = confLabels[key]
 	}
-	labels["uuid"] = e.Id
+	labels[environment.ServerLabel] = e.Id
+	labels[environment.NodeLabel] = cfg.Uuid
 	labels["Service"] = "Pterodactyl"
 	labels["ContainerType"] = "server_process"
-
-	resources := e.Configuration.Limits()
+	// The owner always overrides the label of the server, so that it cannot be used to
+	// join the network group of another user.
+	labels[NetworkOwnerLabel] = e.privateNetwork().Owner
 
 	pod := &corev1.Pod{
 		TypeMeta: metav1.TypeMeta{
@@ -182,24 +231,34 @@ func (e *Environment) Create() error {
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   e.Id,
-			Labels: labels,
+			Name:            e.PodName(),
+			Labels:          labels,
+			Annotations:     e.limitAnnotations(),
+			OwnerReferences: refs,
 		},
 		Spec: corev1.PodSpec{
-			DNSPolicy: corev1.DNSPolicy("None"),
-			DNSConfig: &corev1.PodDNSConfig{Nameservers: config.Get().Cluster.Network.Dns},
-			Volumes: []corev1.Volume{
-				{
-					Name: "tmp",
-					VolumeSource: corev1.VolumeSource{
-						EmptyDir: &corev1.EmptyDirVolumeSource{
-							Medium: corev1.StorageMedium("Memory"),
-							SizeLimit: &resource.Quantity{
-								Format: resource.Format("BinarySI"),
+			// Prefer the node the files of the server are currently being accessed from, since
+			// volumes that can only be attached to a single node are already attached there.
+			Affinity: &corev1.Affinity{
+				PodAffinity: &corev1.PodAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+						{
+							Weight: 100,
+							PodAffinityTerm: corev1.PodAffinityTerm{
+								LabelSelector: &metav1.LabelSelector{
+									MatchLabels: map[string]string{
+										environment.ServerLabel: e.Id,
+										"ContainerType":         "server_files",
+									},
+								},
+								TopologyKey: "kubernetes.io/hostname",
 							},
 						},
 					},
 				},
+			},
+			Volumes: []corev1.Volume{
+				e.tmpVolume(),
 				{
 					Name: "storage",
 					VolumeSource: corev1.VolumeSource{
@@ -213,35 +272,13 @@ func (e *Environment) Create() error {
 				{
 					Name:            "process",
 					Image:           e.meta.Image,
-					ImagePullPolicy: corev1.PullAlways,
+					ImagePullPolicy: PullPolicy(e.meta.Image),
 					TTY:             true,
 					Stdin:           true,
 					WorkingDir:      "/home/container",
-					Ports: []corev1.ContainerPort{
-						{
-							ContainerPort: int32(a.DefaultPort),
-							Protocol:      corev1.Protocol("TCP"),
-						},
-						{
-							ContainerPort: int32(a.DefaultPort),
-							Protocol:      corev1.Protocol("UDP"),
-						},
-					},
-					SecurityContext: &corev1.SecurityContext{
-						RunAsNonRoot: &[]bool{false}[0],
-						RunAsUser:    &[]int64{int64(cfg.System.User.Uid)}[0],
-						RunAsGroup:   &[]int64{int64(cfg.System.User.Gid)}[0],
-					},
-					Resources: corev1.ResourceRequirements{
-						Limits: corev1.ResourceList{
-							"cpu":    *resource.NewQuantity(resources.CpuLimit/100, resource.DecimalSI),
-							"memory": *resource.NewQuantity(resources.BoundedMemoryLimit(), resource.BinarySI),
-						},
-						Requests: corev1.ResourceList{
-							"cpu":    *resource.NewQuantity(resources.CpuLimit/100, resource.DecimalSI),
-							"memory": *resource.NewQuantity(resources.BoundedMemoryLimit(), resource.BinarySI),
-						},
-					},
+					Ports:           e.ports(),
+					SecurityContext: securityContext(),
+					Resources:       e.resourceRequirements(),
 					VolumeMounts: []corev1.VolumeMount{
 						{
 							Name:      "tmp",
@@ -254,7 +291,111 @@ func (e *Environment) Create() error {
 					},
 				},
 			},
-			RestartPolicy: corev1.RestartPolicy("Never"),
+			RestartPolicy:     corev1.RestartPolicy("Never"),
+			PriorityClassName: cfg.Cluster.Priorities.ForLabels(confLabels).Name,
+		},
+	}
+
+	pod.Spec.Containers[0].Env = e.envVars()
+	private, err := e.privateEnvVars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, private...)
+
+	// Only attach the probes when a health check is configured, the pod is otherwise ready
+	// as soon as the container is running.
+	startup, readiness, liveness := e.probes()
+	pod.Spec.Containers[0].StartupProbe = startup
+	pod.Spec.Containers[0].ReadinessProbe = readiness
+	pod.Spec.Containers[0].LivenessProbe = liveness
+
+	e.configureNetwork(pod)
+
+	securityContext := pod.Spec.Containers[0].SecurityContext
+	pod.Spec.Containers = append(pod.Spec.Containers, e.sidecarContainers(securityContext)...)
+
+	if err := e.configurePod(ctx, pod, securityContext); err != nil {
+		return nil, err
+	}
+	e.supervisePod(pod)
+	// Init containers get the same resources as the server process, so that they do not
+	// change the QoS class of the pod.
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].Resources = *pod.Spec.Containers[0].Resources.DeepCopy()
+	}
+
+	hash, err := specHash(pod)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string, 1)
+	}
+	pod.Annotations[SpecHashAnnotation] = hash
+
+	return pod, nil
+}
+
+// securityContext returns the security context of the server process, which
+// runs as the configured user depending on what mode we are operating in.
+func securityContext() *corev1.SecurityContext {
+	cfg := config.Get().System.User
+	if cfg.Rootless.Enabled {
+		return &corev1.SecurityContext{
+			RunAsNonRoot: &[]bool{true}[0],
+			RunAsUser:    &[]int64{int64(cfg.Rootless.ContainerUID)}[0],
+			RunAsGroup:   &[]int64{int64(cfg.Rootless.ContainerGID)}[0],
+		}
+	}
+	return &corev1.SecurityContext{
+		RunAsNonRoot: &[]bool{false}[0],
+		RunAsUser:    &[]int64{int64(cfg.Uid)}[0],
+		RunAsGroup:   &[]int64{int64(cfg.Gid)}[0],
+	}
+}
+
+// createPod creates the pod running the server process, along with the service
+// of the server if it is missing.
+func (e *Environment) createPod(ctx context.Context, pod *corev1.Pod) error {
+	if pod.Spec.HostNetwork {
+		if err := checkHostPorts(ctx, e.client, config.Get().Cluster.Namespace, e.Id, pod); err != nil {
+			return err
+		}
+	}
+	if _, err := e.ensureServices(ctx, pod.OwnerReferences); err != nil {
+		return err
+	}
+	if err := e.ensureNetworkPolicy(ctx, pod.OwnerReferences); err != nil {
+		return err
+	}
+	// A server is still reachable through its address without the DNS records.
+	if err := e.publishDNS(ctx, pod.OwnerReferences); err != nil {
+		e.log().WithField("error", err).Warn("failed to publish dns records of server")
+	}
+
+	if statefulSets() {
+		return e.applyStatefulSet(ctx, pod)
+	}
+	if _, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to create pod")
+	}
+
+	return nil
+}
+
+// ports returns the TCP and UDP ports of all the allocations of the server.
+func (e *Environment) ports() []corev1.ContainerPort {
+	a := e.Configuration.Allocations()
+
+	ports := []corev1.ContainerPort{
+		{
+			ContainerPort: int32(a.DefaultPort),
+			Protocol:      corev1.Protocol("TCP"),
+		},
+		{
+			ContainerPort: int32(a.DefaultPort),
+			Protocol:      corev1.Protocol("UDP"),
 		},
 	}
 
@@ -262,39 +403,170 @@ func (e *Environment) Create() error {
 	for b := range a.Bindings() {
 		port, _ := strconv.ParseInt(b.Port(), 10, 64)
 		protocol := strings.ToUpper(b.Proto())
+		if int(port) == a.DefaultPort {
+			continue
+		}
 
-		pod.Spec.Containers[0].Ports = append(pod.Spec.Containers[0].Ports,
+		ports = append(ports,
 			corev1.ContainerPort{
 				ContainerPort: int32(port),
 				Protocol:      corev1.Protocol(protocol),
 			})
 	}
+	return ports
+}
 
-	for _, k := range evs {
-		a := strings.SplitN(k, "=", 2)
+// EnsureService creates the services exposing the allocations of the server if
+// they do not already exist in the cluster, and updates the ones that do. The
+// first return value reports if a service had to be created.
+func (e *Environment) EnsureService(ctx context.Context) (bool, error) {
+	refs, err := e.OwnerReferences(ctx)
+	if err != nil {
+		return false, err
+	}
+	return e.ensureServices(ctx, refs)
+}
 
-		// If a variable is empty, skip it
-		if a[0] != "" && a[1] != "" {
-			pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env,
-				corev1.EnvVar{
-					Name:  a[0],
-					Value: a[1],
-				})
+func (e *Environment) ensureServices(ctx context.Context, refs []metav1.OwnerReference) (bool, error) {
+	if err := e.checkHostname(ctx); err != nil {
+		return false, err
+	}
+	if err := e.syncServices(ctx); err != nil {
+		return false, err
+	}
+
+	created := false
+	for _, service := range e.services() {
+		service.OwnerReferences = refs
+		if _, err := e.client.CoreV1().Services(config.Get().Cluster.Namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			return created, errors.Wrap(err, "environment/kubernetes: failed to create service")
 		}
+		created = true
 	}
+	return created, nil
+}
 
-	// Set the user running the container properly depending on what mode we are operating in.
-	securityContext := pod.Spec.Containers[0].SecurityContext
-	if cfg.System.User.Rootless.Enabled {
-		securityContext.RunAsNonRoot = &[]bool{true}[0]
-		securityContext.RunAsUser = &[]int64{int64(cfg.System.User.Rootless.ContainerUID)}[0]
-		securityContext.RunAsGroup = &[]int64{int64(cfg.System.User.Rootless.ContainerGID)}[0]
+// syncServices updates the services of the server that were created with a
+// different configuration. A service of another type or with other IP families
+// is removed, so that it is created again, the labels and annotations of the
+// others are updated. The service of the IPv6 allocations is removed once the
+// server no longer has any.
+func (e *Environment) syncServices(ctx context.Context) error {
+	services := e.client.CoreV1().Services(config.Get().Cluster.Namespace)
+	if e.ipv6Service() == nil {
+		if err := services.Delete(ctx, e.serviceNames()[1], metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "environment/kubernetes: failed to remove service")
+		}
+	}
+
+	for _, desired := range e.services() {
+		svc, err := services.Get(ctx, desired.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrap(err, "environment/kubernetes: failed to get service")
+		}
+
+		if svc.Spec.Type != desired.Spec.Type || !sameIPFamilies(svc, desired) {
+			if err := services.Delete(ctx, svc.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return errors.Wrap(err, "environment/kubernetes: failed to remove service")
+			}
+			continue
+		}
+
+		// The keys set by Kuber are removed once they no longer apply, such as the hostname
+		// of a server that became internal, the others are left alone.
+		managed := map[string][]string{
+			"labels":      {HostnameLabel, NetworkOwnerLabel, config.Get().Cluster.Network.GroupLabel},
+			"annotations": {externalDNSHostnameAnnotation, externalDNSTTLAnnotation, serverNameAnnotation},
+		}
+		meta := make(map[string]interface{})
+		for key, want := range map[string]map[string]string{"labels": desired.Labels, "annotations": desired.Annotations} {
+			current := svc.Labels
+			if key == "annotations" {
+				current = svc.Annotations
+			}
+			changed := make(map[string]interface{})
+			for k, v := range want {
+				if current[k] != v {
+					changed[k] = v
+				}
+			}
+			for _, k := range managed[key] {
+				if _, ok := want[k]; !ok && current[k] != "" {
+					changed[k] = nil
+				}
+			}
+			if len(changed) > 0 {
+				meta[key] = changed
+			}
+		}
+		if len(meta) == 0 {
+			continue
+		}
+		b, err := json.Marshal(map[string]interface{}{"metadata": meta})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := services.Patch(ctx, svc.Name, types.MergePatchType, b, metav1.PatchOptions{}); err != nil {
+			return errors.Wrap(err, "environment/kubernetes: failed to update service")
+		}
+	}
+	return nil
+}
+
+// services returns the definitions of all the services of the server.
+func (e *Environment) services() []*corev1.Service {
+	out := []*corev1.Service{e.service()}
+	if svc := e.ipv6Service(); svc != nil {
+		out = append(out, svc)
+	}
+	return out
+}
+
+// serviceLabels returns the labels of the services of the server, which carry
+// the network group of the server so that the other servers in the group are
+// able to find them, and the name the server is published under.
+func (e *Environment) serviceLabels() map[string]string {
+	labels := environment.ObjectLabels(e.Id)
+	if n := e.privateNetwork(); n.Group != "" {
+		labels[config.Get().Cluster.Network.GroupLabel] = n.Group
+		labels[NetworkOwnerLabel] = n.Owner
 	}
+	if name := e.hostLabel(); name != "" {
+		labels[HostnameLabel] = name
+	}
+	return labels
+}
+
+// serviceAnnotations returns the annotations of the services of the server.
+func (e *Environment) serviceAnnotations() map[string]string {
+	annotations := e.dnsAnnotations()
+	if n := e.privateNetwork(); n.Group != "" && n.Name != "" {
+		if annotations == nil {
+			annotations = make(map[string]string, 1)
+		}
+		annotations[serverNameAnnotation] = n.Name
+	}
+	return annotations
+}
+
+// service returns the service definition for the server using the allocations
+// that are currently assigned to it.
+func (e *Environment) service() *corev1.Service {
+	cfg := config.Get()
+	a := e.Configuration.Allocations()
 
 	// Get ServiceType configuration
 	var servicetype string
-	switch cfg.Cluster.ServiceType {
-	case "loadbalancer":
+	switch {
+	case e.privateNetwork().Internal:
+		servicetype = "ClusterIP"
+	case cfg.Cluster.ServiceType == "loadbalancer":
 		servicetype = "LoadBalancer"
 	default:
 		servicetype = "NodePort"
@@ -306,10 +578,9 @@ func (e *Environment) Create() error {
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "svc-" + e.Id,
-			Labels: map[string]string{
-				"uuid": e.Id,
-			},
+			Name:        "svc-" + e.Id,
+			Labels:      e.serviceLabels(),
+			Annotations: e.serviceAnnotations(),
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
@@ -324,8 +595,11 @@ func (e *Environment) Create() error {
 					Port:     int32(a.DefaultPort),
 				},
 			},
+			// Only select the server process, other pods such as the installer share the
+			// same server label.
 			Selector: map[string]string{
-				"uuid": e.Id,
+				"uuid":          e.Id,
+				"ContainerType": "server_process",
 			},
 			Type:                corev1.ServiceType(servicetype),
 			HealthCheckNodePort: 0,
@@ -343,17 +617,9 @@ func (e *Environment) Create() error {
 			})
 	}
 
-	if _, err := e.client.CoreV1().Services(config.Get().Cluster.Namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			return errors.Wrap(err, "environment/kubernetes: failed to create service")
-		}
-	}
-
-	if _, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
-		return errors.Wrap(err, "environment/kubernetes: failed to create pod")
-	}
+	e.applyIPFamilies(service, a)
 
-	return nil
+	return service
 }
 
 // Destroy will remove the Docker container from the server. If the container
@@ -362,15 +628,63 @@ func (e *Environment) Destroy() error {
 	// We set it to stopping than offline to prevent crash detection from being triggered.
 	e.SetState(environment.ProcessStoppingState)
 
+	// Once a server has been transferred to another node sharing this namespace, the
+	// objects with its name belong to that node and must be left alone.
+	if e.adoptedElsewhere(context.Background()) {
+		e.log().Debug("server has been adopted by another node, not removing cluster objects")
+		e.SetState(environment.ProcessOfflineState)
+		return nil
+	}
+
+	// In operator mode removing the GameServer resource cascades to everything it
+	// owns, the objects are still removed below in case they were created before
+	// operator mode was enabled.
+	if config.Get().Cluster.Operator.Enabled {
+		if err := e.deleteGameServer(context.Background()); err != nil {
+			return err
+		}
+	}
+
 	var zero int64 = 0
 	policy := metav1.DeletePropagationForeground
 
-	err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(context.Background(), e.Id, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
+	if statefulSets() {
+		err := e.client.AppsV1().StatefulSets(config.Get().Cluster.Namespace).Delete(context.Background(), e.Id, metav1.DeleteOptions{PropagationPolicy: &policy})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(context.Background(), e.PodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	for _, name := range e.serviceNames() {
+		err = e.client.CoreV1().Services(config.Get().Cluster.Namespace).Delete(context.Background(), name, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if err := e.deleteSrvRecord(context.Background()); err != nil {
+		return err
+	}
+	if err := e.deleteNetworkPolicy(context.Background()); err != nil {
+		return err
+	}
+
+	err = e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(context.Background(), e.filesPodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	err = e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(context.Background(), e.hibernationPodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
 
-	err = e.client.CoreV1().Services(config.Get().Cluster.Namespace).Delete(context.Background(), "svc-"+e.Id, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
+	err = e.client.CoreV1().ConfigMaps(config.Get().Cluster.Namespace).Delete(context.Background(), e.configsName(), metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
@@ -407,7 +721,7 @@ func (e *Environment) SendCommand(c string) error {
 		Post().
 		Namespace(config.Get().Cluster.Namespace).
 		Resource("pods").
-		Name(e.Id).
+		Name(e.PodName()).
 		SubResource("attach").
 		VersionedParams(&v1.PodAttachOptions{
 			Container: "process",
@@ -449,7 +763,8 @@ func (e *Environment) SendCommand(c string) error {
 // is running or not, it will simply try to read the last X bytes of the file
 // and return them.
 func (e *Environment) Readlog(lines int) ([]string, error) {
-	r := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).GetLogs(e.Id, &corev1.PodLogOptions{
+	r := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).GetLogs(e.PodName(), &corev1.PodLogOptions{
+		Container: "process",
 		TailLines: &[]int64{int64(lines)}[0],
 	})
 	podLogs, err := r.Stream(context.Background())
@@ -10,7 +10,7 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
-	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -29,18 +29,34 @@ import (
 // a bootable state. This ensures that unexpected container deletion while Wings
 // is running does not result in the server becoming un-bootable.
 func (e *Environment) OnBeforeStart(ctx context.Context) error {
-	// Always destroy and re-create the server container to ensure that synced data from the Panel is used.
+	e.mu.Lock()
+	e.exit = nil
+	e.mu.Unlock()
+
+	pod, err := e.pod(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A supervised pod is able to run the server process again if nothing changed since
+	// it was created, otherwise the pod is recreated to ensure that synced data from the
+	// Panel is used.
+	if current, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{}); err == nil && reusable(current, pod) {
+		e.log().Debug("pod of server is unchanged, restarting process in place")
+		return nil
+	}
+
 	var zero int64 = 0
 	policy := metav1.DeletePropagationForeground
 
-	if err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, e.Id, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy}); err != nil {
+	if err := e.removePod(ctx, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy}); err != nil {
 		if !apierrors.IsNotFound(err) {
 			return errors.WrapIf(err, "environment/kubernetes: failed to remove pod during pre-boot")
 		}
 	}
 
 	conditionFunc := func() (bool, error) {
-		_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.Id, metav1.GetOptions{})
+		_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.PodName(), metav1.GetOptions{})
 		if err != nil {
 			if apierrors.IsNotFound(err) {
 				return true, nil
@@ -50,23 +66,11 @@ func (e *Environment) OnBeforeStart(ctx context.Context) error {
 		return false, nil
 	}
 
-	err := wait.Poll(time.Second, time.Second*10, conditionFunc)
-	if err != nil {
+	if err := wait.Poll(time.Second, time.Second*10, conditionFunc); err != nil {
 		return err
 	}
 
-	// The Create() function will check if the container exists in the first place, and if
-	// so just silently return without an error. Otherwise, it will try to create the necessary
-	// container and data storage directory.
-	//
-	// This won't actually run an installation process however, it is just here to ensure the
-	// environment gets created properly if it is missing and the server is started. We're making
-	// an assumption that all the files will still exist at this point.
-	if err := e.Create(); err != nil {
-		return err
-	}
-
-	return nil
+	return e.createPod(ctx, pod)
 }
 
 // Start will start the server environment and begins piping output to the event
@@ -88,7 +92,7 @@ func (e *Environment) Start(ctx context.Context) error {
 		}
 	}()
 
-	if c, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.Id, metav1.GetOptions{}); err != nil {
+	if c, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{}); err != nil {
 		// Do nothing if the container is not found, we just don't want to continue
 		// to the next block of code here. This check was inlined here to guard against
 		// a nil-pointer when checking c.State below.
@@ -98,19 +102,29 @@ func (e *Environment) Start(ctx context.Context) error {
 			return errors.WrapIf(err, "environment/docker: failed to inspect container")
 		}
 	} else {
+		// The container of a supervised process keeps running after the process exited, so
+		// the supervisor is asked if the process itself is running.
+		running := processRunning(c)
+		if running && supervised(c) {
+			var run int
+			if running, run, err = e.supervisorStatus(ctx); err != nil {
+				return err
+			}
+			e.setRun(run)
+		}
+
 		// If the server is running update our internal state and continue on with the attach.
-		if c.Status.Phase == v1.PodRunning {
+		if running {
 			e.SetState(environment.ProcessRunningState)
 
 			go func() {
 				conditionFunc := func() (bool, error) {
-					pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.Id, metav1.GetOptions{})
+					pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.PodName(), metav1.GetOptions{})
 					if err != nil {
 						return true, err
 					}
 
-					switch pod.Status.Phase {
-					case v1.PodFailed, v1.PodSucceeded:
+					if processExited(pod) {
 						return true, fmt.Errorf("pod ran to completion")
 					}
 					return false, nil
@@ -163,19 +177,18 @@ func (e *Environment) Start(ctx context.Context) error {
 	actx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
+	var pod *corev1.Pod
 	conditionFunc := func() (bool, error) {
-		pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.Id, metav1.GetOptions{})
+		var err error
+		pod, err = e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(context.TODO(), e.PodName(), metav1.GetOptions{})
 		if err != nil {
 			return false, err
 		}
 
-		switch pod.Status.Phase {
-		case v1.PodRunning:
-			return true, nil
-		case v1.PodFailed, v1.PodSucceeded:
+		if processExited(pod) {
 			return false, fmt.Errorf("pod ran to completion")
 		}
-		return false, nil
+		return processRunning(pod), nil
 	}
 
 	err := wait.Poll(time.Second, time.Second*30, conditionFunc)
@@ -184,6 +197,24 @@ func (e *Environment) Start(ctx context.Context) error {
 		return nil
 	}
 
+	// The supervisor starts the process by itself in a new pod, while a reused pod waits
+	// for the process to be started again.
+	inPlace := false
+	if supervised(pod) {
+		running, run, err := e.supervisorStatus(ctx)
+		if err != nil {
+			return err
+		}
+		inPlace = !running
+		e.setRun(run)
+	}
+
+	if !inPlace {
+		e.publishConfigureOutput(ctx)
+	}
+	// Keep answering clients of a hibernating server until the process is running.
+	e.EndHibernation(ctx)
+
 	if e.Config().Limits().DiskSpace <= 0 {
 		e.HasSpaceAvailable(true)
 	} else {
@@ -200,9 +231,14 @@ func (e *Environment) Start(ctx context.Context) error {
 	//
 	// By explicitly attaching to the instance before we start it, we can immediately
 	// react to errors/output stopping/etc. when starting.
-	if err := e.Attach(actx); err != nil {
+	if err := e.attach(actx, inPlace); err != nil {
 		return err
 	}
+	if inPlace {
+		if err := e.startInPlace(ctx); err != nil {
+			return err
+		}
+	}
 
 	// No errors, good to continue through.
 	sawError = false
@@ -261,7 +297,7 @@ func (e *Environment) Stop(ctx context.Context) error {
 	// Using a negative timeout here will allow the container to stop gracefully,
 	// rather than forcefully terminating it, this value MUST be at least 1
 	// second, otherwise it will be ignored.
-	if err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, e.Id, metav1.DeleteOptions{}); err != nil {
+	if err := e.removePod(ctx, metav1.DeleteOptions{}); err != nil {
 		// If the container does not exist just mark the process as stopped and return without
 		// an error.
 		if apierrors.IsNotFound(err) {
@@ -318,14 +354,15 @@ func (e *Environment) WaitForStop(ctx context.Context, duration time.Duration, t
 	// longer running. If this wait does not end by the time seconds have passed,
 	// attempt to terminate the container, or return an error.
 	conditionFunc := func(context.Context) (bool, error) {
-		_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(tctx, e.Id, metav1.GetOptions{})
+		pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(tctx, e.PodName(), metav1.GetOptions{})
 		if err != nil {
 			if apierrors.IsNotFound(err) {
 				return true, nil
 			}
 			return false, nil
 		}
-		return false, nil
+		// A supervised pod is kept after the process stopped, so it is able to be reused.
+		return supervised(pod) && e.st.Load() == environment.ProcessOfflineState, nil
 	}
 
 	err := wait.PollUntilWithContext(tctx, time.Second, conditionFunc)
@@ -341,7 +378,7 @@ func (e *Environment) WaitForStop(ctx context.Context, duration time.Duration, t
 
 // Terminate forcefully terminates the container using the signal provided.
 func (e *Environment) Terminate(ctx context.Context, signal os.Signal) error {
-	_, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.Id, metav1.GetOptions{})
+	pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
 	if err != nil {
 		// Treat missing containers as an okay error state, means it is obviously
 		// already terminated at this point.
@@ -353,9 +390,20 @@ func (e *Environment) Terminate(ctx context.Context, signal os.Signal) error {
 
 	// We set it to stopping than offline to prevent crash detection from being triggered.
 	e.SetState(environment.ProcessStoppingState)
+
+	// Only the process of a supervised pod is signaled, keeping the pod to be reused. The
+	// pod is removed instead if the supervisor does not respond.
+	if sig, ok := signal.(syscall.Signal); ok && supervised(pod) && processRunning(pod) {
+		err := e.terminateSupervised(ctx, sig)
+		if err == nil {
+			e.SetState(environment.ProcessOfflineState)
+			return nil
+		}
+		e.log().WithField("error", err).Warn("failed to terminate supervised process, removing pod")
+	}
 	var zero int64 = 0
 	policy := metav1.DeletePropagationForeground
-	if err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, e.Id, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy}); err != nil && !apierrors.IsNotFound(err) {
+	if err := e.removePod(ctx, metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy}); err != nil && !apierrors.IsNotFound(err) {
 		return errors.WithStack(err)
 	}
 	e.SetState(environment.ProcessOfflineState)
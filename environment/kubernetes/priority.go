@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// The reasons set by the scheduler on the DisruptionTarget condition of a pod
+// it preempted. The reason was renamed in Kubernetes 1.27.
+var preemptionReasons = []string{"PreemptionByKubeScheduler", "PreemptionByScheduler"}
+
+// EnsurePriorityClasses creates the priority classes defined in the
+// configuration that have a value and do not exist in the cluster yet.
+func EnsurePriorityClasses(ctx context.Context) error {
+	_, client, err := environment.Cluster()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range config.Get().Cluster.Priorities.Classes() {
+		if c.Name == "" || c.Value == 0 {
+			continue
+		}
+		pc := &schedulingv1.PriorityClass{
+			ObjectMeta:       metav1.ObjectMeta{Name: c.Name},
+			Value:            c.Value,
+			PreemptionPolicy: preemptionPolicy(c),
+			Description:      "Created by Kuber for the pods of game servers.",
+		}
+		if _, err := client.SchedulingV1().PriorityClasses().Create(ctx, pc, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			return errors.Wrap(err, "environment/kubernetes: failed to create priority class")
+		}
+		log.WithField("priority_class", c.Name).Info("created priority class for server pods")
+	}
+	return nil
+}
+
+// preemptionPolicy returns the preemption policy of the priority class.
+func preemptionPolicy(c config.PriorityClass) *corev1.PreemptionPolicy {
+	p := corev1.PreemptLowerPriority
+	if c.PreemptionPolicy == string(corev1.PreemptNever) {
+		p = corev1.PreemptNever
+	}
+	return &p
+}
+
+// preemptionReason returns the exit reason for a pod that was preempted, or an
+// empty string if it was not or that cannot be determined. Clusters without
+// disruption conditions only record a preemption by the scheduler as an event
+// of the pod, which is only looked up for pods that are being deleted since
+// that is how the scheduler preempts them.
+func (e *Environment) preemptionReason(ctx context.Context, pod *corev1.Pod) string {
+	for _, c := range pod.Status.Conditions {
+		if c.Type != corev1.DisruptionTarget || c.Status != corev1.ConditionTrue {
+			continue
+		}
+		for _, r := range preemptionReasons {
+			if c.Reason == r {
+				return environment.ExitReasonPreempted
+			}
+		}
+	}
+
+	// The kubelet records the preemption of pods to admit critical pods in the status.
+	if pod.Status.Reason == "Preempting" {
+		return environment.ExitReasonPreempted
+	}
+	if pod.DeletionTimestamp == nil {
+		return ""
+	}
+
+	selector := fields.Set{"involvedObject.uid": string(pod.UID), "reason": "Preempted"}
+	events, err := e.client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		e.log().WithField("error", err).Debug("failed to list pod events, preemption of pod is unknown")
+		return ""
+	}
+	if len(events.Items) > 0 {
+		return environment.ExitReasonPreempted
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// serverNameAnnotation holds the name of the server on its services, which the
+// environment variables of the other servers in its network group are named
+// after.
+const serverNameAnnotation = GameServerGroup + "/server-name"
+
+// NetworkOwnerLabel holds the user owning the server on its pod and services.
+// Network groups are only shared by the servers of the same user, as the label
+// holding the group is chosen freely.
+const NetworkOwnerLabel = GameServerGroup + "/network-owner"
+
+// PrivateNetwork defines how a server is reachable by the other servers in the
+// cluster.
+type PrivateNetwork struct {
+	// Internal only exposes the allocations of the server through a service with a
+	// cluster IP, which is only reachable by the servers in its group.
+	Internal bool
+	// Group is the network group of the server, servers without a group are not
+	// reachable by other servers when they are internal.
+	Group string
+	// Name is the name of the server.
+	Name string
+	// Owner is the user owning the server, the group of the server only includes
+	// the servers of the same user.
+	Owner string
+}
+
+func (e *Environment) privateNetwork() PrivateNetwork {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.meta.Private
+}
+
+// InternalHostname returns the name the service of the server resolves to from
+// inside of the cluster.
+func (e *Environment) InternalHostname() string {
+	cfg := config.Get().Cluster
+	return "svc-" + e.Id + "." + cfg.Namespace + ".svc." + strings.Trim(cfg.Network.ClusterDomain, ".")
+}
+
+// networkPolicyName returns the name of the NetworkPolicy restricting access to
+// an internal server.
+func (e *Environment) networkPolicyName() string {
+	return e.Id + "-network"
+}
+
+// privateEnvVars returns the environment variables holding the internal
+// hostname of the server, and those of the other servers in its group, named
+// after those servers. The other servers are found through their services, so
+// servers on other nodes sharing the namespace are included.
+func (e *Environment) privateEnvVars(ctx context.Context) ([]corev1.EnvVar, error) {
+	n := e.privateNetwork()
+	if !n.Internal && n.Group == "" {
+		return nil, nil
+	}
+
+	out := []corev1.EnvVar{{Name: "SERVER_INTERNAL_HOST", Value: e.InternalHostname()}}
+	if n.Group == "" {
+		return out, nil
+	}
+
+	cfg := config.Get().Cluster
+	list, err := e.client.CoreV1().Services(cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{cfg.Network.GroupLabel: n.Group, NetworkOwnerLabel: n.Owner}).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "environment/kubernetes: failed to list services of network group")
+	}
+
+	// Sort the services so that the variables do not change the hash of the pod, the oldest
+	// server wins when the names of servers collide.
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i].CreationTimestamp, list.Items[j].CreationTimestamp
+		if a.Equal(&b) {
+			return list.Items[i].Name < list.Items[j].Name
+		}
+		return a.Before(&b)
+	})
+
+	seen := make(map[string]bool)
+	var group []corev1.EnvVar
+	for _, svc := range list.Items {
+		uuid := svc.Labels[environment.ServerLabel]
+		if uuid == "" || uuid == e.Id || svc.Name != "svc-"+uuid {
+			continue
+		}
+		name := envName(svc.Annotations[serverNameAnnotation])
+		if name == "" {
+			name, _, _ = strings.Cut(uuid, "-")
+			name = envName(name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		group = append(group, corev1.EnvVar{
+			Name:  "INTERNAL_HOST_" + name,
+			Value: svc.Name + "." + cfg.Namespace + ".svc." + strings.Trim(cfg.Network.ClusterDomain, "."),
+		})
+	}
+	sort.Slice(group, func(i, j int) bool { return group[i].Name < group[j].Name })
+
+	return append(out, group...), nil
+}
+
+// envName converts the name of a server into the suffix of an environment
+// variable, such as "Lobby 1" into "LOBBY_1".
+func envName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		switch {
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteRune('_')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// ensureNetworkPolicy creates or updates the NetworkPolicy of an internal server,
+// which only lets the servers in its group reach its ports. The pod answering on
+// the ports of the server while it hibernates is covered as well. The policy of
+// a server that is no longer internal is removed.
+func (e *Environment) ensureNetworkPolicy(ctx context.Context, refs []metav1.OwnerReference) error {
+	n := e.privateNetwork()
+	if !n.Internal {
+		return e.deleteNetworkPolicy(ctx)
+	}
+
+	desired := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            e.networkPolicyName(),
+			Labels:          environment.ObjectLabels(e.Id),
+			OwnerReferences: refs,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					environment.ServerLabel: e.Id,
+				},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      "ContainerType",
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   []string{"server_process", "server_hibernated"},
+					},
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			// Without any rules nothing is able to reach the server.
+			Ingress: []networkingv1.NetworkPolicyIngressRule{},
+		},
+	}
+	if n.Group != "" {
+		rule := networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							config.Get().Cluster.Network.GroupLabel: n.Group,
+							NetworkOwnerLabel:                       n.Owner,
+							"ContainerType":                         "server_process",
+						},
+					},
+				},
+			},
+		}
+		for _, p := range e.ports() {
+			protocol, port := p.Protocol, intstr.FromInt(int(p.ContainerPort))
+			rule.Ports = append(rule.Ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+		}
+		desired.Spec.Ingress = append(desired.Spec.Ingress, rule)
+	}
+
+	policies := e.client.NetworkingV1().NetworkPolicies(config.Get().Cluster.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := policies.Get(ctx, desired.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = policies.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		} else if err != nil {
+			return err
+		}
+		current.Labels = desired.Labels
+		current.OwnerReferences = desired.OwnerReferences
+		current.Spec = desired.Spec
+		_, err = policies.Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to apply network policy")
+	}
+	return nil
+}
+
+// deleteNetworkPolicy removes the NetworkPolicy of the server, if it has one.
+// Kuber is not required to have access to network policies unless internal
+// servers are used, in which case there is no policy to remove either.
+func (e *Environment) deleteNetworkPolicy(ctx context.Context) error {
+	err := e.client.NetworkingV1().NetworkPolicies(config.Get().Cluster.Namespace).Delete(ctx, e.networkPolicyName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsForbidden(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to delete network policy")
+	}
+	return nil
+}
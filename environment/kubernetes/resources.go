@@ -0,0 +1,209 @@
+package kubernetes
+
+import (
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// resourceRequirements returns the resources of the server process container.
+// The limits are the hard caps assigned to the server, while the requests are
+// reduced by the overcommit ratios of the node so that servers can be packed
+// more densely than their limits would allow.
+func (e *Environment) resourceRequirements() corev1.ResourceRequirements {
+	res, _ := e.resources()
+	return res
+}
+
+// EnforcedLimits returns the limits of the server that are applied to the pod
+// of the server, depending on the capabilities of the nodes in the cluster.
+func (e *Environment) EnforcedLimits() environment.EnforcedLimits {
+	_, enforced := e.resources()
+	return enforced
+}
+
+// resources returns the resources of the server process container along with
+// the limits of the server that are enforced by them.
+func (e *Environment) resources() (corev1.ResourceRequirements, environment.EnforcedLimits) {
+	cfg := config.Get().Cluster
+	l := e.Configuration.Limits()
+
+	limits := corev1.ResourceList{}
+	requests := corev1.ResourceList{}
+	enforced := environment.EnforcedLimits{
+		Memory:      true,
+		Cpu:         true,
+		Threads:     l.Threads == "",
+		IoWeight:    cfg.Limits.IoWeightAnnotation != "",
+		OOMDisabled: !l.OOMDisabled || cfg.Limits.OOMDisabledAnnotation != "",
+	}
+
+	memory := l.BoundedMemoryLimit()
+
+	// Files in a disk backed /tmp count towards the ephemeral storage of the pod, so the
+	// size of the volume is added on top of the configured limit.
+	if storage := cfg.EphemeralStorage * 1024 * 1024; storage > 0 {
+		if tmp := e.tmp(); tmp.Medium == "disk" {
+			storage += tmp.Size * 1024 * 1024
+		}
+		limits[corev1.ResourceEphemeralStorage] = *resource.NewQuantity(storage, resource.BinarySI)
+		requests[corev1.ResourceEphemeralStorage] = *resource.NewQuantity(storage, resource.BinarySI)
+	}
+
+	// Exclusive CPUs are only handed out by the static CPU manager to Guaranteed pods that
+	// request a whole number of CPUs, which requires every container in the pod to have
+	// requests equal to its limits.
+	if l.Threads != "" && cfg.Limits.StaticCpuManager && memory > 0 && e.sidecarsGuaranteed() {
+		threads, err := threadCount(l.Threads)
+		if err != nil {
+			e.log().WithField("error", err).Warn("ignoring invalid threads for server")
+		} else {
+			limits[corev1.ResourceCPU] = *resource.NewQuantity(threads, resource.DecimalSI)
+			limits[corev1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+
+			enforced.Threads = true
+			enforced.Cpu = l.CpuLimit == threads*100
+			// Guaranteed pods are never allowed to swap.
+			enforced.Swap = l.Swap == 0
+
+			return corev1.ResourceRequirements{Limits: limits, Requests: limits.DeepCopy()}, enforced
+		}
+	}
+
+	// The CPU limit is a percentage of a single core, so 150% becomes 1500m.
+	cpu := l.CpuLimit * 10
+	if cpu > 0 {
+		limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(cpu, resource.DecimalSI)
+	}
+	if r := cfg.Overcommit.CpuRequest(cpu); r > 0 {
+		requests[corev1.ResourceCPU] = *resource.NewMilliQuantity(r, resource.DecimalSI)
+	}
+
+	if memory > 0 {
+		request := cfg.Overcommit.MemoryRequest(memory)
+		// Leave the overhead out of the request for servers with swap, keeping the pod in
+		// the Burstable class that is allowed to swap.
+		if cfg.Limits.NodeSwap && l.Swap != 0 && l.MemoryLimit*1_000_000 < request {
+			request = l.MemoryLimit * 1_000_000
+		}
+		limits[corev1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+		requests[corev1.ResourceMemory] = *resource.NewQuantity(request, resource.BinarySI)
+	}
+
+	// The pod is Guaranteed, and therefore unable to swap, when requests match the limits.
+	// The amount of swap of a Burstable pod is decided by the kubelet, so only servers
+	// without any swap have their swap limit enforced.
+	burstable := memory == 0 || cpu == 0 || !requests[corev1.ResourceMemory].Equal(limits[corev1.ResourceMemory]) || !requests[corev1.ResourceCPU].Equal(limits[corev1.ResourceCPU])
+	swaps := cfg.Limits.NodeSwap && burstable
+	enforced.Swap = l.Swap == 0 && !swaps
+
+	return corev1.ResourceRequirements{Limits: limits, Requests: requests}, enforced
+}
+
+// tmpVolume returns the volume mounted at /tmp in the server process container.
+func (e *Environment) tmpVolume() corev1.Volume {
+	tmp := e.tmp()
+
+	source := &corev1.EmptyDirVolumeSource{}
+	if tmp.Medium != "disk" {
+		source.Medium = corev1.StorageMediumMemory
+	}
+	if tmp.Size > 0 {
+		source.SizeLimit = resource.NewQuantity(tmp.Size*1024*1024, resource.BinarySI)
+	}
+
+	return corev1.Volume{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: source}}
+}
+
+func (e *Environment) tmp() config.TmpVolume {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.meta.Tmp
+}
+
+// ephemeralStorageMessages are contained in the messages the kubelet evicts pods
+// with for exceeding the ephemeral storage limit of the pod, of one of its
+// containers or of one of its emptyDir volumes, in that order.
+var ephemeralStorageMessages = []string{
+	"ephemeral local storage",
+	"local ephemeral storage",
+	"EmptyDir volume",
+}
+
+// evictionReason returns the exit reason for a pod that was evicted by the
+// kubelet, or an empty string if the pod was not evicted. Evictions caused by
+// the node running low on resources are not blamed on the server itself.
+func evictionReason(pod *corev1.Pod) string {
+	if pod.Status.Reason != "Evicted" {
+		return ""
+	}
+	msg := pod.Status.Message
+	if strings.HasPrefix(msg, "The node was low on resource") {
+		return environment.ExitReasonEvicted
+	}
+	for _, m := range ephemeralStorageMessages {
+		if strings.Contains(msg, m) {
+			return environment.ExitReasonEphemeralStorage
+		}
+	}
+	return environment.ExitReasonEvicted
+}
+
+// limitAnnotations returns the annotations passing the limits of the server that
+// are applied by a runtime hook to the nodes.
+func (e *Environment) limitAnnotations() map[string]string {
+	cfg := config.Get().Cluster.Limits
+	l := e.Configuration.Limits()
+
+	annotations := map[string]string{}
+	if cfg.IoWeightAnnotation != "" && l.IoWeight > 0 {
+		annotations[cfg.IoWeightAnnotation] = strconv.Itoa(int(l.IoWeight))
+	}
+	if cfg.OOMDisabledAnnotation != "" && l.OOMDisabled {
+		annotations[cfg.OOMDisabledAnnotation] = "true"
+	}
+	return annotations
+}
+
+// sidecarsGuaranteed reports if every sidecar of the server has both a memory
+// and a CPU limit, which are also used as its requests.
+func (e *Environment) sidecarsGuaranteed() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, s := range e.meta.Sidecars {
+		if s.Limits.Memory <= 0 || s.Limits.Cpu <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// threadCount returns the number of threads in a list of threads such as
+// "0-3,6", which is the format used by the Panel.
+func threadCount(threads string) (int64, error) {
+	var count int64
+	for _, part := range strings.Split(threads, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("environment/kubernetes: invalid threads \"%s\"", threads)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.ParseInt(strings.TrimSpace(last), 10, 64); err != nil || to < from {
+				return 0, errors.Errorf("environment/kubernetes: invalid threads \"%s\"", threads)
+			}
+		}
+		count += to - from + 1
+	}
+	return count, nil
+}
@@ -0,0 +1,39 @@
+package kubernetes
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubectyl/kuber/environment"
+)
+
+func TestEvictionReason(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("evictionReason", func() {
+		cases := []struct {
+			name    string
+			reason  string
+			message string
+			want    string
+		}{
+			{"running pods", "", "", ""},
+			{"other failures", "UnexpectedAdmissionError", "Pod ephemeral local storage usage exceeds the total limit of containers 1Gi.", ""},
+			{"the pod exceeding its limit", "Evicted", "Pod ephemeral local storage usage exceeds the total limit of containers 1Gi.", environment.ExitReasonEphemeralStorage},
+			{"a container exceeding its limit", "Evicted", "Container process exceeded its local ephemeral storage limit \"1Gi\". ", environment.ExitReasonEphemeralStorage},
+			{"an emptyDir volume exceeding its limit", "Evicted", "Usage of EmptyDir volume \"tmp\" exceeds the limit \"512Mi\". ", environment.ExitReasonEphemeralStorage},
+			{"the node running low on storage", "Evicted", "The node was low on resource: ephemeral-storage. Threshold quantity: 1Gi, available: 512Mi. Container process was using 2Gi, request is 1Gi, has larger consumption of ephemeral-storage. ", environment.ExitReasonEvicted},
+			{"the node running low on memory", "Evicted", "The node was low on resource: memory. ", environment.ExitReasonEvicted},
+		}
+
+		for _, c := range cases {
+			c := c
+			g.It("handles "+c.name, func() {
+				pod := &corev1.Pod{Status: corev1.PodStatus{Reason: c.reason, Message: c.message}}
+				g.Assert(evictionReason(pod)).Equal(c.want)
+			})
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubectyl/kuber/config"
+)
+
+// exitState is the exit state of a server process whose pod has already been
+// removed from the cluster.
+type exitState struct {
+	code   uint32
+	oom    bool
+	reason string
+}
+
+// sidecarContainers returns the containers for the sidecars enabled for the
+// server. The containers use the same security context as the server process so
+// that files written to the volume are owned by the same user.
+func (e *Environment) sidecarContainers(sc *corev1.SecurityContext) []corev1.Container {
+	e.mu.RLock()
+	sidecars := e.meta.Sidecars
+	e.mu.RUnlock()
+
+	var out []corev1.Container
+	for _, s := range sidecars {
+		if s.Name == "" || s.Name == "process" || s.Image == "" {
+			e.log().WithField("sidecar", s.Name).Warn("ignoring sidecar without a valid name or image")
+			continue
+		}
+
+		c := corev1.Container{
+			Name:            s.Name,
+			Image:           s.Image,
+			Command:         s.Command,
+			Args:            s.Args,
+			SecurityContext: sc.DeepCopy(),
+		}
+		for k, v := range s.Env {
+			c.Env = append(c.Env, corev1.EnvVar{Name: k, Value: v})
+		}
+
+		if s.Storage == "readonly" || s.Storage == "readwrite" {
+			mountPath := s.MountPath
+			if mountPath == "" {
+				mountPath = volumePath
+			}
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+				Name:      "storage",
+				MountPath: mountPath,
+				ReadOnly:  s.Storage == "readonly",
+			})
+		}
+
+		if s.Limits.Memory > 0 || s.Limits.Cpu > 0 {
+			limits := corev1.ResourceList{}
+			if s.Limits.Memory > 0 {
+				limits[corev1.ResourceMemory] = *resource.NewQuantity(s.Limits.Memory*1024*1024, resource.BinarySI)
+			}
+			if s.Limits.Cpu > 0 {
+				limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(s.Limits.Cpu*10, resource.DecimalSI)
+			}
+			c.Resources = corev1.ResourceRequirements{Limits: limits, Requests: limits}
+		}
+
+		out = append(out, c)
+	}
+	return out
+}
+
+// processStatus returns the status of the server process container within the
+// pod, or nil if the container has not been created yet.
+func processStatus(pod *corev1.Pod) *corev1.ContainerStatus {
+	for i, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == "process" {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// processRunning reports if the server process within the pod is running. The
+// phase of the pod alone is not enough, since the pod keeps running for as long
+// as any of its sidecars are.
+func processRunning(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	cs := processStatus(pod)
+	return cs != nil && cs.State.Running != nil
+}
+
+// processExited reports if the server process within the pod has exited.
+func processExited(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+		return true
+	}
+	cs := processStatus(pod)
+	return cs != nil && cs.State.Terminated != nil
+}
+
+// releaseSidecars removes the pod of the server once the server process has
+// exited, so that its sidecars do not keep running until the server is started
+// again. The exit state of the process is kept so that crash detection is still
+// able to inspect it after the pod is gone, which is also done for pods that are
+// already being removed by the cluster, such as after a preemption.
+func (e *Environment) releaseSidecars() {
+	ctx := context.Background()
+	pods := e.client.CoreV1().Pods(config.Get().Cluster.Namespace)
+
+	pod, err := pods.Get(ctx, e.PodName(), metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	removing := pod.DeletionTimestamp != nil
+	if !removing {
+		if len(pod.Spec.Containers) < 2 {
+			return
+		}
+		if cs := processStatus(pod); cs == nil || cs.State.Terminated == nil {
+			return
+		}
+	}
+
+	code, oom, err := e.ExitState()
+	if err != nil {
+		e.log().WithField("error", err).Warn("failed to get exit state of server process")
+		return
+	}
+	reason, err := e.ExitReason()
+	if err != nil {
+		e.log().WithField("error", err).Warn("failed to get exit reason of server process")
+	}
+
+	e.mu.Lock()
+	e.exit = &exitState{code: code, oom: oom, reason: reason}
+	e.mu.Unlock()
+
+	if removing {
+		return
+	}
+
+	e.log().Debug("server process exited, removing pod to stop sidecars")
+	if err := e.removePod(ctx, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}}); err != nil && !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to remove pod after server process exited")
+	}
+}
+
+// lastExit returns the exit state stored when the pod of the server was removed
+// after the process exited, if any.
+func (e *Environment) lastExit() *exitState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.exit
+}
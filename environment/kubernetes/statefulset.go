@@ -0,0 +1,125 @@
+package kubernetes
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// statefulSets reports if the pods of servers are managed by a StatefulSet
+// rather than by Kuber itself.
+func statefulSets() bool {
+	return config.Get().Cluster.Workload == config.WorkloadStatefulSet
+}
+
+// PodName returns the name of the pod running the server process. The pod of a
+// StatefulSet is named after the StatefulSet and the ordinal of its replica.
+func (e *Environment) PodName() string {
+	if statefulSets() {
+		return e.Id + "-0"
+	}
+	return e.Id
+}
+
+// statefulSet returns the StatefulSet running a single replica of the pod. The
+// pod is only ever replaced by Kuber when starting the server, so changes to it
+// are not rolled out by the cluster.
+func (e *Environment) statefulSet(pod *corev1.Pod) *appsv1.StatefulSet {
+	spec := pod.Spec.DeepCopy()
+	// A StatefulSet only accepts pods that are always restarted, which never happens to
+	// the process container as the supervisor keeps running once the process exited.
+	spec.RestartPolicy = corev1.RestartPolicyAlways
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            e.Id,
+			Labels:          environment.ObjectLabels(e.Id),
+			OwnerReferences: pod.OwnerReferences,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &[]int32{1}[0],
+			ServiceName: "svc-" + e.Id,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					environment.ServerLabel: e.Id,
+					"ContainerType":         "server_process",
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+				},
+				Spec: *spec,
+			},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.OnDeleteStatefulSetStrategyType,
+			},
+		},
+	}
+}
+
+// applyStatefulSet creates the StatefulSet of the server running the pod, or
+// updates the existing one and scales it back up to a single replica.
+func (e *Environment) applyStatefulSet(ctx context.Context, pod *corev1.Pod) error {
+	desired := e.statefulSet(pod)
+	sets := e.client.AppsV1().StatefulSets(config.Get().Cluster.Namespace)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := sets.Get(ctx, e.Id, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = sets.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		} else if err != nil {
+			return err
+		}
+		current.Labels = desired.Labels
+		current.OwnerReferences = desired.OwnerReferences
+		current.Spec.Replicas = desired.Spec.Replicas
+		current.Spec.Template = desired.Spec.Template
+		_, err = sets.Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to apply statefulset")
+	}
+	return nil
+}
+
+// scaleStatefulSet sets the number of replicas of the StatefulSet of the server,
+// doing nothing if it does not exist.
+func (e *Environment) scaleStatefulSet(ctx context.Context, replicas int32) error {
+	sets := e.client.AppsV1().StatefulSets(config.Get().Cluster.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		scale, err := sets.GetScale(ctx, e.Id, metav1.GetOptions{})
+		if err != nil || scale.Spec.Replicas == replicas {
+			return err
+		}
+		scale.Spec.Replicas = replicas
+		_, err = sets.UpdateScale(ctx, e.Id, scale, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to scale statefulset")
+	}
+	return nil
+}
+
+// removePod removes the pod of the server. A StatefulSet is scaled down first,
+// since it would otherwise create the pod again.
+func (e *Environment) removePod(ctx context.Context, opts metav1.DeleteOptions) error {
+	if statefulSets() {
+		if err := e.scaleStatefulSet(ctx, 0); err != nil {
+			return err
+		}
+	}
+	return e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ctx, e.PodName(), opts)
+}
@@ -15,6 +15,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 
 	"github.com/kubectyl/kuber/config"
@@ -24,7 +25,7 @@ import (
 // Uptime returns the current uptime of the container in milliseconds. If the
 // container is not currently running this will return 0.
 func (e *Environment) Uptime(ctx context.Context) (int64, error) {
-	ins, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.Id, metav1.GetOptions{})
+	ins, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
 	if err != nil {
 		return 0, errors.Wrap(err, "environment: could not get pod")
 	}
@@ -62,7 +63,7 @@ func (e *Environment) pollResources(ctx context.Context) error {
 		Get().
 		Namespace(config.Get().Cluster.Namespace).
 		Resource("pods").
-		Name(e.Id).
+		Name(e.PodName()).
 		SubResource("exec").
 		VersionedParams(&v1.PodExecOptions{
 			Container: "process",
@@ -99,15 +100,33 @@ func (e *Environment) pollResources(ctx context.Context) error {
 		}
 
 		// Don't throw an error if pod metrics are not available, just keep trying.
-		podMetrics, err := mc.MetricsV1beta1().PodMetricses(config.Get().Cluster.Namespace).Get(ctx, e.Id, metav1.GetOptions{})
-
-		// Check if container index 0 is not out of range,
-		// if it is then send only the uptime stats.
-		//
-		// @see https://stackoverflow.com/questions/26126235/panic-runtime-error-index-out-of-range-in-go
-		if len(podMetrics.Containers) != 0 {
-			cpuQuantity := podMetrics.Containers[0].Usage.Cpu().AsDec().String()
-			memQuantity, ok := podMetrics.Containers[0].Usage.Memory().AsInt64()
+		podMetrics, err := mc.MetricsV1beta1().PodMetricses(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
+
+		// Only the usage of the server process container is reported as the usage of the
+		// server, sidecars are reported separately. If the metrics for the process are not
+		// available yet only the uptime stats are sent.
+		var process *metricsv1beta1.ContainerMetrics
+		sidecars := map[string]environment.SidecarStats{}
+		if err == nil {
+			for i, c := range podMetrics.Containers {
+				if c.Name == "process" {
+					process = &podMetrics.Containers[i]
+					continue
+				}
+				mem, _ := c.Usage.Memory().AsInt64()
+				sidecars[c.Name] = environment.SidecarStats{
+					Memory:      uint64(mem),
+					CpuAbsolute: float64(c.Usage.Cpu().MilliValue()) / 10,
+				}
+			}
+		}
+		if len(sidecars) == 0 {
+			sidecars = nil
+		}
+
+		if process != nil {
+			cpuQuantity := process.Usage.Cpu().AsDec().String()
+			memQuantity, ok := process.Usage.Memory().AsInt64()
 			if !ok {
 				break
 			}
@@ -124,6 +143,7 @@ func (e *Environment) pollResources(ctx context.Context) error {
 				Memory:      uint64(memQuantity),
 				CpuAbsolute: f * 100,
 				Network:     environment.NetworkStats{},
+				Sidecars:    sidecars,
 			}
 
 			b, err := rbuf.ReadBytes('\n')
@@ -146,7 +166,8 @@ func (e *Environment) pollResources(ctx context.Context) error {
 			uptime = uptime + 1000
 
 			st := environment.Stats{
-				Uptime: uptime,
+				Uptime:   uptime,
+				Sidecars: sidecars,
 			}
 			e.Events().Publish(environment.ResourceEvent, st)
 		}
@@ -0,0 +1,285 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/goccy/go-json"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/internal/supervisor"
+)
+
+// SpecHashAnnotation holds the hash of the pod of a server as it was created.
+// A supervised pod is only reused when starting the server if the hash of the
+// pod that would be created now is the same.
+const SpecHashAnnotation = GameServerGroup + "/spec-hash"
+
+// The directory the kuber binary is copied to within supervised pods, along
+// with the control socket of the supervisor.
+const (
+	supervisorPath   = "/kuber"
+	supervisorBinary = supervisorPath + "/kuber"
+	supervisorSocket = supervisorPath + "/supervisor.sock"
+)
+
+// supervisePod runs the entrypoint of the server through the supervisor when
+// fast restarts are enabled, so that the process is able to be restarted
+// without recreating the pod. Pods of a StatefulSet are always supervised, as
+// their containers are restarted by the cluster once they exit.
+func (e *Environment) supervisePod(pod *corev1.Pod) {
+	cfg := config.Get().Cluster.FastRestart
+	if !cfg.Enabled && !statefulSets() {
+		return
+	}
+
+	mount := corev1.VolumeMount{Name: "supervisor", MountPath: supervisorPath}
+	process := &pod.Spec.Containers[0]
+	// The entrypoint set on the container, if any, takes the place of the configured one.
+	entrypoint := cfg.Entrypoint
+	if len(process.Command) > 0 {
+		entrypoint = process.Command
+	}
+	entrypoint = append(append([]string{}, entrypoint...), process.Args...)
+
+	process.Command = []string{supervisorBinary, "supervise", "--socket", supervisorSocket, "--dir", volumePath}
+	process.VolumeMounts = append(process.VolumeMounts, mount)
+
+	// The init container only updates the configuration files for the first run, the
+	// supervisor updates them itself before every restart.
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == "configs" {
+			process.Command = append(process.Command, "--configs", configureMountPath+"/configs.json")
+			process.VolumeMounts = append(process.VolumeMounts, corev1.VolumeMount{Name: "configs", MountPath: configureMountPath, ReadOnly: true})
+		}
+	}
+	process.Args = append([]string{"--"}, entrypoint...)
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "supervisor",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	pod.Spec.InitContainers = append([]corev1.Container{
+		{
+			Name:            "supervisor",
+			Image:           config.KuberImage(cfg.Image),
+			Command:         []string{"/usr/bin/kuber", "supervise", "--install", supervisorBinary},
+			SecurityContext: process.SecurityContext.DeepCopy(),
+			VolumeMounts:    []corev1.VolumeMount{mount},
+		},
+	}, pod.Spec.InitContainers...)
+}
+
+// specHash returns the hash of the spec and annotations of the pod. The
+// environment variables and ports of the containers are built from maps, so
+// they are sorted first to not change the hash between builds.
+func specHash(pod *corev1.Pod) (string, error) {
+	spec := pod.Spec.DeepCopy()
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			sort.Slice(c.Env, func(i, j int) bool {
+				return c.Env[i].Name < c.Env[j].Name
+			})
+			sort.Slice(c.Ports, func(i, j int) bool {
+				if c.Ports[i].ContainerPort == c.Ports[j].ContainerPort {
+					return c.Ports[i].Protocol < c.Ports[j].Protocol
+				}
+				return c.Ports[i].ContainerPort < c.Ports[j].ContainerPort
+			})
+		}
+	}
+
+	b, err := json.Marshal(struct {
+		Annotations map[string]string `json:"annotations"`
+		Spec        *corev1.PodSpec   `json:"spec"`
+	}{pod.Annotations, spec})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// supervised reports if the server process within the pod is run by the
+// supervisor.
+func supervised(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == "process" {
+			return len(c.Command) > 0 && c.Command[0] == supervisorBinary
+		}
+	}
+	return false
+}
+
+// reusable reports if the existing pod of the server is able to run the server
+// process again in place of the desired pod.
+func reusable(current *corev1.Pod, desired *corev1.Pod) bool {
+	if !supervised(current) || current.DeletionTimestamp != nil || !processRunning(current) {
+		return false
+	}
+	hash := current.Annotations[SpecHashAnnotation]
+	return hash != "" && hash == desired.Annotations[SpecHashAnnotation]
+}
+
+// control sends the command to the supervisor of the server, returning if the
+// server process is running and the number of its most recent run.
+func (e *Environment) control(ctx context.Context, command string) (bool, int, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := []string{supervisorBinary, "supervise", "--socket", supervisorSocket, "--control", command}
+	if err := e.Exec(ctx, cmd, nil, &stdout, &stderr); err != nil {
+		return false, 0, errors.Wrapf(err, "environment/kubernetes: failed to control supervisor: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	status, n, _ := strings.Cut(strings.TrimSpace(stdout.String()), " ")
+	run, _ := strconv.Atoi(n)
+	return status == supervisor.StatusRunning, run, nil
+}
+
+// supervisorStatus returns the status of the supervised server process once
+// the supervisor of a pod that just started listens on its control socket.
+func (e *Environment) supervisorStatus(ctx context.Context) (bool, int, error) {
+	var running bool
+	var run int
+	var cerr error
+	err := wait.PollImmediateWithContext(ctx, time.Second/2, time.Second*30, func(ctx context.Context) (bool, error) {
+		running, run, cerr = e.control(ctx, supervisor.CommandStatus)
+		return cerr == nil, nil
+	})
+	if err != nil {
+		if cerr != nil {
+			return false, 0, cerr
+		}
+		return false, 0, errors.WithStack(err)
+	}
+	return running, run, nil
+}
+
+// startInPlace starts the server process again within its existing pod. The
+// console must already be attached, so no output of the new run is missed.
+func (e *Environment) startInPlace(ctx context.Context) error {
+	running, run, err := e.control(ctx, supervisor.CommandStart)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return errors.New("environment/kubernetes: supervisor did not start server process")
+	}
+	e.setRun(run)
+	return nil
+}
+
+// setRun stores the run of the server process the console is attached to.
+func (e *Environment) setRun(run int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.run = run
+}
+
+// currentRun returns the run of the server process the console is attached to.
+func (e *Environment) currentRun() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.run
+}
+
+// supervisedExit stores the exit state of a supervised server process, whose
+// container keeps running after the process exited. An exit code of 137 only
+// means the process was killed, so it is only reported as killed by the OOM
+// killer when the cluster terminated the container for that reason.
+func (e *Environment) supervisedExit(code int) {
+	e.mu.Lock()
+	e.exit = &exitState{code: uint32(code), oom: e.oomKilled()}
+	e.mu.Unlock()
+
+	go e.releaseIdlePod(e.currentRun())
+}
+
+// oomKilled reports if the container of the server process was terminated by
+// the OOM killer.
+func (e *Environment) oomKilled() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	pod, err := e.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, e.PodName(), metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	cs := processStatus(pod)
+	return cs != nil && cs.State.Terminated != nil && cs.State.Terminated.Reason == "OOMKilled"
+}
+
+// releaseIdlePod removes the pod of a supervised server that has not been
+// started again within the keep alive period, so that a stopped server does not
+// hold on to the resources of the node. Without fast restarts the pod is only
+// kept for long enough to be reused when crash detection restarts the server.
+func (e *Environment) releaseIdlePod(run int) {
+	keepAlive := 5
+	if cfg := config.Get().Cluster.FastRestart; cfg.Enabled {
+		keepAlive = cfg.KeepAlive
+	}
+	time.Sleep(time.Duration(keepAlive) * time.Second)
+	if e.st.Load() != environment.ProcessOfflineState {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	running, current, err := e.control(ctx, supervisor.CommandStatus)
+	if err != nil || running || current != run {
+		return
+	}
+
+	e.log().Debug("server has not been started again, removing idle pod")
+	err = e.removePod(ctx, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to remove idle pod of server")
+	}
+}
+
+// waitForSupervisedStop waits for the supervised server process to exit after
+// it has been signaled.
+func (e *Environment) waitForSupervisedStop(ctx context.Context) error {
+	for {
+		running, _, err := e.control(ctx, supervisor.CommandStatus)
+		if err != nil {
+			return err
+		}
+		if !running {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// terminateSupervised sends the signal to the supervised server process and
+// waits for it to exit.
+func (e *Environment) terminateSupervised(ctx context.Context, sig syscall.Signal) error {
+	if _, _, err := e.control(ctx, supervisor.CommandSignal+" "+strconv.Itoa(int(sig))); err != nil {
+		return err
+	}
+	tctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	return e.waitForSupervisedStop(tctx)
+}
@@ -0,0 +1,476 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// ErrVolumeNotTransferable is returned when the persistent volume of a server
+// cannot be handed over to this node, in which case the files of the server
+// must be transferred as an archive instead.
+var ErrVolumeNotTransferable = errors.Sentinel("environment/kubernetes: volume cannot be handed over to this node")
+
+// StorageTierLabel holds the name of the storage tier a persistent volume claim
+// was created with.
+const StorageTierLabel = GameServerGroup + "/storage-tier"
+
+// VolumeHandoff describes the persistent volume claim of a server that is being
+// transferred to another node managing the same cluster.
+type VolumeHandoff struct {
+	Cluster      string `json:"cluster"`
+	StorageClass string `json:"storage_class"`
+	StorageTier  string `json:"storage_tier,omitempty"`
+	Namespace    string `json:"namespace"`
+	Claim        string `json:"claim"`
+}
+
+// claimName returns the name of the persistent volume claim of the server.
+func (e *Environment) claimName() string {
+	return e.Id + "-pvc"
+}
+
+// CreateVolume creates the persistent volume claim of the server using the
+// given storage tier, sized to the disk space of the server.
+func (e *Environment) CreateVolume(ctx context.Context, tier config.StorageTier) error {
+	// Record the tier on the claim, since the labels of the server or the tiers of the node
+	// may change after the volume has been created.
+	labels := environment.ObjectLabels(e.Id)
+	labels[StorageTierLabel] = tier.Name
+	mode := corev1.PersistentVolumeMode(tier.VolumeMode)
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   e.claimName(),
+			Labels: labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.PersistentVolumeAccessMode(tier.AccessMode),
+			},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: *resource.NewQuantity(e.Configuration.Limits().DiskSpace*1024*1024, resource.BinarySI),
+				},
+			},
+			StorageClassName: &tier.StorageClass,
+			VolumeMode:       &mode,
+		},
+	}
+	if _, err := e.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to create persistent volume claim")
+	}
+	e.SetStorageTier(tier.Name)
+	return nil
+}
+
+// VolumeHandoff returns the details of the persistent volume claim of the server
+// so that it can be handed over to another node. The files pod is removed so that
+// nothing on this node continues to use the volume.
+func (e *Environment) VolumeHandoff(ctx context.Context) (*VolumeHandoff, error) {
+	cfg := config.Get().Cluster
+	if cfg.Transfers.Volume == "disabled" {
+		return nil, ErrVolumeNotTransferable
+	}
+
+	id, err := environment.ClusterIdentity(ctx, e.client)
+	if err != nil {
+		return nil, err
+	}
+
+	pvc, err := e.client.CoreV1().PersistentVolumeClaims(cfg.Namespace).Get(ctx, e.claimName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "environment/kubernetes: failed to get persistent volume claim")
+	}
+	if pvc.Status.Phase != corev1.ClaimBound || pvc.Spec.StorageClassName == nil {
+		return nil, ErrVolumeNotTransferable
+	}
+
+	var zero int64 = 0
+	err = e.client.CoreV1().Pods(cfg.Namespace).Delete(ctx, e.filesPodName(), metav1.DeleteOptions{GracePeriodSeconds: &zero})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "environment/kubernetes: failed to remove files pod")
+	}
+
+	return &VolumeHandoff{
+		Cluster:      id,
+		StorageClass: *pvc.Spec.StorageClassName,
+		StorageTier:  pvc.Labels[StorageTierLabel],
+		Namespace:    pvc.Namespace,
+		Claim:        pvc.Name,
+	}, nil
+}
+
+// CanAdoptVolume checks if a volume handed over by another node is stored in
+// the same cluster, using one of the storage classes of the storage tiers of
+// this node. ErrVolumeNotTransferable is returned if that is not the case.
+func CanAdoptVolume(ctx context.Context, h VolumeHandoff) error {
+	cfg := config.Get().Cluster
+	if cfg.Transfers.Volume == "disabled" {
+		return ErrVolumeNotTransferable
+	}
+	known := false
+	for _, c := range cfg.StorageClasses() {
+		known = known || c == h.StorageClass
+	}
+	if !known {
+		return ErrVolumeNotTransferable
+	}
+
+	_, client, err := environment.Cluster()
+	if err != nil {
+		return err
+	}
+	id, err := environment.ClusterIdentity(ctx, client)
+	if err != nil {
+		return err
+	}
+	if id != h.Cluster {
+		return ErrVolumeNotTransferable
+	}
+	return nil
+}
+
+// AdoptVolume takes over the persistent volume claim described by the handoff.
+// A claim that already has the expected name in the namespace of this node is
+// relabelled, otherwise the volume is either re-bound to a new claim created by
+// this node or cloned into it by the CSI driver, depending on the configuration.
+func (e *Environment) AdoptVolume(ctx context.Context, h VolumeHandoff) error {
+	if err := CanAdoptVolume(ctx, h); err != nil {
+		return err
+	}
+
+	cfg := config.Get().Cluster
+	claims := e.client.CoreV1().PersistentVolumeClaims(h.Namespace)
+
+	src, err := claims.Get(ctx, h.Claim, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to get persistent volume claim")
+	}
+	if src.Spec.VolumeName == "" {
+		return errors.New("environment/kubernetes: persistent volume claim is not bound to a volume")
+	}
+
+	if h.Namespace == cfg.Namespace && h.Claim == e.claimName() {
+		e.log().WithField("claim", src.Name).Debug("relabelling persistent volume claim for transfer")
+
+		for k, v := range environment.ObjectLabels(e.Id) {
+			if src.Labels == nil {
+				src.Labels = map[string]string{}
+			}
+			src.Labels[k] = v
+		}
+		src.OwnerReferences = withoutServerOwners(src.OwnerReferences)
+		if _, err := claims.Update(ctx, src, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrap(err, "environment/kubernetes: failed to update persistent volume claim")
+		}
+		return e.adoptObjects(ctx)
+	}
+
+	size := src.Spec.Resources.Requests[corev1.ResourceStorage]
+	if c, ok := src.Status.Capacity[corev1.ResourceStorage]; ok && c.Cmp(size) > 0 {
+		size = c
+	}
+	labels := environment.ObjectLabels(e.Id)
+	if tier := src.Labels[StorageTierLabel]; tier != "" {
+		labels[StorageTierLabel] = tier
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   e.claimName(),
+			Labels: labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: src.Spec.AccessModes,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+			StorageClassName: &[]string{h.StorageClass}[0],
+			VolumeMode:       src.Spec.VolumeMode,
+		},
+	}
+
+	if cfg.Transfers.Volume == "clone" {
+		return e.cloneVolume(ctx, src, pvc)
+	}
+	return e.rebindVolume(ctx, src, pvc)
+}
+
+// adoptedResources are the resources of the objects of a server that are taken
+// over along with its claim when it is transferred from a node sharing the
+// namespace of this one.
+var adoptedResources = []schema.GroupVersionResource{
+	corev1.SchemeGroupVersion.WithResource("pods"),
+	corev1.SchemeGroupVersion.WithResource("services"),
+	corev1.SchemeGroupVersion.WithResource("configmaps"),
+	networkingv1.SchemeGroupVersion.WithResource("networkpolicies"),
+	DNSEndpointResource,
+	GameServerResource,
+}
+
+// adoptObjects labels every object of the server with this node, so that they
+// are managed by this node rather than the one the server was transferred from.
+func (e *Environment) adoptObjects(ctx context.Context) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{environment.NodeLabel: config.Get().Uuid},
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	opts := metav1.ListOptions{LabelSelector: environment.ServerLabel + "=" + e.Id}
+	for _, r := range adoptedResources {
+		client := e.dynamic.Resource(r).Namespace(config.Get().Cluster.Namespace)
+		list, err := client.List(ctx, opts)
+		if err != nil {
+			// The custom resources only exist if ExternalDNS or operator mode are in use.
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "environment/kubernetes: failed to list %s", r.Resource)
+		}
+		for _, o := range list.Items {
+			if _, err := client.Patch(ctx, o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return errors.Wrapf(err, "environment/kubernetes: failed to adopt %s %s", r.Resource, o.GetName())
+			}
+		}
+	}
+	return nil
+}
+
+// cloneVolume creates the claim with the source claim as its data source. The
+// clone is only provisioned once something consumes the claim for storage classes
+// that wait for the first consumer, so the files pod is started to have the clone
+// created while the source volume is guaranteed to still exist.
+func (e *Environment) cloneVolume(ctx context.Context, src *corev1.PersistentVolumeClaim, pvc *corev1.PersistentVolumeClaim) error {
+	ns := config.Get().Cluster.Namespace
+
+	pvc.Spec.DataSourceRef = &corev1.TypedObjectReference{
+		Kind: "PersistentVolumeClaim",
+		Name: src.Name,
+	}
+	if src.Namespace != ns {
+		pvc.Spec.DataSourceRef.Namespace = &src.Namespace
+	}
+
+	e.log().WithField("claim", src.Namespace+"/"+src.Name).Debug("cloning persistent volume claim")
+	created, err := e.client.CoreV1().PersistentVolumeClaims(ns).Create(ctx, pvc, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to create persistent volume claim")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ready := make(chan error, 1)
+	go func() {
+		ready <- e.VolumeBackend("").ensure(cctx)
+	}()
+
+	if err := e.waitForClone(cctx, created); err != nil {
+		cancel()
+		<-ready
+		return err
+	}
+	return <-ready
+}
+
+// waitForClone waits for the cloned persistent volume claim to be bound. The
+// driver rejecting the clone is reported right away, rather than waiting for
+// the claim until the timeout passed.
+func (e *Environment) waitForClone(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	err := wait.PollImmediateWithContext(ctx, time.Second, time.Minute*5, func(ctx context.Context) (bool, error) {
+		current, err := e.client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if current.Status.Phase == corev1.ClaimBound {
+			return true, nil
+		}
+
+		events, err := e.client.CoreV1().Events(pvc.Namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: "involvedObject.uid=" + string(pvc.UID) + ",reason=ProvisioningFailed",
+		})
+		if err != nil {
+			return false, nil
+		}
+		for _, ev := range events.Items {
+			if ev.InvolvedObject.UID == pvc.UID && ev.Reason == "ProvisioningFailed" {
+				return false, errors.New(ev.Message)
+			}
+		}
+		return false, nil
+	})
+	return errors.Wrap(err, "environment/kubernetes: persistent volume claim was not cloned")
+}
+
+// rebindVolume moves the volume bound to the source claim over to the new claim.
+// The reclaim policy of the volume is set to Retain while the source claim is
+// removed, so that the volume and the data on it survive until the new claim is
+// bound, after which the original policy is restored.
+func (e *Environment) rebindVolume(ctx context.Context, src *corev1.PersistentVolumeClaim, pvc *corev1.PersistentVolumeClaim) error {
+	ns := config.Get().Cluster.Namespace
+	volumes := e.client.CoreV1().PersistentVolumes()
+
+	pv, err := volumes.Get(ctx, src.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: failed to get persistent volume")
+	}
+	policy := pv.Spec.PersistentVolumeReclaimPolicy
+	logger := e.log().WithField("volume", pv.Name)
+
+	logger.Debug("re-binding persistent volume for transfer")
+	if policy != corev1.PersistentVolumeReclaimRetain {
+		pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+		if pv, err = volumes.Update(ctx, pv, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrap(err, "environment/kubernetes: failed to retain persistent volume")
+		}
+	}
+
+	claims := e.client.CoreV1().PersistentVolumeClaims(src.Namespace)
+	err = claims.Delete(ctx, src.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &src.UID}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "environment/kubernetes: failed to remove persistent volume claim")
+	}
+	err = wait.PollImmediateWithContext(ctx, time.Second, time.Minute*2, func(ctx context.Context) (bool, error) {
+		_, err := claims.Get(ctx, src.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return errors.Wrap(err, "environment/kubernetes: persistent volume claim was not removed")
+	}
+
+	// Reserve the volume for the new claim right away, otherwise any pending claim in the
+	// cluster could be bound to it.
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		v, err := volumes.Get(ctx, pv.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		v.Spec.ClaimRef = &corev1.ObjectReference{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+			Namespace:  ns,
+			Name:       pvc.Name,
+		}
+		_, err = volumes.Update(ctx, v, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		logger.WithField("error", err).Error("persistent volume was released but could not be reserved, it has been retained")
+		return errors.Wrap(err, "environment/kubernetes: failed to reserve persistent volume")
+	}
+
+	pvc.Spec.VolumeName = pv.Name
+	if _, err := e.client.CoreV1().PersistentVolumeClaims(ns).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		logger.WithField("error", err).Error("persistent volume was released but could not be claimed, it has been retained")
+		return errors.Wrap(err, "environment/kubernetes: failed to create persistent volume claim")
+	}
+	if err := e.waitForClaim(ctx, ns, pvc.Name); err != nil {
+		return err
+	}
+
+	if policy != corev1.PersistentVolumeReclaimRetain {
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			v, err := volumes.Get(ctx, pv.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			v.Spec.PersistentVolumeReclaimPolicy = policy
+			_, err = volumes.Update(ctx, v, metav1.UpdateOptions{})
+			return err
+		})
+		if err != nil {
+			logger.WithField("error", err).Warn("failed to restore reclaim policy of persistent volume")
+		}
+	}
+
+	return nil
+}
+
+// StorageTier returns the name of the storage tier the volume of the server was
+// created with. Volumes created before storage tiers existed use the "default"
+// tier. Like the addresses of the server it is looked up in the background, at
+// most every five minutes.
+func (e *Environment) StorageTier() string {
+	e.mu.RLock()
+	t, at := e.storageTier, e.storageTierAt
+	e.mu.RUnlock()
+
+	if time.Since(at) > time.Minute*5 && e.storageTierLookup.SwapIf(true) {
+		go e.lookupStorageTier()
+	}
+	return t
+}
+
+func (e *Environment) lookupStorageTier() {
+	defer e.storageTierLookup.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var tier string
+	pvc, err := e.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Get(ctx, e.claimName(), metav1.GetOptions{})
+	if err == nil {
+		if tier = pvc.Labels[StorageTierLabel]; tier == "" {
+			tier = "default"
+		}
+	} else if !apierrors.IsNotFound(err) {
+		e.log().WithField("error", err).Warn("failed to look up storage tier of server")
+		return
+	}
+
+	e.SetStorageTier(tier)
+}
+
+// SetStorageTier records the storage tier of a volume that was just created for
+// the server.
+func (e *Environment) SetStorageTier(tier string) {
+	e.mu.Lock()
+	e.storageTier, e.storageTierAt = tier, time.Now()
+	e.mu.Unlock()
+}
+
+// waitForClaim waits for the given persistent volume claim to be bound.
+func (e *Environment) waitForClaim(ctx context.Context, namespace string, name string) error {
+	err := wait.PollImmediateWithContext(ctx, time.Second, time.Minute*5, func(ctx context.Context) (bool, error) {
+		pvc, err := e.client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pvc.Status.Phase == corev1.ClaimBound, nil
+	})
+	return errors.Wrap(err, "environment/kubernetes: persistent volume claim was not bound")
+}
+
+// adoptedElsewhere reports if the persistent volume claim of the server has been
+// taken over by another node sharing the namespace of this one, in which case the
+// objects of the server in the cluster no longer belong to this node.
+func (e *Environment) adoptedElsewhere(ctx context.Context) bool {
+	pvc, err := e.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Get(ctx, e.claimName(), metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	node, ok := pvc.Labels[environment.NodeLabel]
+	return ok && node != config.Get().Uuid
+}
@@ -18,6 +18,17 @@ type Allocations struct {
 	// Mappings contains all the ports that should be assigned to a given server
 	// attached to the IP they correspond to.
 	AdditionalPorts []string `json:"additional_ports"`
+
+	// IPv6 holds the ports assigned to the server for IPv6 when the Panel allocates them
+	// separately, the ports above are then only used for IPv4. The server process keeps
+	// listening on the ports above, which the IPv6 ports are mapped onto in order.
+	IPv6 *FamilyAllocations `json:"ipv6,omitempty"`
+}
+
+// FamilyAllocations are the ports assigned to a server for a single IP family.
+type FamilyAllocations struct {
+	DefaultPort     int      `json:"default_port"`
+	AdditionalPorts []string `json:"additional_ports"`
 }
 
 // Converts the server allocation mappings into a format that can be understood by Docker. While
@@ -49,3 +60,11 @@ func (a *Allocations) Bindings() nat.PortMap {
 
 	return out
 }
+
+// Addresses are the addresses a server is reachable at, by IP family. Load
+// balancers that are only reachable by a hostname are listed separately.
+type Addresses struct {
+	IPv4      []string `json:"ipv4"`
+	IPv6      []string `json:"ipv6"`
+	Hostnames []string `json:"hostnames,omitempty"`
+}
@@ -59,6 +59,19 @@ type Limits struct {
 	OOMDisabled bool `json:"oom_disabled"`
 }
 
+// EnforcedLimits reports which limits of a server are applied by the environment
+// the server is running in. A limit is enforced when the server process runs with
+// exactly the configured value, limits that are not enforced are still reported
+// to the Panel but have no effect on the process.
+type EnforcedLimits struct {
+	Memory      bool `json:"memory"`
+	Cpu         bool `json:"cpu"`
+	Threads     bool `json:"threads"`
+	Swap        bool `json:"swap"`
+	IoWeight    bool `json:"io_weight"`
+	OOMDisabled bool `json:"oom_disabled"`
+}
+
 // ConvertedCpuLimit converts the CPU limit for a server build into a number
 // that can be better understood by the Docker environment. If there is no limit
 // set, return -1 which will indicate to Docker that it has unlimited CPU quota.
@@ -22,6 +22,16 @@ type Stats struct {
 
 	// The current uptime of the container, in milliseconds.
 	Uptime int64 `json:"uptime"`
+
+	// The resource usage of the sidecars running next to the server process, keyed by the
+	// name of the sidecar. This usage is not included in the values above.
+	Sidecars map[string]SidecarStats `json:"sidecars,omitempty"`
+}
+
+// SidecarStats defines the current resource usage of a single sidecar container.
+type SidecarStats struct {
+	Memory      uint64  `json:"memory_bytes"`
+	CpuAbsolute float64 `json:"cpu_absolute"`
 }
 
 type NetworkStats struct {
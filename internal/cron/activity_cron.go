@@ -5,8 +5,6 @@ import (
 
 	"emperror.dev/errors"
 
-	"github.com/kubectyl/kuber/internal/database"
-	"github.com/kubectyl/kuber/internal/models"
 	"github.com/kubectyl/kuber/server"
 	"github.com/kubectyl/kuber/system"
 )
@@ -14,11 +12,12 @@ import (
 type activityCron struct {
 	mu      *system.AtomicBool
 	manager *server.Manager
+	store   activityStore
 	max     int
 }
 
 // Run executes the cronjob and ensures we fetch and send all of the stored activity to the
-// Panel instance. Once activity is sent it is deleted from the local database instance. Any
+// Panel instance. Once activity is sent it is deleted from the store it was read from. Any
 // SFTP specific events are not handled in this cron, they're handled seperately to account
 // for de-duplication and event merging.
 func (ac *activityCron) Run(ctx context.Context) error {
@@ -29,14 +28,9 @@ func (ac *activityCron) Run(ctx context.Context) error {
 	}
 	defer ac.mu.Store(false)
 
-	var activity []models.Activity
-	tx := database.Instance().WithContext(ctx).
-		Where("event NOT LIKE ?", "server:sftp.%").
-		Limit(ac.max).
-		Find(&activity)
-
-	if tx.Error != nil {
-		return errors.WithStack(tx.Error)
+	activity, err := ac.store.Find(ctx, false, 0, ac.max)
+	if err != nil {
+		return err
 	}
 	if len(activity) == 0 {
 		return nil
@@ -51,9 +45,5 @@ func (ac *activityCron) Run(ctx context.Context) error {
 		ids = append(ids, v.ID)
 	}
 
-	tx = database.Instance().WithContext(ctx).Where("id IN ?", ids).Delete(&models.Activity{})
-	if tx.Error != nil {
-		return errors.WithStack(tx.Error)
-	}
-	return nil
+	return ac.store.Delete(ctx, ids)
 }
@@ -9,6 +9,9 @@ import (
 	"github.com/go-co-op/gocron"
 
 	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/internal/prepull"
+	"github.com/kubectyl/kuber/internal/reconciler"
 	"github.com/kubectyl/kuber/server"
 	"github.com/kubectyl/kuber/system"
 )
@@ -29,15 +32,24 @@ func Scheduler(ctx context.Context, m *server.Manager) (*gocron.Scheduler, error
 		return nil, errors.Wrap(err, "cron: failed to parse configured system timezone")
 	}
 
+	// In high availability mode every replica stores its activity in the cluster, so that it
+	// is not lost along with the replica, and only the leader sends it to the Panel.
+	var store activityStore = databaseStore{}
+	if ha.Enabled() {
+		store = newClusterStore()
+	}
+
 	activity := activityCron{
 		mu:      system.NewAtomicBool(false),
 		manager: m,
+		store:   store,
 		max:     config.Get().System.ActivitySendCount,
 	}
 
 	sftp := sftpCron{
 		mu:      system.NewAtomicBool(false),
 		manager: m,
+		store:   store,
 		max:     config.Get().System.ActivitySendCount,
 	}
 
@@ -48,6 +60,9 @@ func Scheduler(ctx context.Context, m *server.Manager) (*gocron.Scheduler, error
 	l.WithField("interval", interval).Info("configuring system crons")
 
 	_, _ = s.Tag("activity").Every(interval).Do(func() {
+		if !ha.IsLeader() {
+			return
+		}
 		l.WithField("cron", "activity").Debug("sending internal activity events to Panel")
 		if err := activity.Run(ctx); err != nil {
 			if errors.Is(err, ErrCronRunning) {
@@ -59,6 +74,9 @@ func Scheduler(ctx context.Context, m *server.Manager) (*gocron.Scheduler, error
 	})
 
 	_, _ = s.Tag("sftp").Every(interval).Do(func() {
+		if !ha.IsLeader() {
+			return
+		}
 		l.WithField("cron", "sftp").Debug("sending sftp events to Panel")
 		if err := sftp.Run(ctx); err != nil {
 			if errors.Is(err, ErrCronRunning) {
@@ -69,5 +87,45 @@ func Scheduler(ctx context.Context, m *server.Manager) (*gocron.Scheduler, error
 		}
 	})
 
+	if rc := config.Get().Cluster.Reconciliation; rc.Enabled {
+		_, _ = s.Tag("reconcile").Every(time.Duration(rc.Interval) * time.Second).Do(func() {
+			l.WithField("cron", "reconcile").Debug("reconciling cluster objects for this node")
+			if err := reconciler.Instance().Run(ctx); err != nil {
+				if errors.Is(err, ha.ErrNotLeader) {
+					l.WithField("cron", "reconcile").Debug("replica is not the leader, skipping reconciliation...")
+				} else if errors.Is(err, reconciler.ErrReconcilerRunning) {
+					l.WithField("cron", "reconcile").Warn("reconciliation process is already running, skipping...")
+				} else {
+					l.WithField("cron", "reconcile").WithField("error", err).Error("reconciliation process failed to execute")
+				}
+			}
+		})
+	}
+
+	if pp := config.Get().Cluster.Images.PrePull; pp.Enabled {
+		_, _ = s.Tag("prepull").Every(time.Duration(pp.Interval) * time.Second).Do(func() {
+			l.WithField("cron", "prepull").Debug("updating images pre-pulled onto the cluster")
+			if err := prepull.Instance().Run(ctx); err != nil {
+				if errors.Is(err, ha.ErrNotLeader) {
+					l.WithField("cron", "prepull").Debug("replica is not the leader, skipping image pre-pull...")
+				} else if errors.Is(err, prepull.ErrPrePullRunning) {
+					l.WithField("cron", "prepull").Warn("image pre-pull process is already running, skipping...")
+				} else {
+					l.WithField("cron", "prepull").WithField("error", err).Error("image pre-pull process failed to execute")
+				}
+			}
+		})
+	}
+
+	// Replicas attach to server processes started by one another, so this runs on every
+	// replica rather than only on the leader.
+	if ha.Enabled() {
+		_, _ = s.Tag("states").Every(5 * time.Second).Do(func() {
+			if err := m.SyncStates(ctx); err != nil {
+				l.WithField("cron", "states").WithField("error", err).Error("failed to sync server states from other replicas")
+			}
+		})
+	}
+
 	return s, nil
 }
@@ -6,7 +6,6 @@ import (
 
 	"emperror.dev/errors"
 
-	"github.com/kubectyl/kuber/internal/database"
 	"github.com/kubectyl/kuber/internal/models"
 	"github.com/kubectyl/kuber/server"
 	"github.com/kubectyl/kuber/system"
@@ -15,6 +14,7 @@ import (
 type sftpCron struct {
 	mu      *system.AtomicBool
 	manager *server.Manager
+	store   activityStore
 	max     int
 }
 
@@ -83,10 +83,7 @@ func (sc *sftpCron) Run(ctx context.Context) error {
 	if err := sc.manager.Client().SendActivityLogs(ctx, events.Elements()); err != nil {
 		return errors.Wrap(err, "failed to send sftp activity logs to Panel")
 	}
-	if tx := database.Instance().Where("id IN ?", events.ids).Delete(&models.Activity{}); tx.Error != nil {
-		return errors.WithStack(tx.Error)
-	}
-	return nil
+	return sc.store.Delete(ctx, events.ids)
 }
 
 // fetchRecords returns a group of activity events starting at the given offset. This is used
@@ -94,17 +91,8 @@ func (sc *sftpCron) Run(ctx context.Context) error {
 // fill up our request to the given maximum. This is due to the fact that this cron merges any
 // activity that line up across user, server, ip, and event into a single activity record when
 // sending the data to the Panel.
-func (sc *sftpCron) fetchRecords(ctx context.Context, offset int) (activity []models.Activity, err error) {
-	tx := database.Instance().WithContext(ctx).
-		Where("event LIKE ?", "server:sftp.%").
-		Order("event DESC").
-		Offset(offset).
-		Limit(sc.max).
-		Find(&activity)
-	if tx.Error != nil {
-		err = errors.WithStack(tx.Error)
-	}
-	return
+func (sc *sftpCron) fetchRecords(ctx context.Context, offset int) ([]models.Activity, error) {
+	return sc.store.Find(ctx, true, offset, sc.max)
 }
 
 // Push adds an activity to the event mapping, or de-duplicates it and merges the files metadata
@@ -0,0 +1,118 @@
+package cron
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+
+	"github.com/kubectyl/kuber/internal/database"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/internal/models"
+)
+
+// activityStore holds the activity events that have not been sent to the Panel
+// yet.
+type activityStore interface {
+	// Find returns at most limit events, skipping over the first offset events. Either
+	// only the SFTP events are returned, or only the other events.
+	Find(ctx context.Context, sftp bool, offset int, limit int) ([]models.Activity, error)
+	// Delete removes the events with the given IDs once they were sent.
+	Delete(ctx context.Context, ids []int) error
+}
+
+// databaseStore keeps the activity in the local database of this instance.
+type databaseStore struct{}
+
+func (databaseStore) Find(ctx context.Context, sftp bool, offset int, limit int) ([]models.Activity, error) {
+	var activity []models.Activity
+	tx := database.Instance().WithContext(ctx)
+	if sftp {
+		tx = tx.Where("event LIKE ?", "server:sftp.%").Order("event DESC").Offset(offset)
+	} else {
+		tx = tx.Where("event NOT LIKE ?", "server:sftp.%").Offset(offset)
+	}
+	if tx = tx.Limit(limit).Find(&activity); tx.Error != nil {
+		return nil, errors.WithStack(tx.Error)
+	}
+	return activity, nil
+}
+
+func (databaseStore) Delete(ctx context.Context, ids []int) error {
+	if tx := database.Instance().WithContext(ctx).Where("id IN ?", ids).Delete(&models.Activity{}); tx.Error != nil {
+		return errors.WithStack(tx.Error)
+	}
+	return nil
+}
+
+// clusterStore reads the activity that the replicas of this node stored in the
+// cluster in high availability mode. Events are identified by their key in the
+// cluster, which is mapped onto an ID for the lifetime of this instance.
+type clusterStore struct {
+	mu   sync.Mutex
+	ids  map[string]int
+	keys map[int]string
+	next int
+}
+
+func newClusterStore() *clusterStore {
+	return &clusterStore{ids: make(map[string]int), keys: make(map[int]string)}
+}
+
+func (cs *clusterStore) Find(ctx context.Context, sftp bool, offset int, limit int) ([]models.Activity, error) {
+	pending, err := ha.ReadActivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var out []models.Activity
+	for _, p := range pending {
+		if strings.HasPrefix(string(p.Activity.Event), "server:sftp.") != sftp {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(out) >= limit {
+			break
+		}
+		id, ok := cs.ids[p.Key]
+		if !ok {
+			cs.next++
+			id = cs.next
+			cs.ids[p.Key], cs.keys[id] = id, p.Key
+		}
+		a := p.Activity
+		a.ID = id
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func (cs *clusterStore) Delete(ctx context.Context, ids []int) error {
+	cs.mu.Lock()
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if k, ok := cs.keys[id]; ok {
+			keys = append(keys, k)
+		}
+	}
+	cs.mu.Unlock()
+
+	if err := ha.RemoveActivity(ctx, keys); err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	for _, id := range ids {
+		delete(cs.ids, cs.keys[id])
+		delete(cs.keys, id)
+	}
+	cs.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,120 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/internal/models"
+)
+
+var activitySequence uint64
+
+// PendingActivity is an activity event that has not been sent to the Panel yet.
+type PendingActivity struct {
+	Key      string
+	Activity models.Activity
+}
+
+// activityName returns the name of the ConfigMap holding the activity of the
+// servers on this node that has not been sent to the Panel yet.
+func activityName() string {
+	return "kuber-activity-" + config.Get().Uuid
+}
+
+// PushActivity stores an activity event in the cluster so that it is sent to
+// the Panel by the leader, even if the replica that recorded it goes away.
+func PushActivity(ctx context.Context, a *models.Activity) error {
+	if err := a.BeforeCreate(nil); err != nil {
+		return errors.WithStack(err)
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Keys sort in the order the events were recorded in, the identity and sequence keep
+	// events recorded at the same time by different replicas apart.
+	key := fmt.Sprintf("%020d.%s.%d", a.Timestamp.UnixNano(), identity, atomic.AddUint64(&activitySequence, 1))
+	return patchActivity(ctx, map[string]interface{}{key: string(b)})
+}
+
+// ReadActivity returns every activity event that has not been sent to the Panel
+// yet, in the order they were recorded in.
+func ReadActivity(ctx context.Context) ([]PendingActivity, error) {
+	cm, err := client.CoreV1().ConfigMaps(config.Get().Cluster.Namespace).Get(ctx, activityName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "ha: failed to read activity")
+	}
+
+	out := make([]PendingActivity, 0, len(cm.Data))
+	for k, v := range cm.Data {
+		var a models.Activity
+		if err := json.Unmarshal([]byte(v), &a); err != nil {
+			return nil, errors.Wrap(err, "ha: failed to parse activity")
+		}
+		out = append(out, PendingActivity{Key: k, Activity: a})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// RemoveActivity removes the given activity events once they were sent to the
+// Panel.
+func RemoveActivity(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	data := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		data[k] = nil
+	}
+	return patchActivity(ctx, data)
+}
+
+// patchActivity merges the given keys into the activity ConfigMap, creating it
+// if it does not exist yet. Only the given keys are modified so that replicas
+// never overwrite events written by each other.
+func patchActivity(ctx context.Context, data map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cms := client.CoreV1().ConfigMaps(config.Get().Cluster.Namespace)
+	_, err = cms.Patch(ctx, activityName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "ha: failed to write activity")
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   activityName(),
+			Labels: map[string]string{environment.NodeLabel: config.Get().Uuid},
+		},
+	}
+	// Another replica may have created it in the meantime, the patch is applied to the
+	// existing ConfigMap in that case.
+	if _, err := cms.Create(ctx, cm, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "ha: failed to write activity")
+	}
+	if _, err := cms.Patch(ctx, activityName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return errors.Wrap(err, "ha: failed to write activity")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package ha
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/system"
+)
+
+const ErrNotLeader = errors.Sentinel("ha: this replica is not the leader")
+
+var (
+	o        system.AtomicBool
+	client   *kubernetes.Clientset
+	identity string
+	leader   = system.NewAtomicBool(false)
+)
+
+// Initialize configures high availability mode for the application. This should
+// only be called once during the application lifecycle, and only when high
+// availability is enabled in the configuration.
+func Initialize() error {
+	if !o.SwapIf(true) {
+		panic("ha: attempt to initialize more than once during application lifecycle")
+	}
+	_, c, err := environment.Cluster()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	client = c
+
+	identity = config.Get().Cluster.HighAvailability.Identity
+	if identity == "" {
+		identity = os.Getenv("POD_NAME")
+	}
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return errors.Wrap(err, "ha: failed to determine replica identity")
+		}
+	}
+	return nil
+}
+
+// Enabled returns true if this instance is running in high availability mode.
+func Enabled() bool {
+	return client != nil
+}
+
+// Identity returns the unique name of this replica.
+func Identity() string {
+	return identity
+}
+
+// IsLeader returns true if this replica is currently the elected leader. When not
+// running in high availability mode the instance is always considered the leader.
+func IsLeader() bool {
+	if !Enabled() {
+		return true
+	}
+	return leader.Load()
+}
+
+// Run participates in leader election until the context is canceled. Once this
+// replica becomes the leader the provided callback is executed with a context
+// that is canceled as soon as leadership is lost.
+func Run(ctx context.Context, onStartedLeading func(ctx context.Context)) {
+	cfg := config.Get().Cluster.HighAvailability
+	l := log.WithFields(log.Fields{"subsystem": "ha", "identity": identity})
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      "kuber-" + config.Get().Uuid,
+			Namespace: config.Get().Cluster.Namespace,
+			Labels:    map[string]string{environment.NodeLabel: config.Get().Uuid},
+		},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	for {
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   time.Duration(cfg.LeaseDuration) * time.Second,
+			RenewDeadline:   time.Duration(cfg.RenewDeadline) * time.Second,
+			RetryPeriod:     time.Duration(cfg.RetryPeriod) * time.Second,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					l.Info("acquired leadership for this node")
+					leader.Store(true)
+					if onStartedLeading != nil {
+						onStartedLeading(ctx)
+					}
+				},
+				OnStoppedLeading: func() {
+					l.Warn("lost leadership for this node")
+					leader.Store(false)
+				},
+				OnNewLeader: func(id string) {
+					if id != identity {
+						l.WithField("leader", id).Info("observed new leader for this node")
+					}
+				},
+			},
+		})
+		if err != nil {
+			l.WithField("error", err).Fatal("failed to configure leader election")
+		}
+
+		le.Run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(cfg.RetryPeriod) * time.Second):
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package ha
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/system"
+)
+
+// The amount of time a lock is held without being renewed before it is considered
+// to be abandoned by the replica holding it.
+const lockDuration = time.Second * 30
+
+// The amount of time the state of a lock held by another replica is cached for
+// before the Lease is read again.
+const lockCacheDuration = time.Second * 5
+
+// Lock is an exclusive lock shared between all replicas of this node, backed by a
+// Lease in the cluster. While the lock is held it is renewed in the background so
+// that long-running actions do not lose it.
+type Lock struct {
+	mu     sync.Mutex
+	name   string
+	server string
+	cancel context.CancelFunc
+
+	// The state of the Lease as it was last observed, which is kept up to date by the
+	// renew loop while this replica holds the lock.
+	state   sync.Mutex
+	locked  bool
+	holding bool
+	checked time.Time
+}
+
+// NewLock returns a lock for the given server that is shared between replicas
+// under the given name.
+func NewLock(name string, server string) *Lock {
+	return &Lock{name: "kuber-" + name + "-" + server, server: server}
+}
+
+// IsLocked returns true if any replica currently holds the lock. The Lease is
+// only read if this replica does not hold the lock and its state was not read
+// recently.
+func (l *Lock) IsLocked(ctx context.Context) bool {
+	l.state.Lock()
+	defer l.state.Unlock()
+	if l.holding || time.Since(l.checked) < lockCacheDuration {
+		return l.holding || l.locked
+	}
+
+	lease, err := client.CoordinationV1().Leases(config.Get().Cluster.Namespace).Get(ctx, l.name, metav1.GetOptions{})
+	l.locked = err == nil && held(lease)
+	l.checked = time.Now()
+	return l.locked
+}
+
+// observe stores the state of the Lease after it was read or written by this
+// replica.
+func (l *Lock) observe(holding bool, locked bool) {
+	l.state.Lock()
+	l.holding = holding
+	l.locked = locked
+	l.checked = time.Now()
+	l.state.Unlock()
+}
+
+// Acquire attempts to acquire the lock a single time. If another replica holds
+// the lock system.ErrLockerLocked is returned.
+func (l *Lock) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The lock is not reentrant, even for the replica holding it.
+	if l.cancel != nil {
+		return system.ErrLockerLocked
+	}
+
+	leases := client.CoordinationV1().Leases(config.Get().Cluster.Namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "ha: failed to get lock")
+		}
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   l.name,
+				Labels: environment.ObjectLabels(l.server),
+			},
+		}
+		l.claim(lease)
+		if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				l.observe(false, true)
+				return system.ErrLockerLocked
+			}
+			return errors.Wrap(err, "ha: failed to create lock")
+		}
+	} else {
+		if held(lease) && *lease.Spec.HolderIdentity != identity {
+			l.observe(false, true)
+			return system.ErrLockerLocked
+		}
+		l.claim(lease)
+		if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			if apierrors.IsConflict(err) {
+				l.observe(false, true)
+				return system.ErrLockerLocked
+			}
+			return errors.Wrap(err, "ha: failed to update lock")
+		}
+	}
+	l.observe(true, true)
+
+	rctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.renew(rctx)
+
+	return nil
+}
+
+// TryAcquire attempts to acquire the lock until the context provided is
+// canceled.
+func (l *Lock) TryAcquire(ctx context.Context) error {
+	for {
+		err := l.Acquire(ctx)
+		if err == nil || !errors.Is(err, system.ErrLockerLocked) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return system.ErrLockerLocked
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Release releases the lock if it is held by this replica.
+func (l *Lock) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancel == nil {
+		return
+	}
+	l.cancel()
+	l.cancel = nil
+	l.observe(false, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	leases := client.CoordinationV1().Leases(config.Get().Cluster.Namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != identity {
+		return
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	_, _ = leases.Update(ctx, lease, metav1.UpdateOptions{})
+}
+
+func (l *Lock) renew(ctx context.Context) {
+	ticker := time.NewTicker(lockDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			leases := client.CoordinationV1().Leases(config.Get().Cluster.Namespace)
+			lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+			if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != identity {
+				// The lock was lost, most likely because the Lease could not be renewed in
+				// time and another replica took it over.
+				if ctx.Err() == nil {
+					l.observe(false, err == nil && held(lease))
+				}
+				return
+			}
+			l.claim(lease)
+			_, _ = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		}
+	}
+}
+
+// claim marks the lease as being held by this replica.
+func (l *Lock) claim(lease *coordinationv1.Lease) {
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(lockDuration.Seconds())
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+	if lease.Spec.AcquireTime == nil {
+		lease.Spec.AcquireTime = &now
+	}
+}
+
+// held returns true if the lease is held by a replica and has not expired.
+func held(lease *coordinationv1.Lease) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || lease.Spec.RenewTime == nil {
+		return false
+	}
+	d := lockDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		d = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return lease.Spec.RenewTime.Add(d).After(time.Now())
+}
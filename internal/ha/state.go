@@ -0,0 +1,73 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+)
+
+// statesName returns the name of the ConfigMap holding the states of the servers
+// on this node.
+func statesName() string {
+	return "kuber-states-" + config.Get().Uuid
+}
+
+// ReadStates returns the last state written for every server on this node.
+func ReadStates(ctx context.Context) (map[string]string, error) {
+	cm, err := client.CoreV1().ConfigMaps(config.Get().Cluster.Namespace).Get(ctx, statesName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, errors.Wrap(err, "ha: failed to read server states")
+	}
+	if cm.Data == nil {
+		return map[string]string{}, nil
+	}
+	return cm.Data, nil
+}
+
+// WriteState stores the state of a single server so that it is visible to all
+// the other replicas. Only the given server is modified so that replicas never
+// overwrite states written by each other.
+func WriteState(ctx context.Context, uuid string, state string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": map[string]string{uuid: state},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cms := client.CoreV1().ConfigMaps(config.Get().Cluster.Namespace)
+	_, err = cms.Patch(ctx, statesName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "ha: failed to write server state")
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   statesName(),
+			Labels: map[string]string{environment.NodeLabel: config.Get().Uuid},
+		},
+		Data: map[string]string{uuid: state},
+	}
+	if _, err := cms.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+		// Another replica created it in the meantime, just try the patch again.
+		if apierrors.IsAlreadyExists(err) {
+			return WriteState(ctx, uuid, state)
+		}
+		return errors.Wrap(err, "ha: failed to write server state")
+	}
+	return nil
+}
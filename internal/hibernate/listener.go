@@ -0,0 +1,144 @@
+// Package hibernate implements the listener that answers on the ports of a
+// hibernating server. The listener runs in its own pod and reports the first
+// client reaching the server, which is used by Kuber to start the server again.
+package hibernate
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+)
+
+// WakeMessage is written to the output of the listener when a client reaches
+// one of the ports of the server.
+const WakeMessage = "wake"
+
+// ProtocolMinecraft answers server list pings with a status showing the server
+// is starting, and disconnects players attempting to join with a message.
+const ProtocolMinecraft = "minecraft"
+
+// Listener answers on the ports of a hibernating server.
+type Listener struct {
+	// Ports are the ports to listen on, in the format of "tcp:25565" or "udp:25565".
+	Ports []string
+
+	// Protocol is the protocol spoken with clients connecting over TCP, only clients
+	// speaking it wake the server. Without a protocol any client sending data does.
+	Protocol string
+
+	// Message is shown to clients where the protocol allows it.
+	Message string
+
+	// OnWake is called once when the first client sends data.
+	OnWake func()
+
+	once sync.Once
+}
+
+// Listen starts listening on all the ports of the listener and blocks until the
+// context is canceled.
+func (l *Listener) Listen(ctx context.Context) error {
+	var wg sync.WaitGroup
+	var lc net.ListenConfig
+	for _, p := range l.Ports {
+		proto, port, ok := strings.Cut(p, ":")
+		if _, err := strconv.Atoi(port); !ok || err != nil {
+			return errors.Errorf("hibernate: invalid port \"%s\"", p)
+		}
+
+		switch proto {
+		case "tcp":
+			ln, err := lc.Listen(ctx, "tcp", ":"+port)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.serveTCP(ctx, ln)
+			}()
+		case "udp":
+			pc, err := lc.ListenPacket(ctx, "udp", ":"+port)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.serveUDP(ctx, pc)
+			}()
+		default:
+			return errors.Errorf("hibernate: invalid port \"%s\"", p)
+		}
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (l *Listener) wake() {
+	l.once.Do(l.OnWake)
+}
+
+func (l *Listener) serveTCP(ctx context.Context, ln net.Listener) {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithField("error", err).Warn("failed to accept connection")
+			}
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(time.Second * 10))
+			if l.Protocol == ProtocolMinecraft {
+				if err := l.serveMinecraft(conn); err != nil {
+					log.WithField("error", err).Debug("failed to answer minecraft client")
+				}
+				return
+			}
+			// Connections that never send anything, such as port scans or the health checks
+			// of load balancers, do not wake the server.
+			if n, _ := conn.Read(make([]byte, 1)); n > 0 {
+				l.wake()
+			}
+		}()
+	}
+}
+
+// serveUDP wakes the server on the first datagram with a payload received. Datagrams
+// are never answered since there is no way to tell a client to retry in a way it
+// understands.
+func (l *Listener) serveUDP(ctx context.Context, pc net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithField("error", err).Warn("failed to read datagram")
+			}
+			return
+		}
+		if n > 0 {
+			l.wake()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package hibernate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"emperror.dev/errors"
+	"github.com/goccy/go-json"
+)
+
+// The states a Minecraft client can request in its handshake.
+const (
+	minecraftStatus = 1
+	minecraftLogin  = 2
+)
+
+// serveMinecraft answers a client speaking the Minecraft Java Edition protocol.
+// Server list pings get a status showing the message, and clients attempting to
+// join are disconnected with the message. Both wake the server, anything else
+// does not.
+func (l *Listener) serveMinecraft(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+
+	// Handshake: protocol version, server address, server port and the next state.
+	id, p, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if id != 0x00 {
+		return errors.New("hibernate: expected minecraft handshake")
+	}
+	version, err := binary.ReadUvarint(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	n, err := binary.ReadUvarint(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.CopyN(io.Discard, p, int64(n)+2); err != nil {
+		return errors.WithStack(err)
+	}
+	next, err := binary.ReadUvarint(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if next != minecraftStatus && next != minecraftLogin {
+		return errors.New("hibernate: unknown minecraft handshake state")
+	}
+	l.wake()
+
+	text, err := json.Marshal(map[string]string{"text": l.Message})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch next {
+	case minecraftStatus:
+		if _, _, err := readPacket(r); err != nil {
+			return err
+		}
+		status, err := json.Marshal(map[string]interface{}{
+			"version":     map[string]interface{}{"name": "Hibernating", "protocol": version},
+			"players":     map[string]int{"max": 0, "online": 0},
+			"description": json.RawMessage(text),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := writePacket(conn, 0x00, minecraftString(status)); err != nil {
+			return err
+		}
+		// Answer the ping that follows the status so the client is able to show a latency.
+		id, p, err := readPacket(r)
+		if err != nil || id != 0x01 {
+			return err
+		}
+		payload, _ := io.ReadAll(p)
+		return writePacket(conn, 0x01, payload)
+	case minecraftLogin:
+		return writePacket(conn, 0x00, minecraftString(text))
+	}
+	return nil
+}
+
+// readPacket reads a length prefixed packet and returns its id and data.
+func readPacket(r *bufio.Reader) (uint64, *bytes.Reader, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	if length == 0 || length > 1<<16 {
+		return 0, nil, errors.New("hibernate: invalid minecraft packet length")
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	p := bytes.NewReader(b)
+	id, err := binary.ReadUvarint(p)
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	return id, p, nil
+}
+
+// writePacket writes a length prefixed packet with the given id and data.
+func writePacket(w io.Writer, id uint64, data []byte) error {
+	body := append(uvarint(id), data...)
+	_, err := w.Write(append(uvarint(uint64(len(body))), body...))
+	return errors.WithStack(err)
+}
+
+// minecraftString encodes a string as it is sent within a packet.
+func minecraftString(s []byte) []byte {
+	return append(uvarint(uint64(len(s))), s...)
+}
+
+func uvarint(v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, v)]
+}
@@ -0,0 +1,333 @@
+// Package prepull manages the DaemonSet that pulls the images used by servers
+// onto the nodes of the cluster. Every image runs as a container of the
+// DaemonSet, which keeps it in use so that it is never garbage collected by the
+// node, and allows servers to start without waiting for the registry.
+package prepull
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	k8s "github.com/kubectyl/kuber/environment/kubernetes"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/server"
+	"github.com/kubectyl/kuber/system"
+)
+
+const ErrPrePullRunning = errors.Sentinel("prepull: already running")
+
+// The path the kuber binary is copied to within the containers of the DaemonSet.
+const binaryPath = "/prepull/kuber"
+
+// The reasons a container waits with when its image could not be pulled.
+var pullErrors = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+var (
+	o        system.AtomicBool
+	instance *PrePuller
+)
+
+// ImageStatus is the state of a single pre-pulled image across the nodes of
+// the cluster.
+type ImageStatus struct {
+	Image string `json:"image"`
+	// Nodes is the number of nodes the image should be pulled onto.
+	Nodes int `json:"nodes"`
+	// Ready is the number of nodes the image has been pulled onto.
+	Ready int `json:"ready"`
+	// Failed is the number of nodes that were unable to pull the image.
+	Failed int      `json:"failed"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Status is the current state of the pre-pulled images as returned by the API.
+type Status struct {
+	Enabled bool          `json:"enabled"`
+	Leader  bool          `json:"leader"`
+	Running bool          `json:"running"`
+	LastRun time.Time     `json:"last_run"`
+	Images  []ImageStatus `json:"images"`
+}
+
+// PrePuller keeps the DaemonSet pulling images onto the nodes of the cluster
+// in sync with the images used by servers.
+type PrePuller struct {
+	mu      sync.Mutex
+	manager *server.Manager
+	client  *kubernetes.Clientset
+	running *system.AtomicBool
+	lastRun time.Time
+}
+
+// Initialize configures the pre-puller for the application. This should only be
+// called once during the application lifecycle.
+func Initialize(m *server.Manager) error {
+	if !o.SwapIf(true) {
+		panic("prepull: attempt to initialize more than once during application lifecycle")
+	}
+	_, c, err := environment.Cluster()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	instance = &PrePuller{
+		manager: m,
+		client:  c,
+		running: system.NewAtomicBool(false),
+	}
+	return nil
+}
+
+// Instance returns the pre-puller instance that was configured when the
+// application was booted.
+func Instance() *PrePuller {
+	if instance == nil {
+		panic("prepull: attempt to access instance before initialized")
+	}
+	return instance
+}
+
+// Images returns the distinct images that should be pre-pulled, sorted by name.
+func (p *PrePuller) Images(ctx context.Context) ([]string, error) {
+	cfg := config.Get().Cluster.Images.PrePull
+
+	images := make(map[string]bool)
+	for _, v := range cfg.Images {
+		images[v] = true
+	}
+	for _, s := range p.manager.All() {
+		images[s.Config().Container.Image] = true
+	}
+	if cfg.Eggs {
+		eggs, err := p.manager.Client().GetEggImages(ctx)
+		if err != nil {
+			return nil, errors.WrapIf(err, "prepull: failed to get egg images from Panel")
+		}
+		for _, v := range eggs {
+			images[v] = true
+		}
+	}
+	delete(images, "")
+
+	out := make([]string, 0, len(images))
+	for v := range images {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Run updates the DaemonSet to pre-pull the images currently in use, removing
+// it if there are no images to pull.
+func (p *PrePuller) Run(ctx context.Context) error {
+	// Only a single replica may modify the cluster at a time.
+	if !ha.IsLeader() {
+		return errors.WithStack(ha.ErrNotLeader)
+	}
+	if !p.running.SwapIf(true) {
+		return errors.WithStack(ErrPrePullRunning)
+	}
+	defer p.running.Store(false)
+
+	images, err := p.Images(ctx)
+	if err != nil {
+		return err
+	}
+
+	daemonsets := p.client.AppsV1().DaemonSets(config.Get().Cluster.Namespace)
+	current, err := daemonsets.Get(ctx, name(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "prepull: failed to get daemonset")
+	}
+	exists := err == nil
+
+	if len(images) == 0 {
+		if exists {
+			err := daemonsets.Delete(ctx, name(), metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return errors.Wrap(err, "prepull: failed to delete daemonset")
+			}
+		}
+		p.finish()
+		return nil
+	}
+
+	ds := p.daemonSet(images)
+	if !exists {
+		if _, err := daemonsets.Create(ctx, ds, metav1.CreateOptions{}); err != nil {
+			return errors.Wrap(err, "prepull: failed to create daemonset")
+		}
+		p.log().WithField("images", len(images)).Info("created daemonset to pre-pull server images")
+	} else {
+		current.Spec.Template = ds.Spec.Template
+		if _, err := daemonsets.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrap(err, "prepull: failed to update daemonset")
+		}
+		p.log().WithField("images", len(images)).Debug("updated daemonset to pre-pull server images")
+	}
+
+	p.finish()
+	return nil
+}
+
+// Status returns the state of every pre-pulled image across the nodes the
+// DaemonSet runs on.
+func (p *PrePuller) Status(ctx context.Context) (Status, error) {
+	p.mu.Lock()
+	st := Status{
+		Enabled: config.Get().Cluster.Images.PrePull.Enabled,
+		Leader:  ha.IsLeader(),
+		Running: p.running.Load(),
+		LastRun: p.lastRun,
+		Images:  []ImageStatus{},
+	}
+	p.mu.Unlock()
+
+	ns := config.Get().Cluster.Namespace
+	ds, err := p.client.AppsV1().DaemonSets(ns).Get(ctx, name(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return st, nil
+		}
+		return st, errors.Wrap(err, "prepull: failed to get daemonset")
+	}
+
+	pods, err := p.client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(ds.Spec.Selector.MatchLabels).String(),
+	})
+	if err != nil {
+		return st, errors.Wrap(err, "prepull: failed to list pods")
+	}
+
+	for _, c := range ds.Spec.Template.Spec.Containers {
+		is := ImageStatus{Image: c.Image, Nodes: int(ds.Status.DesiredNumberScheduled)}
+		for _, pod := range pods.Items {
+			for _, cs := range pod.Status.ContainerStatuses {
+				if cs.Name != c.Name {
+					continue
+				}
+				if cs.ImageID != "" {
+					is.Ready++
+				} else if w := cs.State.Waiting; w != nil && pullErrors[w.Reason] {
+					is.Failed++
+					is.Errors = append(is.Errors, pod.Spec.NodeName+": "+w.Message)
+				}
+			}
+		}
+		st.Images = append(st.Images, is)
+	}
+
+	return st, nil
+}
+
+func (p *PrePuller) finish() {
+	p.mu.Lock()
+	p.lastRun = time.Now()
+	p.mu.Unlock()
+}
+
+// daemonSet returns the DaemonSet pulling the given images. Each image runs as
+// a container executing the kuber binary, which is copied into a shared volume
+// by an init container so that images without a shell are supported as well.
+func (p *PrePuller) daemonSet(images []string) *appsv1.DaemonSet {
+	cfg := config.Get()
+
+	l := map[string]string{
+		"app":                 "kuber-prepull",
+		environment.NodeLabel: cfg.Uuid,
+	}
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1m"),
+			corev1.ResourceMemory: resource.MustParse("8Mi"),
+		},
+	}
+	mounts := []corev1.VolumeMount{{Name: "prepull", MountPath: "/prepull"}}
+
+	containers := make([]corev1.Container, len(images))
+	for i, image := range images {
+		containers[i] = corev1.Container{
+			Name:            containerName(image),
+			Image:           image,
+			ImagePullPolicy: k8s.PullPolicy(image),
+			Command:         []string{binaryPath, "prepull"},
+			Resources:       resources,
+			VolumeMounts:    mounts,
+		}
+	}
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name(),
+			Labels: l,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: l},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: l},
+				Spec: corev1.PodSpec{
+					NodeSelector: cfg.Cluster.Images.PrePull.NodeSelector,
+					InitContainers: []corev1.Container{
+						{
+							Name:         "install",
+							Image:        config.KuberImage(cfg.Cluster.Images.PrePull.Image),
+							Command:      []string{"/usr/bin/kuber", "prepull", "--install", binaryPath},
+							Resources:    resources,
+							VolumeMounts: mounts,
+						},
+					},
+					Containers: containers,
+					Volumes: []corev1.Volume{
+						{
+							Name: "prepull",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+					TerminationGracePeriodSeconds: &[]int64{5}[0],
+				},
+			},
+		},
+	}
+}
+
+func (p *PrePuller) log() *log.Entry {
+	return log.WithField("subsystem", "prepull")
+}
+
+// name returns the name of the DaemonSet pre-pulling images for this node.
+func name() string {
+	return "kuber-prepull-" + config.Get().Uuid
+}
+
+// containerName returns a stable name for the container pulling the image, the
+// image itself may contain characters that are not allowed in a name.
+func containerName(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return "image-" + hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,760 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	k8s "github.com/kubectyl/kuber/environment/kubernetes"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/server"
+	"github.com/kubectyl/kuber/system"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	ErrReconcilerRunning = errors.Sentinel("reconciler: already running")
+	ErrClaimNotOrphaned  = errors.Sentinel("reconciler: persistent volume claim is not marked as orphaned")
+)
+
+// OrphanedLabel marks the persistent volume claims of servers that no longer
+// exist on this node. The data of a server is never removed automatically, the
+// claims carrying this label must be removed through the API.
+const OrphanedLabel = k8s.GameServerGroup + "/orphaned"
+
+// The maximum number of actions that are kept in memory and returned by the API.
+const historySize = 100
+
+var (
+	o        system.AtomicBool
+	instance *Reconciler
+)
+
+// The kinds of cluster objects that are handled by the reconciler.
+const (
+	KindPod                   = "pod"
+	KindService               = "service"
+	KindConfigMap             = "configmap"
+	KindPersistentVolumeClaim = "pvc"
+	KindGameServer            = "gameserver"
+	KindLease                 = "lease"
+	KindStatefulSet           = "statefulset"
+	KindDNSEndpoint           = "dnsendpoint"
+	KindNetworkPolicy         = "networkpolicy"
+)
+
+// Action is a single change that the reconciler made, or attempted to make, to
+// the cluster.
+type Action struct {
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Server    string    `json:"server"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Status is the current state of the reconciler as returned by the API.
+type Status struct {
+	Enabled bool      `json:"enabled"`
+	Leader  bool      `json:"leader"`
+	Running bool      `json:"running"`
+	LastRun time.Time `json:"last_run"`
+	Orphans int       `json:"orphans"`
+	Actions []Action  `json:"actions"`
+}
+
+// Reconciler compares the objects in the cluster that belong to this node
+// against the servers tracked by the manager and repairs the differences. It
+// recreates missing services, reverts changes made to GameServer resources,
+// deletes objects that belong to servers that no longer exist on this node, and
+// restarts servers whose pods disappeared while they were marked as running. The persistent volume claims of servers that no
+// longer exist are only marked as orphaned.
+type Reconciler struct {
+	mu      sync.Mutex
+	manager *server.Manager
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	running *system.AtomicBool
+	trigger chan struct{}
+
+	// Tracks when an orphaned object was first seen so that it is only removed
+	// once the configured grace period has passed.
+	orphans map[string]time.Time
+	actions []Action
+	lastRun time.Time
+}
+
+// Initialize configures the reconciler for the application. This should only be
+// called once during the application lifecycle.
+func Initialize(m *server.Manager) error {
+	if !o.SwapIf(true) {
+		panic("reconciler: attempt to initialize more than once during application lifecycle")
+	}
+	rc, c, err := environment.Cluster()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dyn, err := dynamic.NewForConfig(rc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	instance = &Reconciler{
+		manager: m,
+		client:  c,
+		dynamic: dyn,
+		running: system.NewAtomicBool(false),
+		trigger: make(chan struct{}, 1),
+		orphans: make(map[string]time.Time),
+	}
+	return nil
+}
+
+// Instance returns the reconciler instance that was configured when the
+// application was booted.
+func Instance() *Reconciler {
+	if instance == nil {
+		panic("reconciler: attempt to access instance before initialized")
+	}
+	return instance
+}
+
+// Status returns the current status of the reconciler along with the most
+// recent actions it has taken.
+func (r *Reconciler) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	actions := make([]Action, len(r.actions))
+	copy(actions, r.actions)
+
+	return Status{
+		Enabled: config.Get().Cluster.Reconciliation.Enabled,
+		Leader:  ha.IsLeader(),
+		Running: r.running.Load(),
+		LastRun: r.lastRun,
+		Orphans: len(r.orphans),
+		Actions: actions,
+	}
+}
+
+// Trigger queues a reconciliation run without blocking the caller. If a run is
+// already queued this is a no-op.
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run executes a single reconciliation pass against the cluster.
+func (r *Reconciler) Run(ctx context.Context) error {
+	// Only a single replica may modify the cluster at a time.
+	if !ha.IsLeader() {
+		return errors.WithStack(ha.ErrNotLeader)
+	}
+	if !r.running.SwapIf(true) {
+		return errors.WithStack(ErrReconcilerRunning)
+	}
+	defer r.running.Store(false)
+
+	// If the manager is empty it is far more likely that the Panel could not be
+	// reached during boot than every server having been removed. Never treat every
+	// object as orphaned in that case.
+	if r.manager.Len() == 0 {
+		r.log().Warn("no servers are loaded on this node, skipping reconciliation")
+		return nil
+	}
+
+	if config.Get().Cluster.Workload == config.WorkloadStatefulSet {
+		r.releaseStrandedPods(ctx)
+	}
+	r.restartMissingPods(ctx)
+	r.recreateServices(ctx)
+	r.syncGameServers(ctx)
+	if err := r.collectGarbage(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.lastRun = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Watch listens for server pods being removed from the cluster, as well as
+// GameServer resources being changed or removed in operator mode, and triggers
+// a reconciliation run whenever that happens. Queued runs are also processed by
+// this loop. This function blocks until the context is canceled.
+func (r *Reconciler) Watch(ctx context.Context) {
+	go r.watchPods(ctx)
+	if config.Get().Cluster.Operator.Enabled {
+		go r.watchGameServers(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.trigger:
+			// Give the environment a moment to settle, pods are often removed as
+			// part of a normal restart and recreated right after.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second * 5):
+			}
+			if err := r.Run(ctx); err != nil && !errors.Is(err, ErrReconcilerRunning) && !errors.Is(err, ha.ErrNotLeader) {
+				r.log().WithField("error", err).Error("failed to reconcile cluster state")
+			}
+		}
+	}
+}
+
+func (r *Reconciler) watchPods(ctx context.Context) {
+	for {
+		w, err := r.client.CoreV1().Pods(config.Get().Cluster.Namespace).Watch(ctx, metav1.ListOptions{
+			LabelSelector: environment.NodeSelector(),
+		})
+		if err != nil {
+			r.log().WithField("error", err).Warn("failed to watch server pods, retrying...")
+		} else {
+			for ev := range w.ResultChan() {
+				if ev.Type == watch.Deleted {
+					r.Trigger()
+				}
+			}
+			w.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 10):
+		}
+	}
+}
+
+// watchGameServers triggers a reconciliation run whenever the spec of a
+// GameServer resource is changed, or the resource is removed. Changes to the
+// status do not bump the generation of the resource and are ignored.
+func (r *Reconciler) watchGameServers(ctx context.Context) {
+	generations := make(map[string]int64)
+	for {
+		w, err := r.dynamic.Resource(k8s.GameServerResource).Namespace(config.Get().Cluster.Namespace).Watch(ctx, metav1.ListOptions{
+			LabelSelector: environment.NodeSelector(),
+		})
+		if err != nil {
+			r.log().WithField("error", err).Warn("failed to watch gameservers, retrying...")
+		} else {
+			for ev := range w.ResultChan() {
+				obj, ok := ev.Object.(metav1.Object)
+				if !ok {
+					continue
+				}
+				switch ev.Type {
+				case watch.Deleted:
+					delete(generations, obj.GetName())
+					r.Trigger()
+				case watch.Added, watch.Modified:
+					last, seen := generations[obj.GetName()]
+					generations[obj.GetName()] = obj.GetGeneration()
+					if seen && last != obj.GetGeneration() {
+						r.Trigger()
+					}
+				}
+			}
+			w.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 10):
+		}
+	}
+}
+
+// restartMissingPods restarts any server that is tracked as running while its
+// pod no longer exists in the cluster.
+func (r *Reconciler) restartMissingPods(ctx context.Context) {
+	for _, s := range r.manager.All() {
+		if !s.IsRunning() || r.isBusy(s) {
+			continue
+		}
+		name := s.ID()
+		if env, ok := s.Environment.(*k8s.Environment); ok {
+			name = env.PodName()
+		}
+		if _, err := r.client.CoreV1().Pods(config.Get().Cluster.Namespace).Get(ctx, name, metav1.GetOptions{}); err == nil || !apierrors.IsNotFound(err) {
+			continue
+		}
+
+		s.PublishConsoleOutputFromDaemon("Server pod was removed from the cluster unexpectedly, restarting process...")
+
+		// Move through the stopping state so that crash detection is not triggered, the
+		// restart is handled right here instead.
+		s.Environment.SetState(environment.ProcessStoppingState)
+		s.Environment.SetState(environment.ProcessOfflineState)
+
+		err := s.HandlePowerAction(server.PowerActionStart)
+		r.record(Action{
+			Kind:   KindPod,
+			Name:   name,
+			Server: s.ID(),
+			Action: "restarted",
+			Reason: "pod missing for running server",
+		}, err)
+	}
+}
+
+// releaseStrandedPods forcefully removes the server pods of StatefulSets that
+// are stuck on a failed node. The cluster never removes such a pod by itself, as
+// it is unable to confirm that the pod stopped running, so the StatefulSet would
+// not create it again on a healthy node.
+func (r *Reconciler) releaseStrandedPods(ctx context.Context) {
+	ns := config.Get().Cluster.Namespace
+	pods, err := r.client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: environment.NodeSelector() + ",ContainerType=server_process",
+	})
+	if err != nil {
+		r.log().WithField("error", err).Warn("failed to list server pods")
+		return
+	}
+
+	nodes := make(map[string]string)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		reason, ok := nodes[pod.Spec.NodeName]
+		if !ok {
+			node, err := r.client.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				reason = "node removed from cluster"
+			} else if err != nil {
+				r.log().WithField("node", pod.Spec.NodeName).WithField("error", err).Warn("failed to get node of server pod")
+				continue
+			} else {
+				reason = nodeFailure(node, time.Duration(config.Get().Cluster.NodeFailureTimeout)*time.Second)
+			}
+			nodes[pod.Spec.NodeName] = reason
+		}
+		if reason == "" {
+			continue
+		}
+
+		err := r.client.CoreV1().Pods(ns).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{0}[0]})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		r.record(Action{
+			Kind:   KindPod,
+			Name:   pod.Name,
+			Server: pod.Labels[environment.ServerLabel],
+			Action: "force deleted",
+			Reason: reason,
+		}, err)
+	}
+}
+
+// nodeFailure returns the reason the pods of the node are considered to have
+// failed, or an empty string if the node is healthy or has not been unhealthy
+// for longer than the timeout.
+func nodeFailure(node *corev1.Node, timeout time.Duration) string {
+	for _, t := range node.Spec.Taints {
+		if t.Key == "node.kubernetes.io/out-of-service" {
+			return "node tainted as out of service"
+		}
+	}
+	if timeout <= 0 {
+		return ""
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type != corev1.NodeReady {
+			continue
+		}
+		if c.Status != corev1.ConditionTrue && time.Since(c.LastTransitionTime.Time) > timeout {
+			return "node not ready for longer than " + timeout.String()
+		}
+		return ""
+	}
+	return ""
+}
+
+// recreateServices ensures that the service for every known server exists.
+func (r *Reconciler) recreateServices(ctx context.Context) {
+	for _, s := range r.manager.All() {
+		if r.isBusy(s) {
+			continue
+		}
+		env, ok := s.Environment.(*k8s.Environment)
+		if !ok {
+			continue
+		}
+		created, err := env.EnsureService(ctx)
+		if !created && err == nil {
+			continue
+		}
+		r.record(Action{
+			Kind:   KindService,
+			Name:   "svc-" + s.ID(),
+			Server: s.ID(),
+			Action: "created",
+			Reason: "service missing for known server",
+		}, err)
+	}
+}
+
+// syncGameServers recreates the GameServer resources of known servers that were
+// removed from the cluster, and reverts changes made to their spec. The
+// configuration of a server is only ever changed through the Panel.
+func (r *Reconciler) syncGameServers(ctx context.Context) {
+	if !config.Get().Cluster.Operator.Enabled {
+		return
+	}
+	for _, s := range r.manager.All() {
+		if r.isBusy(s) {
+			continue
+		}
+		env, ok := s.Environment.(*k8s.Environment)
+		if !ok {
+			continue
+		}
+		changed, err := env.SyncGameServer(ctx)
+		if !changed && err == nil {
+			continue
+		}
+		r.record(Action{
+			Kind:   KindGameServer,
+			Name:   s.ID(),
+			Server: s.ID(),
+			Action: "synced",
+			Reason: "gameserver missing or changed for known server",
+		}, err)
+	}
+}
+
+// collectGarbage removes objects that belong to servers which are not known to
+// this node, as well as installer objects left behind by an installation that
+// is no longer running. Objects are only removed once they have been orphaned
+// for longer than the configured grace period.
+func (r *Reconciler) collectGarbage(ctx context.Context) error {
+	ns := config.Get().Cluster.Namespace
+	opts := metav1.ListOptions{LabelSelector: environment.NodeSelector()}
+
+	var objects []metav1.ObjectMeta
+	var kinds []string
+
+	pods, err := r.client.CoreV1().Pods(ns).List(ctx, opts)
+	if err != nil {
+		return errors.Wrap(err, "reconciler: failed to list pods")
+	}
+	for _, v := range pods.Items {
+		objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindPod)
+	}
+
+	services, err := r.client.CoreV1().Services(ns).List(ctx, opts)
+	if err != nil {
+		return errors.Wrap(err, "reconciler: failed to list services")
+	}
+	for _, v := range services.Items {
+		objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindService)
+	}
+
+	configmaps, err := r.client.CoreV1().ConfigMaps(ns).List(ctx, opts)
+	if err != nil {
+		return errors.Wrap(err, "reconciler: failed to list configmaps")
+	}
+	for _, v := range configmaps.Items {
+		objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindConfigMap)
+	}
+
+	if config.Get().Cluster.Workload == config.WorkloadStatefulSet {
+		sets, err := r.client.AppsV1().StatefulSets(ns).List(ctx, opts)
+		if err != nil {
+			return errors.Wrap(err, "reconciler: failed to list statefulsets")
+		}
+		for _, v := range sets.Items {
+			objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindStatefulSet)
+		}
+	}
+
+	// Network policies are only created for internal servers, so Kuber may not be allowed
+	// to access them when none are used.
+	policies, err := r.client.NetworkingV1().NetworkPolicies(ns).List(ctx, opts)
+	if err != nil && !apierrors.IsForbidden(err) {
+		return errors.Wrap(err, "reconciler: failed to list network policies")
+	} else if err == nil {
+		for _, v := range policies.Items {
+			objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindNetworkPolicy)
+		}
+	}
+
+	pvcs, err := r.client.CoreV1().PersistentVolumeClaims(ns).List(ctx, opts)
+	if err != nil {
+		return errors.Wrap(err, "reconciler: failed to list persistent volume claims")
+	}
+	for _, v := range pvcs.Items {
+		objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindPersistentVolumeClaim)
+	}
+
+	if ha.Enabled() {
+		leases, err := r.client.CoordinationV1().Leases(ns).List(ctx, opts)
+		if err != nil {
+			return errors.Wrap(err, "reconciler: failed to list leases")
+		}
+		for _, v := range leases.Items {
+			objects, kinds = append(objects, v.ObjectMeta), append(kinds, KindLease)
+		}
+	}
+
+	if config.Get().Cluster.Operator.Enabled {
+		gameservers, err := r.dynamic.Resource(k8s.GameServerResource).Namespace(ns).List(ctx, opts)
+		if err != nil {
+			return errors.Wrap(err, "reconciler: failed to list gameservers")
+		}
+		for _, v := range gameservers.Items {
+			objects = append(objects, metav1.ObjectMeta{Name: v.GetName(), Labels: v.GetLabels()})
+			kinds = append(kinds, KindGameServer)
+		}
+	}
+
+	// The resource only exists once ExternalDNS has been installed with its CRD source.
+	if dns := config.Get().Cluster.ExternalDNS; dns.Enabled && dns.Srv != "" {
+		endpoints, err := r.dynamic.Resource(k8s.DNSEndpointResource).Namespace(ns).List(ctx, opts)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "reconciler: failed to list dnsendpoints")
+		}
+		if endpoints != nil {
+			for _, v := range endpoints.Items {
+				objects = append(objects, metav1.ObjectMeta{Name: v.GetName(), Labels: v.GetLabels()})
+				kinds = append(kinds, KindDNSEndpoint)
+			}
+		}
+	}
+
+	grace := time.Duration(config.Get().Cluster.Reconciliation.GracePeriod) * time.Second
+	seen := make(map[string]bool)
+	for i, meta := range objects {
+		reason := r.orphanReason(kinds[i], meta)
+		if reason == "" {
+			// The server of a claim marked as orphaned may have been added back to this
+			// node, for example after the Panel could not be reached during boot.
+			if kinds[i] == KindPersistentVolumeClaim && meta.Labels[OrphanedLabel] != "" {
+				err := r.setClaimOrphaned(ctx, meta.Name, false)
+				r.record(Action{
+					Kind:   kinds[i],
+					Name:   meta.Name,
+					Server: meta.Labels[environment.ServerLabel],
+					Action: "unmarked",
+					Reason: "server exists on this node",
+				}, err)
+			}
+			continue
+		}
+
+		key := kinds[i] + "/" + meta.Name
+		seen[key] = true
+
+		r.mu.Lock()
+		first, ok := r.orphans[key]
+		if !ok {
+			first = time.Now()
+			r.orphans[key] = first
+		}
+		r.mu.Unlock()
+
+		if !ok {
+			r.log().WithFields(log.Fields{"kind": kinds[i], "name": meta.Name, "reason": reason}).
+				Info("detected orphaned cluster object, waiting for grace period before removal")
+		}
+		if time.Since(first) < grace {
+			continue
+		}
+
+		// Removing a claim removes the data of the server, which is never done without
+		// an explicit confirmation through the API.
+		if kinds[i] == KindPersistentVolumeClaim {
+			if meta.Labels[OrphanedLabel] == "" {
+				err := r.setClaimOrphaned(ctx, meta.Name, true)
+				r.record(Action{
+					Kind:   kinds[i],
+					Name:   meta.Name,
+					Server: meta.Labels[environment.ServerLabel],
+					Action: "marked",
+					Reason: reason,
+				}, err)
+			}
+			continue
+		}
+
+		err := r.delete(ctx, kinds[i], meta.Name)
+		r.record(Action{
+			Kind:   kinds[i],
+			Name:   meta.Name,
+			Server: meta.Labels[environment.ServerLabel],
+			Action: "deleted",
+			Reason: reason,
+		}, err)
+		if err == nil {
+			delete(seen, key)
+		}
+	}
+
+	// Forget about any objects that are no longer orphaned, or no longer exist.
+	r.mu.Lock()
+	for key := range r.orphans {
+		if !seen[key] {
+			delete(r.orphans, key)
+		}
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// orphanReason returns the reason an object is considered to be orphaned, or an
+// empty string if the object is still in use.
+func (r *Reconciler) orphanReason(kind string, meta metav1.ObjectMeta) string {
+	s, ok := r.manager.Get(meta.Labels[environment.ServerLabel])
+	if !ok {
+		return "server does not exist on this node"
+	}
+	if s.IsInstalling() {
+		return ""
+	}
+	if (kind == KindPod && strings.HasSuffix(meta.Name, "-installer")) || (kind == KindConfigMap && strings.HasSuffix(meta.Name, "-configmap")) {
+		return "installation process is no longer running"
+	}
+	// Commands run for at most five minutes, their pods are only left behind when Kuber
+	// stopped before removing them.
+	if kind == KindPod && meta.Labels["ContainerType"] == "server_command" && time.Since(meta.CreationTimestamp.Time) > time.Minute*15 {
+		return "command is no longer running"
+	}
+	return ""
+}
+
+// DeleteOrphanedClaim removes a persistent volume claim that was marked as
+// orphaned by the reconciler, along with the data of the server. The claim is
+// only removed if its server still does not exist on this node.
+func (r *Reconciler) DeleteOrphanedClaim(ctx context.Context, name string) error {
+	pvc, err := r.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "reconciler: failed to get persistent volume claim")
+	}
+	if pvc.Labels[environment.NodeLabel] != config.Get().Uuid || pvc.Labels[OrphanedLabel] == "" || r.orphanReason(KindPersistentVolumeClaim, pvc.ObjectMeta) == "" {
+		return errors.WithStack(ErrClaimNotOrphaned)
+	}
+
+	err = r.delete(ctx, KindPersistentVolumeClaim, name)
+	r.record(Action{
+		Kind:   KindPersistentVolumeClaim,
+		Name:   name,
+		Server: pvc.Labels[environment.ServerLabel],
+		Action: "deleted",
+		Reason: "removal of orphaned claim was confirmed",
+	}, err)
+	if err != nil {
+		return errors.Wrap(err, "reconciler: failed to delete persistent volume claim")
+	}
+
+	r.mu.Lock()
+	delete(r.orphans, KindPersistentVolumeClaim+"/"+name)
+	r.mu.Unlock()
+	return nil
+}
+
+// setClaimOrphaned adds or removes the label marking a persistent volume claim
+// as orphaned.
+func (r *Reconciler) setClaimOrphaned(ctx context.Context, name string, orphaned bool) error {
+	patch := []byte(`{"metadata":{"labels":{"` + OrphanedLabel + `":null}}}`)
+	if orphaned {
+		patch = []byte(`{"metadata":{"labels":{"` + OrphanedLabel + `":"true"}}}`)
+	}
+	_, err := r.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *Reconciler) delete(ctx context.Context, kind string, name string) error {
+	ns := config.Get().Cluster.Namespace
+	policy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{PropagationPolicy: &policy}
+
+	var err error
+	switch kind {
+	case KindPod:
+		err = r.client.CoreV1().Pods(ns).Delete(ctx, name, opts)
+	case KindService:
+		err = r.client.CoreV1().Services(ns).Delete(ctx, name, opts)
+	case KindConfigMap:
+		err = r.client.CoreV1().ConfigMaps(ns).Delete(ctx, name, opts)
+	case KindStatefulSet:
+		err = r.client.AppsV1().StatefulSets(ns).Delete(ctx, name, opts)
+	case KindNetworkPolicy:
+		err = r.client.NetworkingV1().NetworkPolicies(ns).Delete(ctx, name, opts)
+	case KindPersistentVolumeClaim:
+		err = r.client.CoreV1().PersistentVolumeClaims(ns).Delete(ctx, name, opts)
+	case KindLease:
+		err = r.client.CoordinationV1().Leases(ns).Delete(ctx, name, opts)
+	case KindGameServer:
+		err = r.dynamic.Resource(k8s.GameServerResource).Namespace(ns).Delete(ctx, name, opts)
+	case KindDNSEndpoint:
+		err = r.dynamic.Resource(k8s.DNSEndpointResource).Namespace(ns).Delete(ctx, name, opts)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// isBusy returns true if the server is currently being modified by another
+// process and should not be touched by the reconciler.
+func (r *Reconciler) isBusy(s *server.Server) bool {
+	return s.IsInstalling() || s.IsTransferring() || s.IsRestoring() || s.ExecutingPowerAction()
+}
+
+// record logs the action taken and stores it in the history returned by the API.
+func (r *Reconciler) record(a Action, err error) {
+	a.Timestamp = time.Now()
+
+	l := r.log().WithFields(log.Fields{"kind": a.Kind, "name": a.Name, "action": a.Action, "reason": a.Reason})
+	if a.Server != "" {
+		l = l.WithField("server", a.Server)
+	}
+	if err != nil {
+		a.Error = err.Error()
+		l.WithField("error", err).Error("failed to reconcile cluster object")
+	} else {
+		l.Info("reconciled cluster object")
+	}
+
+	r.mu.Lock()
+	r.actions = append(r.actions, a)
+	if len(r.actions) > historySize {
+		r.actions = r.actions[len(r.actions)-historySize:]
+	}
+	r.mu.Unlock()
+}
+
+func (r *Reconciler) log() *log.Entry {
+	return log.WithField("subsystem", "reconciler")
+}
@@ -0,0 +1,263 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	. "github.com/franela/goblin"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/server"
+	"github.com/kubectyl/kuber/system"
+)
+
+const (
+	knownServer   = "c6a5b5d7-3b9c-4d8e-9a6f-1b2c3d4e5f60"
+	unknownServer = "0f9e8d7c-6b5a-4c3d-8e2f-1a0b9c8d7e6f"
+)
+
+func newReconciler(objects ...metav1.Object) *Reconciler {
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		Uuid:                "node",
+		Cluster: config.ClusterConfiguration{
+			Namespace:      "default",
+			Reconciliation: config.Reconciliation{Enabled: true},
+		},
+	})
+
+	m := server.NewEmptyManager(nil)
+	s, err := server.New(nil)
+	if err != nil {
+		panic(err)
+	}
+	s.Config().Uuid = knownServer
+	m.Add(s)
+
+	client := fake.NewSimpleClientset()
+	for _, o := range objects {
+		var err error
+		switch v := o.(type) {
+		case *corev1.Pod:
+			_, err = client.CoreV1().Pods("default").Create(context.Background(), v, metav1.CreateOptions{})
+		case *corev1.PersistentVolumeClaim:
+			_, err = client.CoreV1().PersistentVolumeClaims("default").Create(context.Background(), v, metav1.CreateOptions{})
+		case *corev1.Node:
+			_, err = client.CoreV1().Nodes().Create(context.Background(), v, metav1.CreateOptions{})
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return &Reconciler{
+		manager: m,
+		client:  client,
+		running: system.NewAtomicBool(false),
+		trigger: make(chan struct{}, 1),
+		orphans: make(map[string]time.Time),
+	}
+}
+
+func meta(name string, uuid string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "default",
+		Labels:    map[string]string{environment.ServerLabel: uuid, environment.NodeLabel: "node"},
+	}
+}
+
+// strandedPod returns the pod of the StatefulSet of the known server running on
+// the node with the given name.
+func strandedPod(node string) *corev1.Pod {
+	m := meta(knownServer+"-0", knownServer)
+	m.Labels["ContainerType"] = "server_process"
+	return &corev1.Pod{ObjectMeta: m, Spec: corev1.PodSpec{NodeName: node}}
+}
+
+// readyNode returns a node whose ready condition last changed to the status at
+// the given time.
+func readyNode(name string, status corev1.ConditionStatus, since time.Time) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: status, LastTransitionTime: metav1.NewTime(since)},
+			},
+		},
+	}
+}
+
+func TestReconciler(t *testing.T) {
+	g := Goblin(t)
+	ctx := context.Background()
+
+	g.Describe("Reconciler#collectGarbage", func() {
+		g.It("deletes the pods of unknown servers", func() {
+			r := newReconciler(&corev1.Pod{ObjectMeta: meta(unknownServer, unknownServer)})
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, unknownServer, metav1.GetOptions{})
+			g.Assert(apierrors.IsNotFound(err)).IsTrue()
+		})
+
+		g.It("keeps the objects of unknown servers during the grace period", func() {
+			r := newReconciler(
+				&corev1.Pod{ObjectMeta: meta(unknownServer, unknownServer)},
+				&corev1.PersistentVolumeClaim{ObjectMeta: meta(unknownServer+"-pvc", unknownServer)},
+			)
+			config.Update(func(c *config.Configuration) {
+				c.Cluster.Reconciliation.GracePeriod = 600
+			})
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, unknownServer, metav1.GetOptions{})
+			g.Assert(err).IsNil()
+			pvc, err := r.client.CoreV1().PersistentVolumeClaims("default").Get(ctx, unknownServer+"-pvc", metav1.GetOptions{})
+			g.Assert(err).IsNil()
+			g.Assert(pvc.Labels[OrphanedLabel]).Equal("")
+			g.Assert(r.Status().Orphans).Equal(2)
+		})
+
+		g.It("marks the claims of unknown servers instead of deleting them", func() {
+			r := newReconciler(&corev1.PersistentVolumeClaim{ObjectMeta: meta(unknownServer+"-pvc", unknownServer)})
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			pvc, err := r.client.CoreV1().PersistentVolumeClaims("default").Get(ctx, unknownServer+"-pvc", metav1.GetOptions{})
+			g.Assert(err).IsNil()
+			g.Assert(pvc.Labels[OrphanedLabel]).Equal("true")
+			g.Assert(r.Status().Actions[0].Action).Equal("marked")
+
+			// Running again must not record the claim a second time.
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			g.Assert(len(r.Status().Actions)).Equal(1)
+		})
+
+		g.It("unmarks the claims of servers that exist again", func() {
+			m := meta(knownServer+"-pvc", knownServer)
+			m.Labels[OrphanedLabel] = "true"
+			r := newReconciler(&corev1.PersistentVolumeClaim{ObjectMeta: m})
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			pvc, err := r.client.CoreV1().PersistentVolumeClaims("default").Get(ctx, knownServer+"-pvc", metav1.GetOptions{})
+			g.Assert(err).IsNil()
+			_, ok := pvc.Labels[OrphanedLabel]
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("tolerates not being allowed to list network policies", func() {
+			r := newReconciler(&corev1.Pod{ObjectMeta: meta(unknownServer, unknownServer)})
+			r.client.(*fake.Clientset).PrependReactor("list", "networkpolicies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "networking.k8s.io", Resource: "networkpolicies"}, "", errors.New("forbidden"))
+			})
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, unknownServer, metav1.GetOptions{})
+			g.Assert(apierrors.IsNotFound(err)).IsTrue()
+		})
+
+		g.It("keeps the objects of known servers", func() {
+			r := newReconciler(
+				&corev1.Pod{ObjectMeta: meta(knownServer, knownServer)},
+				&corev1.PersistentVolumeClaim{ObjectMeta: meta(knownServer+"-pvc", knownServer)},
+			)
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, knownServer, metav1.GetOptions{})
+			g.Assert(err).IsNil()
+			g.Assert(len(r.Status().Actions)).Equal(0)
+		})
+	})
+
+	g.Describe("Reconciler#releaseStrandedPods", func() {
+		g.It("force deletes pods on nodes that have not been ready for too long", func() {
+			r := newReconciler(strandedPod("worker"), readyNode("worker", corev1.ConditionUnknown, time.Now().Add(-time.Hour)))
+			config.Update(func(c *config.Configuration) {
+				c.Cluster.NodeFailureTimeout = 300
+			})
+
+			r.releaseStrandedPods(ctx)
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, knownServer+"-0", metav1.GetOptions{})
+			g.Assert(apierrors.IsNotFound(err)).IsTrue()
+			g.Assert(r.Status().Actions[0].Action).Equal("force deleted")
+		})
+
+		g.It("keeps pods on nodes that only recently stopped being ready", func() {
+			r := newReconciler(strandedPod("worker"), readyNode("worker", corev1.ConditionUnknown, time.Now()))
+			config.Update(func(c *config.Configuration) {
+				c.Cluster.NodeFailureTimeout = 300
+			})
+
+			r.releaseStrandedPods(ctx)
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, knownServer+"-0", metav1.GetOptions{})
+			g.Assert(err).IsNil()
+		})
+
+		g.It("keeps pods on ready nodes", func() {
+			r := newReconciler(strandedPod("worker"), readyNode("worker", corev1.ConditionTrue, time.Now().Add(-time.Hour)))
+			config.Update(func(c *config.Configuration) {
+				c.Cluster.NodeFailureTimeout = 300
+			})
+
+			r.releaseStrandedPods(ctx)
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, knownServer+"-0", metav1.GetOptions{})
+			g.Assert(err).IsNil()
+			g.Assert(len(r.Status().Actions)).Equal(0)
+		})
+
+		g.It("force deletes pods on nodes tainted as out of service right away", func() {
+			node := readyNode("worker", corev1.ConditionFalse, time.Now())
+			node.Spec.Taints = []corev1.Taint{{Key: "node.kubernetes.io/out-of-service", Value: "nodeshutdown", Effect: corev1.TaintEffectNoExecute}}
+			r := newReconciler(strandedPod("worker"), node)
+
+			r.releaseStrandedPods(ctx)
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, knownServer+"-0", metav1.GetOptions{})
+			g.Assert(apierrors.IsNotFound(err)).IsTrue()
+		})
+
+		g.It("force deletes pods on nodes removed from the cluster", func() {
+			r := newReconciler(strandedPod("worker"))
+
+			r.releaseStrandedPods(ctx)
+			_, err := r.client.CoreV1().Pods("default").Get(ctx, knownServer+"-0", metav1.GetOptions{})
+			g.Assert(apierrors.IsNotFound(err)).IsTrue()
+		})
+	})
+
+	g.Describe("Reconciler#DeleteOrphanedClaim", func() {
+		g.It("refuses claims that are not marked as orphaned", func() {
+			r := newReconciler(&corev1.PersistentVolumeClaim{ObjectMeta: meta(unknownServer+"-pvc", unknownServer)})
+
+			err := r.DeleteOrphanedClaim(ctx, unknownServer+"-pvc")
+			g.Assert(errors.Is(err, ErrClaimNotOrphaned)).IsTrue()
+		})
+
+		g.It("refuses claims of servers that exist again", func() {
+			m := meta(knownServer+"-pvc", knownServer)
+			m.Labels[OrphanedLabel] = "true"
+			r := newReconciler(&corev1.PersistentVolumeClaim{ObjectMeta: m})
+
+			err := r.DeleteOrphanedClaim(ctx, knownServer+"-pvc")
+			g.Assert(errors.Is(err, ErrClaimNotOrphaned)).IsTrue()
+		})
+
+		g.It("deletes claims that are marked as orphaned", func() {
+			r := newReconciler(&corev1.PersistentVolumeClaim{ObjectMeta: meta(unknownServer+"-pvc", unknownServer)})
+
+			g.Assert(r.collectGarbage(ctx)).IsNil()
+			g.Assert(r.DeleteOrphanedClaim(ctx, unknownServer+"-pvc")).IsNil()
+			_, err := r.client.CoreV1().PersistentVolumeClaims("default").Get(ctx, unknownServer+"-pvc", metav1.GetOptions{})
+			g.Assert(apierrors.IsNotFound(err)).IsTrue()
+		})
+	})
+}
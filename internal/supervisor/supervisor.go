@@ -0,0 +1,267 @@
+// Package supervisor implements the entrypoint of server pods that are able to
+// restart in place. The supervisor runs the entrypoint of the image of the
+// server and keeps the container running once it exits, so that Kuber is able to
+// start it again without recreating the pod. Kuber controls it over a
+// unix socket, and the exit of every run is marked in the output of the
+// container.
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+)
+
+// The replies sent over the control socket.
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+)
+
+// The commands accepted over the control socket.
+const (
+	CommandStart  = "start"
+	CommandStatus = "status"
+	CommandSignal = "signal"
+)
+
+// exitMarker is written to the output once a run of the startup command exits.
+// It is an operating system command sequence, which terminals do not display.
+const exitMarker = "\x1b]kuber;exit;"
+
+// ExitMarker returns the marker written to the output when the given run exits
+// with the exit code.
+func ExitMarker(run int, code int) string {
+	return fmt.Sprintf("%s%d;%d\x07", exitMarker, run, code)
+}
+
+// ParseExitMarker returns the run and exit code of the exit marker within the
+// line of output, if there is one.
+func ParseExitMarker(line []byte) (run int, code int, ok bool) {
+	s := string(line)
+	i := strings.Index(s, exitMarker)
+	if i < 0 {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(s[i+len(exitMarker):], "%d;%d", &run, &code); err != nil {
+		return 0, 0, false
+	}
+	return run, code, true
+}
+
+// Supervisor runs the startup command of a server.
+type Supervisor struct {
+	// Args is the entrypoint of the image of the server followed by its arguments.
+	// It is executed directly, the entrypoint reads the startup command from the
+	// environment just as it does without the supervisor.
+	Args []string
+
+	// Dir is the working directory of the startup command.
+	Dir string
+
+	// Socket is the path of the control socket.
+	Socket string
+
+	// Configs is the file holding the configuration files of the server, which are
+	// updated before every run except for the first one. The first run is handled
+	// by the init container updating the configuration files.
+	Configs string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	run     int
+	stopped chan struct{}
+}
+
+// Run starts the startup command and serves the control socket until the
+// context is canceled. The signal stopping the supervisor is passed on to the
+// startup command, which is waited on before returning.
+func (s *Supervisor) Run(ctx context.Context) error {
+	_ = os.Remove(s.Socket)
+	ln, err := net.Listen("unix", s.Socket)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer ln.Close()
+
+	go s.serve(ln)
+
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	cmd, stopped := s.cmd, s.stopped
+	s.mu.Unlock()
+	if cmd != nil {
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+		<-stopped
+	}
+	return nil
+}
+
+// start runs the startup command unless it is already running.
+func (s *Supervisor) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd != nil {
+		return nil
+	}
+
+	if s.run > 0 && s.Configs != "" {
+		s.configure()
+	}
+
+	if len(s.Args) == 0 {
+		return errors.New("supervisor: no entrypoint to run")
+	}
+	cmd := exec.Command(s.Args[0], s.Args[1:]...)
+	cmd.Dir = s.Dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "supervisor: failed to run startup command")
+	}
+
+	s.run++
+	s.cmd = cmd
+	s.stopped = make(chan struct{})
+	go s.wait(cmd, s.run, s.stopped)
+
+	return nil
+}
+
+// wait marks the exit of the run of the startup command in the output once it
+// has exited.
+func (s *Supervisor) wait(cmd *exec.Cmd, run int, stopped chan struct{}) {
+	_ = cmd.Wait()
+
+	code := cmd.ProcessState.ExitCode()
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		code = 128 + int(ws.Signal())
+	}
+	fmt.Fprintln(os.Stdout, ExitMarker(run, code))
+
+	s.mu.Lock()
+	s.cmd = nil
+	s.mu.Unlock()
+	close(stopped)
+}
+
+// configure updates the configuration files of the server by running the
+// parse-configs command of this binary.
+func (s *Supervisor) configure() {
+	cmd := exec.Command(os.Args[0], "parse-configs", "--file", s.Configs, "--root", s.Dir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.WithField("error", err).Warn("failed to update configuration files")
+	}
+}
+
+// status returns the status of the startup command along with the number of
+// the current, or most recent, run.
+func (s *Supervisor) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd != nil {
+		return StatusRunning + " " + strconv.Itoa(s.run)
+	}
+	return StatusStopped + " " + strconv.Itoa(s.run)
+}
+
+func (s *Supervisor) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle processes a single command received over the control socket and
+// replies with the resulting status of the startup command.
+func (s *Supervisor) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 10))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+	switch command {
+	case CommandStart:
+		err = s.start()
+	case CommandSignal:
+		err = s.signal(arg)
+	case CommandStatus:
+	default:
+		err = errors.Errorf("supervisor: unknown command \"%s\"", command)
+	}
+	if err != nil {
+		fmt.Fprintln(conn, "error "+err.Error())
+		return
+	}
+	fmt.Fprintln(conn, s.status())
+}
+
+// signal sends the signal with the given number to the startup command.
+func (s *Supervisor) signal(sig string) error {
+	n, err := strconv.Atoi(sig)
+	if err != nil {
+		return errors.Errorf("supervisor: invalid signal \"%s\"", sig)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd == nil {
+		return nil
+	}
+	// The entrypoints of most images replace themselves with the server process, so
+	// the signal reaches the server process directly in most cases.
+	return errors.WithStack(s.cmd.Process.Signal(syscall.Signal(n)))
+}
+
+// Control sends the command to the supervisor listening on the socket and
+// returns its reply.
+func Control(socket string, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", socket, time.Second*5)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 10))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return "", errors.WithStack(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, "error ") {
+		return "", errors.New(strings.TrimPrefix(reply, "error "))
+	}
+	return reply, nil
+}
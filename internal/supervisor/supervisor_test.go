@@ -0,0 +1,117 @@
+package supervisor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestExitMarker(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ParseExitMarker", func() {
+		g.It("parses the marker written by ExitMarker", func() {
+			run, code, ok := ParseExitMarker([]byte("server stopped" + ExitMarker(3, 137)))
+			g.Assert(ok).IsTrue()
+			g.Assert(run).Equal(3)
+			g.Assert(code).Equal(137)
+		})
+
+		g.It("ignores lines without a marker", func() {
+			_, _, ok := ParseExitMarker([]byte("[12:00:00 INFO]: Done (1.234s)!"))
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("ignores incomplete markers", func() {
+			_, _, ok := ParseExitMarker([]byte(exitMarker + "abc"))
+			g.Assert(ok).IsFalse()
+		})
+	})
+}
+
+func TestSupervisor(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("Supervisor", func() {
+		var socket string
+		var cancel context.CancelFunc
+		var done chan error
+
+		run := func(args ...string) {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			s := &Supervisor{Args: args, Dir: t.TempDir(), Socket: socket}
+			done = make(chan error, 1)
+			go func() {
+				done <- s.Run(ctx)
+			}()
+		}
+
+		// waitFor polls the supervisor until it replies with the expected status.
+		waitFor := func(want string) string {
+			var reply string
+			for i := 0; i < 50; i++ {
+				reply, _ = Control(socket, CommandStatus)
+				if reply == want {
+					break
+				}
+				time.Sleep(time.Millisecond * 100)
+			}
+			return reply
+		}
+
+		g.BeforeEach(func() {
+			socket = filepath.Join(t.TempDir(), "supervisor.sock")
+		})
+
+		g.AfterEach(func() {
+			if cancel != nil {
+				cancel()
+				<-done
+				cancel = nil
+			}
+		})
+
+		g.It("executes the entrypoint with its arguments", func() {
+			run("sleep", "30")
+
+			g.Assert(waitFor(StatusRunning + " 1")).Equal(StatusRunning + " 1")
+		})
+
+		g.It("restarts the entrypoint once it exited", func() {
+			run("sleep", "30")
+			g.Assert(waitFor(StatusRunning + " 1")).Equal(StatusRunning + " 1")
+
+			_, err := Control(socket, CommandSignal+" 15")
+			g.Assert(err).IsNil()
+			g.Assert(waitFor(StatusStopped + " 1")).Equal(StatusStopped + " 1")
+
+			reply, err := Control(socket, CommandStart)
+			g.Assert(err).IsNil()
+			g.Assert(reply).Equal(StatusRunning + " 2")
+		})
+
+		g.It("rejects unknown commands", func() {
+			run("sleep", "30")
+			waitFor(StatusRunning + " 1")
+
+			_, err := Control(socket, "restart")
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("fails to run without an entrypoint", func() {
+			run()
+
+			select {
+			case err := <-done:
+				g.Assert(err == nil).IsFalse()
+				done <- nil
+			case <-time.After(time.Second * 5):
+				g.Fail("supervisor did not return")
+			}
+		})
+	})
+}
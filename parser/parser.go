@@ -47,6 +47,27 @@ func (cv *ReplaceValue) Value() []byte {
 	return cv.value
 }
 
+// MarshalJSON returns the JSON representation of the value. Strings are decoded
+// and encoded again rather than quoted as they are, since the raw value is not
+// guaranteed to be escaped.
+func (cv ReplaceValue) MarshalJSON() ([]byte, error) {
+	switch cv.valueType {
+	case jsonparser.String:
+		str, err := jsonparser.ParseString(cv.value)
+		if err != nil {
+			return nil, errors.Wrap(err, "parser: could not parse value")
+		}
+		return json.Marshal(str)
+	case jsonparser.NotExist, jsonparser.Unknown:
+		return []byte("null"), nil
+	default:
+		if !json.Valid(cv.value) {
+			return nil, errors.New("parser: replacement value is not valid json")
+		}
+		return cv.value, nil
+	}
+}
+
 // Type returns the underlying data type for the Value field.
 func (cv *ReplaceValue) Type() jsonparser.ValueType {
 	return cv.valueType
@@ -167,6 +188,39 @@ func (cfr *ConfigurationFileReplacement) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Render returns a copy of the configuration file where every replacement that
+// references a value from the configuration of the daemon has been replaced by
+// that value. This allows the file to be parsed somewhere the configuration of
+// the daemon is not available.
+func (f *ConfigurationFile) Render() (ConfigurationFile, error) {
+	if mb, err := json.Marshal(config.Get()); err != nil {
+		return ConfigurationFile{}, err
+	} else {
+		f.configuration = mb
+	}
+
+	out := ConfigurationFile{
+		FileName: f.FileName,
+		Parser:   f.Parser,
+		Replace:  make([]ConfigurationFileReplacement, 0, len(f.Replace)),
+	}
+	for _, r := range f.Replace {
+		if r.ReplaceWith.Type() == jsonparser.String && configMatchRegex.Match(r.ReplaceWith.Value()) {
+			v, err := f.LookupConfigurationValue(r)
+			if err != nil {
+				return ConfigurationFile{}, err
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return ConfigurationFile{}, err
+			}
+			r.ReplaceWith = ReplaceValue{value: b[1 : len(b)-1], valueType: jsonparser.String}
+		}
+		out.Replace = append(out.Replace, r)
+	}
+	return out, nil
+}
+
 // Parses a given configuration file and updates all of the values within as defined
 // in the API response from the Panel.
 func (f *ConfigurationFile) Parse(path string, internal bool) error {
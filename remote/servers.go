@@ -92,6 +92,24 @@ func (c *client) GetInstallationScript(ctx context.Context, uuid string) (Instal
 	return config, err
 }
 
+// GetEggImages returns every image offered by the eggs on the Panel, which are
+// pre-pulled onto the nodes of the cluster when enabled.
+func (c *client) GetEggImages(ctx context.Context) ([]string, error) {
+	res, err := c.Get(ctx, "/eggs/images", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var r struct {
+		Images []string `json:"images"`
+	}
+	if err := res.BindJSON(&r); err != nil {
+		return nil, err
+	}
+	return r.Images, nil
+}
+
 func (c *client) SetInstallationStatus(ctx context.Context, uuid string, data InstallStatusRequest) error {
 	resp, err := c.Post(ctx, fmt.Sprintf("/servers/%s/install", uuid), data)
 	if err != nil {
@@ -138,6 +138,56 @@ type ProcessStopConfiguration struct {
 	Value string `json:"value"`
 }
 
+// Hibernation defines how the players of a server are detected while it is
+// running, and how clients are answered while it is hibernating.
+type Hibernation struct {
+	// Protocol is the protocol used to answer clients connecting while the server
+	// is hibernating. Only "minecraft" is supported, connections using any other
+	// protocol are closed right away.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Query is run through a shell in the container and must print the number of
+	// players connected to the server. The network traffic of the server is used
+	// to detect players when no query is defined.
+	Query string `json:"query,omitempty"`
+}
+
+// HealthCheck defines how the health of a running server process is checked.
+// The check is performed by the cluster, a process that is not healthy does not
+// receive any traffic and is killed if it stays unhealthy for too long.
+type HealthCheck struct {
+	// Type is either "tcp" to connect to the port, "udp" to send the payload to the
+	// port and wait for any response, or "exec" to run the command in the container.
+	// UDP checks are performed by bash within the server container, as the cluster
+	// is not able to probe UDP ports itself. The image of the server must provide
+	// bash for them, otherwise every check fails and the process is killed.
+	Type string `json:"type"`
+
+	// Port is the port that is checked, defaults to the default allocation of the server.
+	Port int `json:"port,omitempty"`
+
+	// Payload is the hex encoded datagram sent for UDP checks.
+	Payload string `json:"payload,omitempty"`
+
+	// Command is run through a shell for exec checks, and must exit with a code of 0
+	// when the server process is healthy.
+	Command string `json:"command,omitempty"`
+
+	// StartupTimeout is the amount of time in seconds the process has to become
+	// healthy after starting before it is considered to have failed.
+	StartupTimeout int `json:"startup_timeout,omitempty"`
+
+	// Interval is the amount of time in seconds between checks.
+	Interval int `json:"interval,omitempty"`
+
+	// Timeout is the amount of time in seconds a single check may take.
+	Timeout int `json:"timeout,omitempty"`
+
+	// Failures is the number of consecutive failed checks after which the process
+	// is no longer considered healthy.
+	Failures int `json:"failures,omitempty"`
+}
+
 // ProcessConfiguration defines the process configuration for a given server
 // instance. This sets what Wings is looking for to mark a server as done
 // starting what to do when stopping, and what changes to make to the
@@ -149,6 +199,8 @@ type ProcessConfiguration struct {
 		StripAnsi       bool                 `json:"strip_ansi"`
 	} `json:"startup"`
 	Stop               ProcessStopConfiguration   `json:"stop"`
+	HealthCheck        *HealthCheck               `json:"health_check"`
+	Hibernation        *Hibernation               `json:"hibernation"`
 	ConfigurationFiles []parser.ConfigurationFile `json:"configs"`
 }
 
@@ -53,12 +53,17 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	// This request does not need the AuthorizationMiddleware as the panel should never call it
 	// and requests are authenticated through a JWT the panel issues to the other daemon.
 	router.POST("/api/transfers", postTransfers)
+	router.POST("/api/transfers/volume", postTransferVolume)
 
 	// All the routes beyond this mount will use an authorization middleware
 	// and will not be accessible without the correct Authorization header provided.
 	protected := router.Use(middleware.RequireAuthorization())
 	protected.POST("/api/update", postUpdateConfiguration)
 	protected.GET("/api/system", getSystemInformation)
+	protected.GET("/api/system/reconciler", getReconcilerStatus)
+	protected.POST("/api/system/reconciler", postReconcilerRun)
+	protected.DELETE("/api/system/reconciler/claims/:claim", deleteReconcilerClaim)
+	protected.GET("/api/system/images", getPrePullStatus)
 	protected.GET("/api/servers", getAllServers)
 	protected.POST("/api/servers", postCreateServer)
 	protected.DELETE("/api/transfers/:server", deleteTransfer)
@@ -74,8 +79,10 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 		server.GET("/logs", getServerLogs)
 		server.POST("/power", postServerPower)
 		server.POST("/commands", postServerCommands)
+		server.POST("/exec", postServerExec)
 		server.POST("/install", postServerInstall)
 		server.POST("/reinstall", postServerReinstall)
+		server.POST("/clone", postServerClone)
 		server.POST("/sync", postServerSync)
 		server.POST("/ws/deny", postServerDenyWSTokens)
 
@@ -5,15 +5,21 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
 
+	"github.com/kubectyl/kuber/environment"
+	k8s "github.com/kubectyl/kuber/environment/kubernetes"
+	"github.com/kubectyl/kuber/internal/models"
 	"github.com/kubectyl/kuber/router/downloader"
 	"github.com/kubectyl/kuber/router/middleware"
 	"github.com/kubectyl/kuber/router/tokens"
 	"github.com/kubectyl/kuber/server"
+	"github.com/kubectyl/kuber/server/installer"
 	"github.com/kubectyl/kuber/server/transfer"
 )
 
@@ -135,6 +141,56 @@ func postServerCommands(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// Runs a one-off command in the container of a server and returns its output once it
+// exits. This is meant for support staff inspecting or repairing a server, the command
+// runs in a short-lived pod of its own if the server process is not running.
+func postServerExec(c *gin.Context) {
+	s := ExtractServer(c)
+
+	env, ok := s.Environment.(*k8s.Environment)
+	if !ok {
+		middleware.CaptureAndAbort(c, errors.New("server environment does not support running commands"))
+		return
+	}
+
+	var data struct {
+		Command string `json:"command"`
+		Timeout int    `json:"timeout"`
+		// User is the UUID of the user that requested the command, if any.
+		User string `json:"user"`
+	}
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+	if strings.TrimSpace(data.Command) == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "A command to run must be provided.",
+		})
+		return
+	}
+	if data.Timeout <= 0 || data.Timeout > 300 {
+		data.Timeout = 30
+	}
+
+	// Commands that could not be run are recorded as well, they may still have had an
+	// effect before timing out.
+	meta := models.ActivityMeta{"command": data.Command}
+	res, err := env.RunCommand(c.Request.Context(), data.Command, time.Duration(data.Timeout)*time.Second)
+	if err != nil {
+		meta["error"] = err.Error()
+	} else {
+		meta["exit_code"] = res.ExitCode
+		meta["debug"] = res.Debug
+	}
+	s.SaveActivity(s.NewRequestActivity(data.User, c.ClientIP()), server.ActivityCommandExecuted, meta)
+
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
 // postServerSync will accept a POST request and trigger a re-sync of the given
 // server against the Panel. This can be manually triggered when needed by an
 // external system, or triggered by the Panel itself when modifications are made
@@ -188,6 +244,83 @@ func postServerReinstall(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// Creates a new server with a copy of the files of this server. The new server is
+// installed like any other server afterwards, running the installation script of
+// its egg unless it skips it. The server must be stopped for its files to be copied
+// consistently, and is kept from starting until they have been.
+func postServerClone(c *gin.Context) {
+	s := ExtractServer(c)
+	manager := middleware.ExtractManager(c)
+
+	if _, ok := s.Environment.(*k8s.Environment); !ok {
+		middleware.CaptureAndAbort(c, errors.New("server environment does not support cloning volumes"))
+		return
+	}
+	// The server is marked as being cloned before checking its state, so that it is
+	// not able to start or be cloned again until the clone is running.
+	if !s.StartCloning() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot clone a server that is being installed, transferred, restored or cloned.",
+		})
+		return
+	}
+	var started bool
+	defer func() {
+		if !started {
+			s.SetCloning(false)
+		}
+	}()
+
+	if s.IsInstalling() || s.IsTransferring() || s.IsRestoring() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot clone a server that is being installed, transferred, restored or cloned.",
+		})
+		return
+	}
+	if s.ExecutingPowerAction() || s.Environment.State() != environment.ProcessOfflineState {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot clone a server that is running, it must be stopped first.",
+		})
+		return
+	}
+
+	var details installer.ServerDetails
+	if err := c.BindJSON(&details); err != nil {
+		return
+	}
+	if _, ok := manager.Get(details.UUID); ok {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A server with the provided UUID already exists on this node.",
+		})
+		return
+	}
+
+	install, err := installer.New(c.Request.Context(), manager, details)
+	if err != nil {
+		if installer.IsValidationError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "The data provided in the request could not be validated.",
+			})
+			return
+		}
+
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	started = true
+	manager.Add(install.Server())
+
+	go func() {
+		defer s.SetCloning(false)
+		runInstallation(install, func(target *server.Server) error {
+			return target.CloneFrom(s)
+		})
+	}()
+
+	c.Status(http.StatusAccepted)
+}
+
 // Deletes a server from the wings daemon and dissociate its objects.
 func deleteServer(c *gin.Context) {
 	s := middleware.ExtractServer(c)
@@ -227,11 +360,16 @@ func deleteServer(c *gin.Context) {
 	//
 	// In addition, servers with large amounts of files can take some time to finish deleting,
 	// so we don't want to block the HTTP call while waiting on this.
-	go func(p string) {
-		if err := os.RemoveAll(p); err != nil {
-			log.WithFields(log.Fields{"path": p, "error": err}).Warn("failed to remove server files during deletion process")
-		}
-	}(s.Filesystem().Path())
+	//
+	// Files stored on a volume were already removed along with the volume when the environment
+	// was destroyed.
+	if !s.Filesystem().IsRemote() {
+		go func(p string) {
+			if err := os.RemoveAll(p); err != nil {
+				log.WithFields(log.Fields{"path": p, "error": err}).Warn("failed to remove server files during deletion process")
+			}
+		}(s.Filesystem().Path())
+	}
 
 	middleware.ExtractManager(c).Remove(func(server *server.Server) bool {
 		return server.ID() == s.ID()
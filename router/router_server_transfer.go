@@ -79,7 +79,13 @@ func postServerTransfer(c *gin.Context) {
 	go func() {
 		defer transfer.Outgoing().Remove(trnsfr)
 
-		if _, err := trnsfr.PushArchiveToTarget(data.URL, data.Token); err != nil {
+		// Servers on a node sharing the cluster with the target can hand over their volume
+		// directly, otherwise all the files are streamed to the target as an archive.
+		handed, err := trnsfr.HandoffVolume(data.URL, data.Token)
+		if err == nil && !handed {
+			_, err = trnsfr.PushArchiveToTarget(data.URL, data.Token)
+		}
+		if err != nil {
 			notifyPanelOfFailure()
 
 			if err == context.Canceled {
@@ -88,7 +94,7 @@ func postServerTransfer(c *gin.Context) {
 				return
 			}
 
-			trnsfr.Log().WithError(err).Error("failed to push archive to target")
+			trnsfr.Log().WithError(err).Error("failed to transfer server to target")
 			return
 		}
 
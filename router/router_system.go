@@ -13,6 +13,9 @@ import (
 	"k8s.io/client-go/rest"
 
 	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/internal/prepull"
+	"github.com/kubectyl/kuber/internal/reconciler"
 	"github.com/kubectyl/kuber/router/middleware"
 	"github.com/kubectyl/kuber/server"
 	"github.com/kubectyl/kuber/server/installer"
@@ -84,6 +87,64 @@ func getAllServers(c *gin.Context) {
 	c.JSON(http.StatusOK, out)
 }
 
+// Returns the current state of the cluster reconciler along with the most recent
+// actions it has taken against the cluster.
+func getReconcilerStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, reconciler.Instance().Status())
+}
+
+// Triggers a reconciliation run in the background.
+func postReconcilerRun(c *gin.Context) {
+	r := reconciler.Instance()
+	if !ha.IsLeader() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Reconciliation is only processed by the leader replica of this instance.",
+		})
+		return
+	}
+	if r.Status().Running {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A reconciliation process is already running on this instance.",
+		})
+		return
+	}
+
+	go func() {
+		if err := r.Run(context.Background()); err != nil && !errors.Is(err, reconciler.ErrReconcilerRunning) {
+			log.WithField("error", err).Error("failed to reconcile cluster state")
+		}
+	}()
+
+	c.Status(http.StatusAccepted)
+}
+
+// Removes a persistent volume claim that the reconciler marked as orphaned,
+// which permanently deletes the data of the server it belonged to.
+func deleteReconcilerClaim(c *gin.Context) {
+	err := reconciler.Instance().DeleteOrphanedClaim(c.Request.Context(), c.Param("claim"))
+	if err != nil {
+		if errors.Is(err, reconciler.ErrClaimNotOrphaned) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "The persistent volume claim is not marked as orphaned by the reconciler.",
+			})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Returns the state of the images pre-pulled onto the nodes of the cluster.
+func getPrePullStatus(c *gin.Context) {
+	st, err := prepull.Instance().Status(c.Request.Context())
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
 // Creates a new server on the wings daemon and begins the installation process
 // for it.
 func postCreateServer(c *gin.Context) {
@@ -114,32 +175,36 @@ func postCreateServer(c *gin.Context) {
 	// Begin the installation process in the background to not block the request
 	// cycle. If there are any errors they will be logged and communicated back
 	// to the Panel where a reinstall may take place.
-	go func(i *installer.Installer) {
-		if err := i.Server().CreateEnvironment(); err != nil {
-			i.Server().Log().WithField("error", err).Error("failed to create server environment during install process")
-			return
-		}
+	go runInstallation(install, (*server.Server).Install)
 
-		if err := i.Server().Install(); err != nil {
-			log.WithFields(log.Fields{"server": i.Server().ID(), "error": err}).Error("failed to run install process for server")
-			return
-		}
+	c.Status(http.StatusAccepted)
+}
 
-		if i.StartOnCompletion {
-			log.WithField("server_id", i.Server().ID()).Debug("starting server after successful installation")
-			if err := i.Server().HandlePowerAction(server.PowerActionStart, 30); err != nil {
-				if errors.Is(err, context.DeadlineExceeded) {
-					log.WithFields(log.Fields{"server_id": i.Server().ID(), "action": "start"}).Warn("could not acquire a lock while attempting to perform a power action")
-				} else {
-					log.WithFields(log.Fields{"server_id": i.Server().ID(), "action": "start", "error": err}).Error("encountered error processing a server power action in the background")
-				}
+// runInstallation creates the environment of a new server and installs it using
+// the given function, starting the server afterwards if that was requested.
+func runInstallation(i *installer.Installer, install func(s *server.Server) error) {
+	if err := i.Server().CreateEnvironment(); err != nil {
+		i.Server().Log().WithField("error", err).Error("failed to create server environment during install process")
+		return
+	}
+
+	if err := install(i.Server()); err != nil {
+		log.WithFields(log.Fields{"server": i.Server().ID(), "error": err}).Error("failed to run install process for server")
+		return
+	}
+
+	if i.StartOnCompletion {
+		log.WithField("server_id", i.Server().ID()).Debug("starting server after successful installation")
+		if err := i.Server().HandlePowerAction(server.PowerActionStart, 30); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				log.WithFields(log.Fields{"server_id": i.Server().ID(), "action": "start"}).Warn("could not acquire a lock while attempting to perform a power action")
+			} else {
+				log.WithFields(log.Fields{"server_id": i.Server().ID(), "action": "start", "error": err}).Error("encountered error processing a server power action in the background")
 			}
-		} else {
-			log.WithField("server_id", i.Server().ID()).Debug("skipping automatic start after successful server installation")
 		}
-	}(install)
-
-	c.Status(http.StatusAccepted)
+	} else {
+		log.WithField("server_id", i.Server().ID()).Debug("skipping automatic start after successful server installation")
+	}
 }
 
 // Updates the running configuration for this Wings instance.
@@ -148,6 +213,10 @@ func postUpdateConfiguration(c *gin.Context) {
 	if err := c.BindJSON(&cfg); err != nil {
 		return
 	}
+	if err := cfg.Cluster.Storage.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Keep the SSL certificates the same since the Panel will send through Lets Encrypt
 	// default locations. However, if we picked a different location manually we don't
@@ -17,7 +17,9 @@ import (
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
+	k8s "github.com/kubectyl/kuber/environment/kubernetes"
 	"github.com/kubectyl/kuber/router/middleware"
 	"github.com/kubectyl/kuber/router/tokens"
 	"github.com/kubectyl/kuber/server"
@@ -27,98 +29,27 @@ import (
 
 // postTransfers .
 func postTransfers(c *gin.Context) {
-	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
-	if len(auth) != 2 || auth[0] != "Bearer" {
-		c.Header("WWW-Authenticate", "Bearer")
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"error": "The required authorization heads were not present in the request.",
-		})
-		return
-	}
-
-	token := tokens.TransferPayload{}
-	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
-		middleware.CaptureAndAbort(c, err)
+	u, ok := transferSubject(c)
+	if !ok {
 		return
 	}
 
 	manager := middleware.ExtractManager(c)
-	u, err := uuid.Parse(token.Subject)
-	if err != nil {
-		middleware.CaptureAndAbort(c, err)
+	trnsfr, ok := incomingTransfer(c, manager, u)
+	if !ok {
 		return
 	}
 
-	// Get or create a new transfer instance for this server.
-	var (
-		ctx    context.Context
-		cancel context.CancelFunc
-	)
-	trnsfr := transfer.Incoming().Get(u.String())
-	if trnsfr == nil {
-		// TODO: should this use the request context?
-		trnsfr = transfer.New(c, nil)
-
-		ctx, cancel = context.WithCancel(trnsfr.Context())
-		defer cancel()
-
-		i, err := installer.New(ctx, manager, installer.ServerDetails{
-			UUID:              u.String(),
-			StartOnCompletion: false,
-		})
-		if err != nil {
-			if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), false); err != nil {
-				trnsfr.Log().WithField("status", false).WithError(err).Error("failed to set transfer status")
-			}
-			middleware.CaptureAndAbort(c, err)
-			return
-		}
-
-		i.Server().SetTransferring(true)
-		manager.Add(i.Server())
-
-		// We add the transfer to the list of transfers once we have a server instance to use.
-		trnsfr.Server = i.Server()
-		transfer.Incoming().Add(trnsfr)
-	} else {
-		ctx, cancel = context.WithCancel(trnsfr.Context())
-		defer cancel()
-	}
+	ctx, cancel := context.WithCancel(trnsfr.Context())
+	defer cancel()
 
 	// Any errors past this point (until the transfer is complete) will abort
 	// the transfer.
 
 	successful := false
-	defer func(ctx context.Context, trnsfr *transfer.Transfer) {
-		// Remove the transfer from the list of incoming transfers.
-		transfer.Incoming().Remove(trnsfr)
-
-		if !successful {
-			trnsfr.Server.Events().Publish(server.TransferStatusEvent, "failure")
-			manager.Remove(func(match *server.Server) bool {
-				return match.ID() == trnsfr.Server.ID()
-			})
-		}
-
-		if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), successful); err != nil {
-			// Only delete the files if the transfer actually failed, otherwise we could have
-			// unrecoverable data-loss.
-			if !successful && err != nil {
-				// Delete all extracted files.
-				go func(trnsfr *transfer.Transfer) {
-					if err := os.RemoveAll(trnsfr.Server.Filesystem().Path()); err != nil && !os.IsNotExist(err) {
-						trnsfr.Log().WithError(err).Warn("failed to delete local server files")
-					}
-				}(trnsfr)
-			}
-
-			trnsfr.Log().WithField("status", successful).WithError(err).Error("failed to set transfer status on panel")
-			return
-		}
-
-		trnsfr.Server.SetTransferring(false)
-		trnsfr.Server.Events().Publish(server.TransferStatusEvent, "success")
-	}(ctx, trnsfr)
+	defer func(trnsfr *transfer.Transfer) {
+		finishIncomingTransfer(manager, trnsfr, successful)
+	}(trnsfr)
 
 	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
 	if err != nil {
@@ -170,6 +101,15 @@ out:
 					return
 				}
 
+				// The volume of a server is otherwise created by its installation, which
+				// never runs for servers that are transferred.
+				if env, ok := trnsfr.Server.Environment.(*k8s.Environment); ok {
+					if err := env.CreateVolume(ctx, trnsfr.Server.StorageTier()); err != nil && !apierrors.IsAlreadyExists(err) {
+						middleware.CaptureAndAbort(c, err)
+						return
+					}
+				}
+
 				tee := io.TeeReader(p, h)
 				if err := trnsfr.Server.Filesystem().ExtractStreamUnsafe(ctx, "/", tee); err != nil {
 					middleware.CaptureAndAbort(c, err)
@@ -248,6 +188,165 @@ out:
 	trnsfr.Log().Debug("done!")
 }
 
+// postTransferVolume is called by another daemon managing the same cluster to
+// hand over the persistent volume of a server instead of streaming its files.
+// A conflict is returned if the volume cannot be used by this node, in which
+// case the source node falls back to streaming an archive to postTransfers.
+func postTransferVolume(c *gin.Context) {
+	u, ok := transferSubject(c)
+	if !ok {
+		return
+	}
+
+	var data k8s.VolumeHandoff
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	// Nothing must be created for the server until it is known that the volume can be
+	// used, otherwise the transfer would be marked as failed before the archive is sent.
+	if err := k8s.CanAdoptVolume(c.Request.Context(), data); err != nil {
+		if !errors.Is(err, k8s.ErrVolumeNotTransferable) {
+			log.WithField("server", u.String()).WithField("error", err).Warn("failed to check if volume can be handed over")
+		}
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "The volume of this server cannot be handed over to this node.",
+		})
+		return
+	}
+
+	manager := middleware.ExtractManager(c)
+	trnsfr, ok := incomingTransfer(c, manager, u)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(trnsfr.Context())
+	defer cancel()
+
+	successful := false
+	defer func(trnsfr *transfer.Transfer) {
+		finishIncomingTransfer(manager, trnsfr, successful)
+	}(trnsfr)
+
+	env, ok := trnsfr.Server.Environment.(*k8s.Environment)
+	if !ok {
+		middleware.CaptureAndAbort(c, errors.New("server environment does not support volume handoff"))
+		return
+	}
+
+	trnsfr.Log().WithField("claim", data.Namespace+"/"+data.Claim).Debug("adopting volume")
+	if err := env.AdoptVolume(ctx, data); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	if err := trnsfr.Server.CreateEnvironment(); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	successful = true
+	trnsfr.Log().Debug("done!")
+	c.Status(http.StatusOK)
+}
+
+// transferSubject validates the transfer token sent by the source node and
+// returns the UUID of the server being transferred. The request is aborted if
+// the token is missing or invalid.
+func transferSubject(c *gin.Context) (uuid.UUID, bool) {
+	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != "Bearer" {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "The required authorization heads were not present in the request.",
+		})
+		return uuid.UUID{}, false
+	}
+
+	token := tokens.TransferPayload{}
+	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return uuid.UUID{}, false
+	}
+
+	u, err := uuid.Parse(token.Subject)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return uuid.UUID{}, false
+	}
+	return u, true
+}
+
+// incomingTransfer returns the incoming transfer for a server, creating the
+// server on this node if this is the first request received for the transfer.
+func incomingTransfer(c *gin.Context, manager *server.Manager, u uuid.UUID) (*transfer.Transfer, bool) {
+	if trnsfr := transfer.Incoming().Get(u.String()); trnsfr != nil {
+		return trnsfr, true
+	}
+
+	// TODO: should this use the request context?
+	trnsfr := transfer.New(c, nil)
+
+	ctx, cancel := context.WithCancel(trnsfr.Context())
+	defer cancel()
+
+	i, err := installer.New(ctx, manager, installer.ServerDetails{
+		UUID:              u.String(),
+		StartOnCompletion: false,
+	})
+	if err != nil {
+		if err := manager.Client().SetTransferStatus(context.Background(), u.String(), false); err != nil {
+			trnsfr.Log().WithField("status", false).WithError(err).Error("failed to set transfer status")
+		}
+		middleware.CaptureAndAbort(c, err)
+		return nil, false
+	}
+
+	i.Server().SetTransferring(true)
+	manager.Add(i.Server())
+
+	// We add the transfer to the list of transfers once we have a server instance to use.
+	trnsfr.Server = i.Server()
+	transfer.Incoming().Add(trnsfr)
+
+	return trnsfr, true
+}
+
+// finishIncomingTransfer removes the transfer from the list of incoming
+// transfers and reports the outcome of it to the Panel. Servers that failed to
+// transfer are removed from this node.
+func finishIncomingTransfer(manager *server.Manager, trnsfr *transfer.Transfer, successful bool) {
+	// Remove the transfer from the list of incoming transfers.
+	transfer.Incoming().Remove(trnsfr)
+
+	if !successful {
+		trnsfr.Server.Events().Publish(server.TransferStatusEvent, "failure")
+		manager.Remove(func(match *server.Server) bool {
+			return match.ID() == trnsfr.Server.ID()
+		})
+	}
+
+	if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), successful); err != nil {
+		// Only delete the files if the transfer actually failed, otherwise we could have
+		// unrecoverable data-loss.
+		if !successful && err != nil {
+			// Delete all extracted files.
+			go func(trnsfr *transfer.Transfer) {
+				if err := os.RemoveAll(trnsfr.Server.Filesystem().Path()); err != nil && !os.IsNotExist(err) {
+					trnsfr.Log().WithError(err).Warn("failed to delete local server files")
+				}
+			}(trnsfr)
+		}
+
+		trnsfr.Log().WithField("status", successful).WithError(err).Error("failed to set transfer status on panel")
+		return
+	}
+
+	trnsfr.Server.SetTransferring(false)
+	trnsfr.Server.Events().Publish(server.TransferStatusEvent, "success")
+}
+
 // deleteTransfer cancels an incoming transfer for a server.
 func deleteTransfer(c *gin.Context) {
 	s := ExtractServer(c)
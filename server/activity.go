@@ -7,6 +7,7 @@ import (
 	"emperror.dev/errors"
 
 	"github.com/kubectyl/kuber/internal/database"
+	"github.com/kubectyl/kuber/internal/ha"
 	"github.com/kubectyl/kuber/internal/models"
 )
 
@@ -20,6 +21,7 @@ const (
 	ActivitySftpRename          = models.Event("server:sftp.rename")
 	ActivitySftpDelete          = models.Event("server:sftp.delete")
 	ActivityFileUploaded        = models.Event("server:file.uploaded")
+	ActivityCommandExecuted     = models.Event("server:exec")
 )
 
 // RequestActivity is a wrapper around a LoggedEvent that is able to track additional request
@@ -52,13 +54,20 @@ func (s *Server) NewRequestActivity(user string, ip string) RequestActivity {
 }
 
 // SaveActivity saves an activity entry to the database in a background routine. If an error is
-// encountered it is logged but not returned to the caller.
+// encountered it is logged but not returned to the caller. In high availability mode the entry
+// is stored in the cluster instead, so that it is not lost along with this replica.
 func (s *Server) SaveActivity(a RequestActivity, event models.Event, metadata models.ActivityMeta) {
 	ctx, cancel := context.WithTimeout(s.Context(), time.Second*3)
 	go func() {
 		defer cancel()
-		if tx := database.Instance().WithContext(ctx).Create(a.Event(event, metadata)); tx.Error != nil {
-			s.Log().WithField("error", errors.WithStack(tx.Error)).
+		var err error
+		if ha.Enabled() {
+			err = ha.PushActivity(ctx, a.Event(event, metadata))
+		} else if tx := database.Instance().WithContext(ctx).Create(a.Event(event, metadata)); tx.Error != nil {
+			err = errors.WithStack(tx.Error)
+		}
+		if err != nil {
+			s.Log().WithField("error", err).
 				WithField("event", event).
 				Error("activity: failed to save event")
 		}
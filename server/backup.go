@@ -1,9 +1,12 @@
 package server
 
 import (
+	"archive/tar"
 	"io"
 	"io/fs"
 	"os"
+	"path"
+	"strings"
 	"time"
 
 	"emperror.dev/errors"
@@ -67,7 +70,7 @@ func (s *Server) Backup(b backup.BackupInterface) error {
 		}
 	}
 
-	ad, err := b.Generate(s.Context(), s.Filesystem().Path(), ignored)
+	ad, err := b.Generate(s.Context(), s.Filesystem(), ignored)
 	if err != nil {
 		if err := s.notifyPanelOfBackup(b.Identifier(), &backup.ArchiveDetails{}, false); err != nil {
 			s.Log().WithFields(log.Fields{
@@ -148,6 +151,13 @@ func (s *Server) RestoreBackup(b backup.BackupInterface, reader io.ReadCloser) (
 		}
 	}
 
+	// Files stored on a volume are restored by streaming the entire archive into it
+	// rather than writing every file individually.
+	if s.Filesystem().IsRemote() {
+		s.Log().Debug("starting archive streaming process for backup restoration")
+		return errors.WithStackIf(s.restoreBackupToVolume(b, reader))
+	}
+
 	// Attempt to restore the backup to the server by running through each entry
 	// in the file one at a time and writing them to the disk.
 	s.Log().Debug("starting file writing process for backup restoration")
@@ -169,3 +179,54 @@ func (s *Server) RestoreBackup(b backup.BackupInterface, reader io.ReadCloser) (
 
 	return errors.WithStackIf(err)
 }
+
+// restoreBackupToVolume restores the backup by writing every file in it to a single
+// archive which is streamed into the volume of the server.
+func (s *Server) restoreBackupToVolume(b backup.BackupInterface, reader io.Reader) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.Filesystem().Backend().Untar(s.Context(), s.Filesystem().Path(), pr)
+		// Make sure any further writes fail if the extraction stopped early.
+		_ = pr.CloseWithError(err)
+		done <- err
+	}()
+
+	tw := tar.NewWriter(pw)
+	err := b.Restore(s.Context(), reader, func(file string, info fs.FileInfo, r io.ReadCloser) error {
+		defer r.Close()
+
+		// Only files and directories are restored, this matches the behavior of restoring
+		// a backup to the local disk and prevents anything from being written outside the
+		// server data directory.
+		name := path.Clean(file)
+		if (!info.Mode().IsRegular() && !info.IsDir()) || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return nil
+		}
+		s.Events().Publish(DaemonMessageEvent, "(restoring): "+file)
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = strings.TrimPrefix(name, "/")
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	_ = pw.CloseWithError(err)
+
+	if uerr := <-done; err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Filesystem().Chown("/")
+}
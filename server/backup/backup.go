@@ -16,6 +16,7 @@ import (
 
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/remote"
+	"github.com/kubectyl/kuber/server/filesystem"
 )
 
 var format = archiver.CompressedArchive{
@@ -44,9 +45,9 @@ type BackupInterface interface {
 	// WithLogContext attaches additional context to the log output for this
 	// backup.
 	WithLogContext(map[string]interface{})
-	// Generate creates a backup in whatever the configured source for the
-	// specific implementation is.
-	Generate(context.Context, string, string) (*ArchiveDetails, error)
+	// Generate creates a backup of the given filesystem in whatever the configured
+	// source for the specific implementation is.
+	Generate(context.Context, *filesystem.Filesystem, string) (*ArchiveDetails, error)
 	// Ignored returns the ignored files for this backup instance.
 	Ignored() string
 	// Checksum returns a SHA1 checksum for the generated backup.
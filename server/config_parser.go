@@ -1,9 +1,16 @@
 package server
 
 import (
+	"io"
+	"os"
+	"path/filepath"
 	"runtime"
 
+	"emperror.dev/errors"
 	"github.com/gammazero/workerpool"
+
+	"github.com/kubectyl/kuber/parser"
+	"github.com/kubectyl/kuber/server/filesystem"
 )
 
 // UpdateConfigurationFiles updates all of the defined configuration files for
@@ -25,7 +32,12 @@ func (s *Server) UpdateConfigurationFiles() {
 				return
 			}
 
-			if err := f.Parse(p, false); err != nil {
+			if s.Filesystem().IsRemote() {
+				err = s.parseRemoteConfigurationFile(f, p)
+			} else {
+				err = f.Parse(p, false)
+			}
+			if err != nil {
 				s.Log().WithField("error", err).Error("failed to parse and update server configuration file")
 			}
 
@@ -35,3 +47,53 @@ func (s *Server) UpdateConfigurationFiles() {
 
 	pool.StopWait()
 }
+
+// parseRemoteConfigurationFile updates a configuration file that is not stored on
+// the local disk. The file is copied into a temporary directory, parsed there, and
+// then written back to the server filesystem.
+func (s *Server) parseRemoteConfigurationFile(f parser.ConfigurationFile, p string) error {
+	dir, err := os.MkdirTemp("", "kuber-config-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, filepath.Base(p))
+	if err := s.copyConfigurationFile(p, local); err != nil {
+		return err
+	}
+
+	if err := f.Parse(local, false); err != nil {
+		return err
+	}
+
+	updated, err := os.Open(local)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer updated.Close()
+
+	return s.Filesystem().Writefile(p, updated)
+}
+
+// copyConfigurationFile copies the configuration file from the server filesystem
+// to the given local path, if it exists.
+func (s *Server) copyConfigurationFile(p string, local string) error {
+	src, _, err := s.Filesystem().File(p)
+	if err != nil {
+		if filesystem.IsErrorCode(err, filesystem.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(local)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return errors.WithStack(err)
+}
@@ -3,7 +3,9 @@ package server
 import (
 	"sync"
 
+	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/remote"
 )
 
 type EggConfiguration struct {
@@ -19,6 +21,9 @@ type EggConfiguration struct {
 type ConfigurationMeta struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+
+	// Owner is the UUID of the user owning the server.
+	Owner string `json:"owner"`
 }
 
 type Configuration struct {
@@ -55,6 +60,27 @@ type Configuration struct {
 	Mounts                []Mount                 `json:"mounts"`
 	Egg                   EggConfiguration        `json:"egg,omitempty"`
 
+	// HealthCheck overrides the health check defined by the egg of the server.
+	HealthCheck *remote.HealthCheck `json:"health_check,omitempty"`
+
+	// Tmp overrides the volume mounted at /tmp defined by the configuration of the node.
+	Tmp *config.TmpVolume `json:"tmp,omitempty"`
+
+	// Dns overrides how the server resolves names defined by the configuration of the node.
+	Dns *config.DnsConfiguration `json:"dns,omitempty"`
+
+	// HostNetwork runs the server in the network namespace of its node, if the configuration
+	// of the node allows it.
+	HostNetwork bool `json:"host_network"`
+
+	// IPFamilies overrides the IP families of the service of the server defined by the
+	// configuration of the node.
+	IPFamilies *config.IPFamilyConfiguration `json:"ip_families,omitempty"`
+
+	// Internal only exposes the allocations of the server inside of the cluster, where
+	// they are reachable by the other servers in its network group.
+	Internal bool `json:"internal"`
+
 	Container struct {
 		// Defines the Docker image that will be used for this server
 		Image string `json:"image,omitempty"`
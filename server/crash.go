@@ -59,10 +59,23 @@ func (s *Server) handleServerCrash() error {
 	if err != nil {
 		return err
 	}
+	// The reason only adds detail to the crash, so a server that cannot be inspected is
+	// still treated as having crashed.
+	reason, err := s.Environment.ExitReason()
+	if err != nil {
+		s.Log().WithField("error", err).Warn("failed to determine exit reason of server process")
+		reason = ""
+	}
+	// A process killed by the environment exits with the same code as one killed for
+	// running out of memory.
+	if reason != "" {
+		oomKilled = false
+	}
 
 	// If the system is not configured to detect a clean exit code as a crash, and the
-	// crash is not the result of the program running out of memory, do nothing.
-	if exitCode == 0 && !oomKilled && !config.Get().System.CrashDetection.DetectCleanExitAsCrash {
+	// crash is not the result of the program running out of memory or being killed by
+	// the environment, do nothing.
+	if exitCode == 0 && !oomKilled && reason == "" && !config.Get().System.CrashDetection.DetectCleanExitAsCrash {
 		s.Log().Debug("server exited with successful exit code; system is configured to not detect this as a crash")
 		return nil
 	}
@@ -70,6 +83,9 @@ func (s *Server) handleServerCrash() error {
 	s.PublishConsoleOutputFromDaemon("---------- Detected server process in a crashed state! ----------")
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Exit code: %d", exitCode))
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Out of memory: %t", oomKilled))
+	if reason != "" {
+		s.PublishConsoleOutputFromDaemon("Reason: " + exitReasonMessage(reason))
+	}
 
 	c := s.crasher.LastCrashTime()
 	timeout := config.Get().System.CrashDetection.Timeout
@@ -87,3 +103,20 @@ func (s *Server) handleServerCrash() error {
 
 	return s.HandlePowerAction(PowerActionStart)
 }
+
+// exitReasonMessage returns a description of why the environment stopped the
+// server process that can be displayed to the user.
+func exitReasonMessage(reason string) string {
+	switch reason {
+	case environment.ExitReasonLivenessProbe:
+		return "Server process failed its health check"
+	case environment.ExitReasonEphemeralStorage:
+		return "Server was evicted for exceeding its temporary storage limit, check the size of /tmp and of files written outside of the server directory"
+	case environment.ExitReasonEvicted:
+		return "Server was evicted from its node by the cluster"
+	case environment.ExitReasonPreempted:
+		return "Server was preempted to make room for a server with a higher priority"
+	default:
+		return reason
+	}
+}
@@ -10,6 +10,7 @@ var (
 	ErrServerIsInstalling   = errors.New("server is currently installing")
 	ErrServerIsTransferring = errors.New("server is currently being transferred")
 	ErrServerIsRestoring    = errors.New("server is currently being restored")
+	ErrServerIsCloning      = errors.New("server is currently being cloned")
 )
 
 type crashTooFrequent struct{}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -70,6 +71,9 @@ type Archive struct {
 
 	// Progress wraps the writer of the archive to pass through the progress tracker.
 	Progress *progress.Progress
+
+	// Backend, when set, is used to read the files at BasePath instead of the local disk.
+	Backend Backend
 }
 
 // Create creates an archive at dst with all the files defined in the
@@ -121,6 +125,10 @@ func (a *Archive) Stream(ctx context.Context, w io.Writer) error {
 
 	pw := NewTarProgress(tw, a.Progress)
 
+	if a.Backend != nil {
+		return a.streamBackend(ctx, pw)
+	}
+
 	// Configure godirwalk.
 	options := &godirwalk.Options{
 		FollowSymbolicLinks: false,
@@ -189,17 +197,7 @@ func (a *Archive) callback(tw *TarProgress, opts ...func(path string, relative s
 // Pushes only files defined in the Files key to the final archive.
 func (a *Archive) withFilesCallback(tw *TarProgress) func(path string, de *godirwalk.Dirent) error {
 	return a.callback(tw, func(p string, rp string) error {
-		for _, f := range a.Files {
-			// If the given doesn't match, or doesn't have the same prefix continue
-			// to the next item in the loop.
-			if p != f && !strings.HasPrefix(strings.TrimSuffix(p, "/")+"/", f) {
-				continue
-			}
-
-			// Once we have a match return a nil value here so that the loop stops and the
-			// call to this function will correctly include the file in the archive. If there
-			// are no matches we'll never make it to this line, and the final error returned
-			// will be the godirwalk.SkipThis error.
+		if a.includes(p) {
 			return nil
 		}
 
@@ -207,6 +205,111 @@ func (a *Archive) withFilesCallback(tw *TarProgress) func(path string, de *godir
 	})
 }
 
+// Checks if the given path matches, or is within, one of the files defined in the
+// Files key.
+func (a *Archive) includes(p string) bool {
+	for _, f := range a.Files {
+		// If the given doesn't match, or doesn't have the same prefix continue
+		// to the next item in the loop.
+		if p != f && !strings.HasPrefix(strings.TrimSuffix(p, "/")+"/", f) {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Copies the files read from the backend into the final archive, applying the same
+// Files and Ignore rules as when reading from the local disk.
+func (a *Archive) streamBackend(ctx context.Context, w *TarProgress) error {
+	var i *ignore.GitIgnore
+	var exclude []string
+	if len(a.Files) == 0 && len(a.Ignore) > 0 {
+		lines := strings.Split(a.Ignore, "\n")
+		i = ignore.CompileIgnoreLines(lines...)
+		exclude = tarExcludes(lines)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(a.Backend.Tar(ctx, a.BasePath, exclude, pw))
+	}()
+
+	tr := tar.NewReader(pr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WrapIf(err, "failed to read archive from backend")
+		}
+
+		// Skip directories, files nested in a directory will automatically "create" it
+		// in the archive.
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		rp := path.Clean(header.Name)
+		if rp == "." || rp == ".." || strings.HasPrefix(rp, "../") {
+			continue
+		}
+		if i != nil && i.MatchesPath(rp) {
+			continue
+		}
+		if len(a.Files) > 0 && !a.includes(filepath.Join(a.BasePath, rp)) {
+			continue
+		}
+
+		header.Name = rp
+		if err := w.WriteHeader(header); err != nil {
+			return errors.WrapIff(err, "failed to write tar#FileInfoHeader for '%s'", rp)
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return errors.WrapIff(err, "failed to copy '%s' to archive", rp)
+		}
+	}
+}
+
+// Converts the lines of a gitignore file into patterns for tar to exclude, so that
+// ignored files are not read from the backend at all. Only patterns which exclude
+// the same files in both are converted, the rest are left to the ignore rules
+// applied while reading the archive. Negated patterns may include files again that
+// an earlier pattern excluded, so nothing is excluded by tar if there are any.
+func tarExcludes(lines []string) []string {
+	var out []string
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if strings.HasPrefix(l, "!") {
+			return nil
+		}
+		// Patterns only matching directories or using escapes have no equivalent in
+		// tar, and not every tar implementation keeps wildcards from matching slashes.
+		if strings.HasSuffix(l, "/") || strings.ContainsAny(l, "\\[") {
+			continue
+		}
+		if strings.Contains(l, "/") {
+			if strings.ContainsAny(l, "*?") {
+				continue
+			}
+			// Patterns containing a slash are relative to the root in a gitignore file.
+			l = "./" + strings.TrimPrefix(l, "/")
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
 // Adds a given file path to the final archive being created.
 func (a *Archive) addToArchive(p string, rp string, w *TarProgress) error {
 	// Lstat the file, this will give us the same information as Stat except that it will not
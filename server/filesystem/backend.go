@@ -0,0 +1,175 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backend performs file operations for a Filesystem somewhere other than the
+// local disk, such as on the volume attached to a server in the cluster. Every
+// path passed to a backend is an absolute path that has already been resolved
+// within the root directory of the Filesystem, backends are responsible for
+// mapping it onto their own storage.
+//
+// Errors for missing files must match os.ErrNotExist, and errors for files that
+// already exist must match os.ErrExist, so that the Filesystem is able to return
+// the same error codes regardless of the backend in use.
+type Backend interface {
+	// Stat returns information about the file at the given path, following any
+	// symlinks. Stat.Mimetype is populated for regular files.
+	Stat(p string) (Stat, error)
+
+	// Lstat returns information about the file at the given path without following
+	// a symlink.
+	Lstat(p string) (os.FileInfo, error)
+
+	// ReadDir returns information about every file in a directory, without following
+	// symlinks. Stat.Mimetype is populated for every entry.
+	ReadDir(p string) ([]Stat, error)
+
+	// EvalSymlinks returns the path after evaluating any symlinks, or an error
+	// matching os.ErrNotExist if the path does not exist.
+	EvalSymlinks(p string) (string, error)
+
+	// Open returns a reader for the contents of the file.
+	Open(p string) (io.ReadCloser, error)
+
+	// WriteFile writes the contents of the reader to the file, creating it and any
+	// parent directories as necessary, and returns the number of bytes written.
+	WriteFile(p string, r io.Reader) (int64, error)
+
+	MkdirAll(p string, perm os.FileMode) error
+	Rename(from string, to string) error
+	RemoveAll(p string) error
+	Chmod(p string, mode os.FileMode) error
+	Chtimes(p string, atime time.Time, mtime time.Time) error
+
+	// Chown changes the owner of the path and everything within it, without ever
+	// following a symlink.
+	Chown(p string, uid int, gid int) error
+
+	// DirectorySize returns the combined size in bytes of every file within the
+	// directory.
+	DirectorySize(p string) (int64, error)
+
+	// Archive creates a gzip compressed tarball at dst containing the given files,
+	// which are relative to dir.
+	Archive(ctx context.Context, dir string, files []string, dst string) error
+
+	// Tar writes an uncompressed tarball containing everything within the directory
+	// to w, with the names of the entries relative to the directory. Entries matching
+	// any of the exclude patterns, as understood by tar, are left out.
+	Tar(ctx context.Context, dir string, exclude []string, w io.Writer) error
+
+	// Untar extracts the uncompressed tarball read from r into the directory.
+	Untar(ctx context.Context, dir string, r io.Reader) error
+}
+
+// SetBackend configures the Filesystem to perform all file operations through the
+// given backend rather than on the local disk.
+func (fs *Filesystem) SetBackend(b Backend) {
+	fs.backendMu.Lock()
+	fs.backend = b
+	fs.backendMu.Unlock()
+}
+
+// Backend returns the backend used by the Filesystem, or nil if the files are
+// stored on the local disk.
+func (fs *Filesystem) Backend() Backend {
+	return fs.remote()
+}
+
+// IsRemote returns true if the files for this Filesystem are not stored on the
+// local disk, in which case Path() cannot be used to access them directly.
+func (fs *Filesystem) IsRemote() bool {
+	return fs.remote() != nil
+}
+
+func (fs *Filesystem) remote() Backend {
+	fs.backendMu.RLock()
+	defer fs.backendMu.RUnlock()
+	return fs.backend
+}
+
+func (fs *Filesystem) stat(p string) (os.FileInfo, error) {
+	if b := fs.remote(); b != nil {
+		st, err := b.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		return st.FileInfo, nil
+	}
+	return os.Stat(p)
+}
+
+func (fs *Filesystem) lstat(p string) (os.FileInfo, error) {
+	if b := fs.remote(); b != nil {
+		return b.Lstat(p)
+	}
+	return os.Lstat(p)
+}
+
+func (fs *Filesystem) evalSymlinks(p string) (string, error) {
+	if b := fs.remote(); b != nil {
+		return b.EvalSymlinks(p)
+	}
+	return filepath.EvalSymlinks(p)
+}
+
+func (fs *Filesystem) open(p string) (io.ReadCloser, error) {
+	if b := fs.remote(); b != nil {
+		return b.Open(p)
+	}
+	return os.Open(p)
+}
+
+func (fs *Filesystem) mkdirAll(p string, perm os.FileMode) error {
+	if b := fs.remote(); b != nil {
+		return b.MkdirAll(p, perm)
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (fs *Filesystem) rename(from string, to string) error {
+	if b := fs.remote(); b != nil {
+		return b.Rename(from, to)
+	}
+	return os.Rename(from, to)
+}
+
+func (fs *Filesystem) removeAll(p string) error {
+	if b := fs.remote(); b != nil {
+		return b.RemoveAll(p)
+	}
+	return os.RemoveAll(p)
+}
+
+// openTemporary copies the contents of a file from the backend into an unlinked
+// temporary file on the local disk so that it can be returned as an *os.File.
+func (fs *Filesystem) openTemporary(p string) (*os.File, error) {
+	r, err := fs.open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp("", "kuber-file-")
+	if err != nil {
+		return nil, err
+	}
+	// The file remains readable through the open handle once it has been removed, and
+	// is cleaned up automatically when the handle is closed.
+	_ = os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,206 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+// diskBackend is a Backend that stores the files on the local disk, which makes
+// the Filesystem use the code paths for files stored elsewhere.
+type diskBackend struct {
+	calls int64
+}
+
+func (b *diskBackend) call() { atomic.AddInt64(&b.calls, 1) }
+
+func (b *diskBackend) Stat(p string) (Stat, error) {
+	b.call()
+	st, err := os.Stat(p)
+	if err != nil {
+		return Stat{}, err
+	}
+	return Stat{FileInfo: st, Mimetype: "text/plain"}, nil
+}
+
+func (b *diskBackend) Lstat(p string) (os.FileInfo, error) {
+	b.call()
+	return os.Lstat(p)
+}
+
+func (b *diskBackend) ReadDir(p string) ([]Stat, error) {
+	b.call()
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Stat, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Stat{FileInfo: info, Mimetype: "text/plain"})
+	}
+	return out, nil
+}
+
+func (b *diskBackend) EvalSymlinks(p string) (string, error) {
+	b.call()
+	return filepath.EvalSymlinks(p)
+}
+
+func (b *diskBackend) Open(p string) (io.ReadCloser, error) {
+	b.call()
+	return os.Open(p)
+}
+
+func (b *diskBackend) WriteFile(p string, r io.Reader) (int64, error) {
+	b.call()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(f, r)
+}
+
+func (b *diskBackend) MkdirAll(p string, perm os.FileMode) error {
+	b.call()
+	return os.MkdirAll(p, perm)
+}
+
+func (b *diskBackend) Rename(from string, to string) error {
+	b.call()
+	return os.Rename(from, to)
+}
+
+func (b *diskBackend) RemoveAll(p string) error {
+	b.call()
+	return os.RemoveAll(p)
+}
+
+func (b *diskBackend) Chmod(p string, mode os.FileMode) error {
+	b.call()
+	return os.Chmod(p, mode)
+}
+
+func (b *diskBackend) Chtimes(p string, atime time.Time, mtime time.Time) error {
+	b.call()
+	return os.Chtimes(p, atime, mtime)
+}
+
+func (b *diskBackend) Chown(p string, uid int, gid int) error {
+	b.call()
+	return nil
+}
+
+func (b *diskBackend) DirectorySize(p string) (int64, error) {
+	b.call()
+	var size int64
+	err := filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func (b *diskBackend) Archive(ctx context.Context, dir string, files []string, dst string) error {
+	return errors.New("not implemented")
+}
+
+func (b *diskBackend) Tar(ctx context.Context, dir string, exclude []string, w io.Writer) error {
+	return errors.New("not implemented")
+}
+
+func (b *diskBackend) Untar(ctx context.Context, dir string, r io.Reader) error {
+	return errors.New("not implemented")
+}
+
+func TestFilesystem_Backend(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+	b := &diskBackend{}
+	fs.SetBackend(b)
+
+	g.Describe("Backend", func() {
+		g.BeforeEach(func() {
+			atomic.StoreInt64(&b.calls, 0)
+		})
+
+		g.It("is reported as remote", func() {
+			g.Assert(fs.IsRemote()).IsTrue()
+			g.Assert(fs.Backend() == Backend(b)).IsTrue()
+		})
+
+		g.It("updates the disk usage through the backend", func() {
+			_ = rfs.CreateServerFileFromString("test.txt", "hello world")
+
+			done := make(chan int64, 1)
+			go func() {
+				size, err := fs.DiskUsage(false)
+				if err != nil {
+					panic(err)
+				}
+				done <- size
+			}()
+
+			select {
+			case size := <-done:
+				g.Assert(size).Equal(int64(11))
+			case <-time.After(time.Second * 5):
+				g.Fail("disk usage was not updated")
+			}
+			g.Assert(atomic.LoadInt64(&b.calls) > 0).IsTrue()
+		})
+
+		g.It("writes and reads files through the backend", func() {
+			err := fs.Writefile("dir/test.txt", bytes.NewReader([]byte("hello world")))
+			g.Assert(err).IsNil()
+
+			st, err := rfs.StatServerFile("dir/test.txt")
+			g.Assert(err).IsNil()
+			g.Assert(st.Size()).Equal(int64(11))
+
+			f, st2, err := fs.File("dir/test.txt")
+			g.Assert(err).IsNil()
+			defer f.Close()
+			g.Assert(st2.Size()).Equal(int64(11))
+			g.Assert(getFileContent(f)).Equal("hello world")
+			g.Assert(atomic.LoadInt64(&b.calls) > 0).IsTrue()
+		})
+
+		g.It("copies files through the backend", func() {
+			_ = rfs.CreateServerFileFromString("source.txt", "hello world")
+
+			err := fs.Copy("source.txt")
+			g.Assert(err).IsNil()
+
+			st, err := rfs.StatServerFile("source copy.txt")
+			g.Assert(err).IsNil()
+			g.Assert(st.Size()).Equal(int64(11))
+		})
+
+		g.AfterEach(func() {
+			rfs.reset()
+			atomic.StoreInt64(&fs.diskUsed, 0)
+			fs.lastLookupTime.Set(time.Time{})
+		})
+	})
+}
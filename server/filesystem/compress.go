@@ -47,24 +47,34 @@ func (fs *Filesystem) CompressFiles(dir string, paths []string) (os.FileInfo, er
 		return nil, err
 	}
 
-	a := &Archive{BasePath: cleanedRootDir, Files: cleaned}
 	d := path.Join(
 		cleanedRootDir,
 		fmt.Sprintf("archive-%s.tar.gz", strings.ReplaceAll(time.Now().Format(time.RFC3339), ":", "")),
 	)
 
-	if err := a.Create(context.Background(), d); err != nil {
-		return nil, err
+	if b := fs.remote(); b != nil {
+		files := make([]string, len(cleaned))
+		for i, p := range cleaned {
+			files[i] = strings.TrimPrefix(strings.TrimPrefix(p, cleanedRootDir), "/")
+		}
+		if err := b.Archive(context.Background(), cleanedRootDir, files, d); err != nil {
+			return nil, err
+		}
+	} else {
+		a := &Archive{BasePath: cleanedRootDir, Files: cleaned}
+		if err := a.Create(context.Background(), d); err != nil {
+			return nil, err
+		}
 	}
 
-	f, err := os.Stat(d)
+	f, err := fs.stat(d)
 	if err != nil {
-		_ = os.Remove(d)
+		_ = fs.removeAll(d)
 		return nil, err
 	}
 
 	if err := fs.HasSpaceFor(f.Size()); err != nil {
-		_ = os.Remove(d)
+		_ = fs.removeAll(d)
 		return nil, err
 	}
 
@@ -91,6 +101,35 @@ func (fs *Filesystem) SpaceAvailableForDecompression(ctx context.Context, dir st
 	// waiting an unnecessary amount of time on this call.
 	dirSize, err := fs.DiskUsage(false)
 
+	// Archives on a remote backend are copied to the local disk first since reading
+	// the contents of some formats requires random access to the file.
+	if fs.IsRemote() {
+		f, err := fs.openTemporary(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		format, input, err := archiver.Identify(filepath.Base(source), f)
+		if err != nil {
+			if errors.Is(err, archiver.ErrNoMatch) {
+				return newFilesystemError(ErrCodeUnknownArchive, err)
+			}
+			return err
+		}
+		ex, ok := format.(archiver.Extractor)
+		if !ok {
+			return nil
+		}
+		var size int64
+		return ex.Extract(ctx, input, nil, func(ctx context.Context, f archiver.File) error {
+			if atomic.AddInt64(&size, f.Size())+dirSize > fs.MaxDisk() {
+				return newFilesystemError(ErrCodeDiskSpace, nil)
+			}
+			return nil
+		})
+	}
+
 	fsys, err := archiver.FileSystem(source)
 	if err != nil {
 		if errors.Is(err, archiver.ErrNoMatch) {
@@ -140,15 +179,21 @@ func (fs *Filesystem) DecompressFile(ctx context.Context, dir string, file strin
 // into the server's directory.
 func (fs *Filesystem) DecompressFileUnsafe(ctx context.Context, dir string, file string) error {
 	// Ensure that the archive actually exists on the system.
-	if _, err := os.Stat(file); err != nil {
+	if _, err := fs.stat(file); err != nil {
 		return errors.WithStack(err)
 	}
 
-	f, err := os.Open(file)
+	var f *os.File
+	var err error
+	if fs.IsRemote() {
+		f, err = fs.openTemporary(file)
+	} else {
+		f, err = os.Open(file)
+	}
 	if err != nil {
 		return err
 	}
-	// TODO: defer file close?
+	defer f.Close()
 
 	// Identify the type of archive we are dealing with.
 	format, input, err := archiver.Identify(filepath.Base(file), f)
@@ -163,6 +163,11 @@ func (fs *Filesystem) DirectorySize(dir string) (int64, error) {
 		return 0, err
 	}
 
+	if b := fs.remote(); b != nil {
+		size, err := b.DirectorySize(d)
+		return size, errors.WrapIf(err, "server/filesystem: directorysize: failed to determine directory size")
+	}
+
 	var size int64
 	var st syscall.Stat_t
 
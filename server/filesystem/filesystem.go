@@ -37,6 +37,11 @@ type Filesystem struct {
 	// The root data directory path for this Filesystem instance.
 	root string
 
+	// The backend used to access the files, if they are not stored on the local disk. It
+	// has its own lock since it is read while the disk usage is updated under mu.
+	backendMu sync.RWMutex
+	backend   Backend
+
 	isTest bool
 }
 
@@ -73,7 +78,12 @@ func (fs *Filesystem) File(p string) (*os.File, Stat, error) {
 	if st.IsDir() {
 		return nil, Stat{}, newFilesystemError(ErrCodeIsDirectory, nil)
 	}
-	f, err := os.Open(cleaned)
+	var f *os.File
+	if fs.IsRemote() {
+		f, err = fs.openTemporary(cleaned)
+	} else {
+		f, err = os.Open(cleaned)
+	}
 	if err != nil {
 		return nil, Stat{}, errors.WithStackIf(err)
 	}
@@ -88,6 +98,11 @@ func (fs *Filesystem) Touch(p string, flag int) (*os.File, error) {
 	if err != nil {
 		return nil, err
 	}
+	// A handle to a file on a remote backend cannot be returned, anything writing files
+	// should be using Writefile instead.
+	if fs.IsRemote() {
+		return nil, errors.New("server/filesystem: touch: cannot open file handle on remote backend")
+	}
 	f, err := os.OpenFile(cleaned, flag, 0o644)
 	if err == nil {
 		return f, nil
@@ -130,7 +145,7 @@ func (fs *Filesystem) Writefile(p string, r io.Reader) error {
 	var currentSize int64
 	// If the file does not exist on the system already go ahead and create the pathway
 	// to it and an empty file. We'll then write to it later on after this completes.
-	stat, err := os.Stat(cleaned)
+	stat, err := fs.stat(cleaned)
 	if err != nil && !os.IsNotExist(err) {
 		return errors.Wrap(err, "server/filesystem: writefile: failed to stat file")
 	} else if err == nil {
@@ -148,6 +163,15 @@ func (fs *Filesystem) Writefile(p string, r io.Reader) error {
 		return err
 	}
 
+	if b := fs.remote(); b != nil {
+		sz, err := b.WriteFile(cleaned, br)
+		if err != nil {
+			return errors.Wrap(err, "server/filesystem: writefile: failed to write file")
+		}
+		fs.addDisk(sz - currentSize)
+		return fs.Chown(cleaned)
+	}
+
 	// Touch the file and return the handle to it at this point. This will create the file,
 	// any necessary directories, and set the proper owner of the file.
 	file, err := fs.Touch(cleaned, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
@@ -171,7 +195,7 @@ func (fs *Filesystem) CreateDirectory(name string, p string) error {
 	if err != nil {
 		return err
 	}
-	return os.MkdirAll(cleaned, 0o755)
+	return fs.mkdirAll(cleaned, 0o755)
 }
 
 // Rename moves (or renames) a file or directory.
@@ -188,7 +212,7 @@ func (fs *Filesystem) Rename(from string, to string) error {
 
 	// If the target file or directory already exists the rename function will fail, so just
 	// bail out now.
-	if _, err := os.Stat(cleanedTo); err == nil {
+	if _, err := fs.stat(cleanedTo); err == nil {
 		return os.ErrExist
 	}
 
@@ -200,12 +224,12 @@ func (fs *Filesystem) Rename(from string, to string) error {
 	// Ensure that the directory we're moving into exists correctly on the system. Only do this if
 	// we're not at the root directory level.
 	if d != fs.Path() {
-		if mkerr := os.MkdirAll(d, 0o755); mkerr != nil {
+		if mkerr := fs.mkdirAll(d, 0o755); mkerr != nil {
 			return errors.WithMessage(mkerr, "failed to create directory structure for file rename")
 		}
 	}
 
-	if err := os.Rename(cleanedFrom, cleanedTo); err != nil {
+	if err := fs.rename(cleanedFrom, cleanedTo); err != nil {
 		return errors.WithStack(err)
 	}
 	return nil
@@ -228,6 +252,10 @@ func (fs *Filesystem) Chown(path string) error {
 	uid := config.Get().System.User.Uid
 	gid := config.Get().System.User.Gid
 
+	if b := fs.remote(); b != nil {
+		return errors.Wrap(b.Chown(cleaned, uid, gid), "server/filesystem: chown: failed to chown path")
+	}
+
 	// Start by just chowning the initial path that we received.
 	if err := os.Chown(cleaned, uid, gid); err != nil {
 		return errors.Wrap(err, "server/filesystem: chown: failed to chown path")
@@ -272,6 +300,10 @@ func (fs *Filesystem) Chmod(path string, mode os.FileMode) error {
 		return nil
 	}
 
+	if b := fs.remote(); b != nil {
+		return b.Chmod(cleaned, mode)
+	}
+
 	if err := os.Chmod(cleaned, mode); err != nil {
 		return err
 	}
@@ -323,7 +355,7 @@ func (fs *Filesystem) Copy(p string) error {
 		return err
 	}
 
-	s, err := os.Stat(cleaned)
+	s, err := fs.stat(cleaned)
 	if err != nil {
 		return err
 	} else if s.IsDir() || !s.Mode().IsRegular() {
@@ -350,7 +382,7 @@ func (fs *Filesystem) Copy(p string) error {
 		name = strings.TrimSuffix(name, ".tar")
 	}
 
-	source, err := os.Open(cleaned)
+	source, err := fs.open(cleaned)
 	if err != nil {
 		return err
 	}
@@ -367,10 +399,10 @@ func (fs *Filesystem) Copy(p string) error {
 // TruncateRootDirectory removes _all_ files and directories from a server's
 // data directory and resets the used disk space to zero.
 func (fs *Filesystem) TruncateRootDirectory() error {
-	if err := os.RemoveAll(fs.Path()); err != nil {
+	if err := fs.removeAll(fs.Path()); err != nil {
 		return err
 	}
-	if err := os.Mkdir(fs.Path(), 0o755); err != nil {
+	if err := fs.mkdirAll(fs.Path(), 0o755); err != nil {
 		return err
 	}
 	atomic.StoreInt64(&fs.diskUsed, 0)
@@ -400,7 +432,7 @@ func (fs *Filesystem) Delete(p string) error {
 		return errors.New("cannot delete root server directory")
 	}
 
-	if st, err := os.Lstat(resolved); err != nil {
+	if st, err := fs.lstat(resolved); err != nil {
 		if !os.IsNotExist(err) {
 			fs.error(err).Warn("error while attempting to stat file before deletion")
 		}
@@ -420,7 +452,7 @@ func (fs *Filesystem) Delete(p string) error {
 
 	wg.Wait()
 
-	return os.RemoveAll(resolved)
+	return fs.removeAll(resolved)
 }
 
 type fileOpener struct {
@@ -457,6 +489,27 @@ func (fs *Filesystem) ListDirectory(p string) ([]Stat, error) {
 		return nil, err
 	}
 
+	if fs.IsRemote() {
+		out, err := fs.remote().ReadDir(cleaned)
+		if err != nil {
+			return nil, err
+		}
+		for i, st := range out {
+			// Never expose the type of file a symlink resolves to outside the server data
+			// directory, in line with the local behavior below.
+			if st.Mode()&os.ModeSymlink != 0 && !st.IsDir() {
+				if _, err := fs.SafePath(filepath.Join(cleaned, st.Name())); err != nil {
+					out[i].Mimetype = "application/octet-stream"
+				}
+			}
+		}
+		if out == nil {
+			out = []Stat{}
+		}
+		sortStats(out)
+		return out, nil
+	}
+
 	files, err := ioutil.ReadDir(cleaned)
 	if err != nil {
 		return nil, err
@@ -508,6 +561,14 @@ func (fs *Filesystem) ListDirectory(p string) ([]Stat, error) {
 
 	wg.Wait()
 
+	sortStats(out)
+
+	return out, nil
+}
+
+// sortStats sorts the output of a directory listing so that directories are
+// listed first, followed by files.
+func sortStats(out []Stat) {
 	// Sort the output alphabetically to begin with since we've run the output
 	// through an asynchronous process and the order is gonna be very random.
 	sort.SliceStable(out, func(i, j int) bool {
@@ -522,8 +583,6 @@ func (fs *Filesystem) ListDirectory(p string) ([]Stat, error) {
 	sort.SliceStable(out, func(i, j int) bool {
 		return out[i].IsDir()
 	})
-
-	return out, nil
 }
 
 func (fs *Filesystem) Chtimes(path string, atime, mtime time.Time) error {
@@ -536,6 +595,10 @@ func (fs *Filesystem) Chtimes(path string, atime, mtime time.Time) error {
 		return nil
 	}
 
+	if b := fs.remote(); b != nil {
+		return b.Chtimes(cleaned, atime, mtime)
+	}
+
 	if err := os.Chtimes(cleaned, atime, mtime); err != nil {
 		return err
 	}
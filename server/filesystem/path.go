@@ -40,7 +40,7 @@ func (fs *Filesystem) SafePath(p string) (string, error) {
 
 	// At the same time, evaluate the symlink status and determine where this file or folder
 	// is truly pointing to.
-	ep, err := filepath.EvalSymlinks(r)
+	ep, err := fs.evalSymlinks(r)
 	if err != nil && !os.IsNotExist(err) {
 		return "", errors.Wrap(err, "server/filesystem: failed to evaluate symlink")
 	} else if os.IsNotExist(err) {
@@ -58,7 +58,7 @@ func (fs *Filesystem) SafePath(p string) (string, error) {
 				break
 			}
 
-			t, err := filepath.EvalSymlinks(try)
+			t, err := fs.evalSymlinks(try)
 			if err == nil {
 				nonExistentPathResolution = t
 				break
@@ -52,6 +52,10 @@ func (fs *Filesystem) Stat(p string) (Stat, error) {
 }
 
 func (fs *Filesystem) unsafeStat(p string) (Stat, error) {
+	if b := fs.remote(); b != nil {
+		return b.Stat(p)
+	}
+
 	s, err := os.Stat(p)
 	if err != nil {
 		return Stat{}, err
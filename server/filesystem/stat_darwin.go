@@ -7,7 +7,11 @@ import (
 
 // CTime returns the time that the file/folder was created.
 func (s *Stat) CTime() time.Time {
-	st := s.Sys().(*syscall.Stat_t)
+	st, ok := s.Sys().(*syscall.Stat_t)
+	// Files on a remote backend do not carry any system specific information.
+	if !ok {
+		return s.ModTime()
+	}
 
 	return time.Unix(st.Ctimespec.Sec, st.Ctimespec.Nsec)
 }
@@ -7,7 +7,11 @@ import (
 
 // Returns the time that the file/folder was created.
 func (s *Stat) CTime() time.Time {
-	st := s.Sys().(*syscall.Stat_t)
+	st, ok := s.Sys().(*syscall.Stat_t)
+	// Files on a remote backend do not carry any system specific information.
+	if !ok {
+		return s.ModTime()
+	}
 
 	// Do not remove these "redundant" type-casts, they are required for 32-bit builds to work.
 	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/kubectyl/kuber/config"
+	"github.com/kubectyl/kuber/environment"
+	docker "github.com/kubectyl/kuber/environment/kubernetes"
+	"github.com/kubectyl/kuber/remote"
+)
+
+// hibernation tracks the activity of a running server to detect when it has
+// been idle for long enough to hibernate.
+type hibernation struct {
+	mu sync.Mutex
+
+	// The start of the current one minute window, and the amount of bytes the
+	// server had received at that point.
+	since time.Time
+	rx    uint64
+
+	lastActive  time.Time
+	querying    bool
+	hibernating bool
+}
+
+// reset restarts tracking the activity of the server, called whenever the
+// server process is started.
+func (h *hibernation) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.since = time.Time{}
+	h.lastActive = time.Now()
+	h.hibernating = false
+}
+
+// markActive records that the server is currently in use.
+func (h *hibernation) markActive() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastActive = time.Now()
+}
+
+// CanHibernate reports if the server is allowed to hibernate once it is idle.
+func (s *Server) CanHibernate() bool {
+	if _, ok := s.Environment.(*docker.Environment); !ok {
+		return false
+	}
+	return config.Get().Cluster.Hibernation.EnabledFor(s.Config().Labels)
+}
+
+// trackActivity updates the activity of the server using the latest resource
+// usage, and hibernates the server once it has been idle for long enough. The
+// activity is checked once a minute, either by running the query defined by the
+// egg or by comparing the amount of network traffic against the threshold.
+func (s *Server) trackActivity(st environment.Stats) {
+	if s.Environment.State() != environment.ProcessRunningState || !s.CanHibernate() {
+		return
+	}
+	cfg := config.Get().Cluster.Hibernation
+	// Without a query the traffic is all there is to go by, which is not known until
+	// the first stats of the server arrive.
+	query := s.hibernationSettings().Query
+	if query == "" && st.Network.RxBytes == 0 {
+		return
+	}
+
+	h := &s.hibernation
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if h.since.IsZero() || st.Network.RxBytes < h.rx {
+		h.since, h.rx, h.lastActive = now, st.Network.RxBytes, now
+		return
+	}
+	if now.Sub(h.since) < time.Minute {
+		return
+	}
+
+	if query != "" {
+		if !h.querying {
+			h.querying = true
+			go s.queryPlayers(query)
+		}
+	} else if st.Network.RxBytes-h.rx > cfg.Threshold {
+		h.lastActive = now
+	}
+	h.since, h.rx = now, st.Network.RxBytes
+
+	if !h.hibernating && now.Sub(h.lastActive) >= time.Duration(cfg.IdleTimeout)*time.Minute {
+		h.hibernating = true
+		go func() {
+			if err := s.Hibernate(); err != nil {
+				s.Log().WithField("error", err).Error("failed to hibernate idle server")
+			}
+		}()
+	}
+}
+
+// queryPlayers runs the query defined by the egg to get the number of players
+// connected to the server. Failing queries count as activity, so a broken query
+// never causes a server to hibernate while it is in use.
+func (s *Server) queryPlayers(query string) {
+	defer func() {
+		s.hibernation.mu.Lock()
+		s.hibernation.querying = false
+		s.hibernation.mu.Unlock()
+	}()
+
+	e := s.Environment.(*docker.Environment)
+	ctx, cancel := context.WithTimeout(s.Context(), time.Second*30)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	if err := e.Exec(ctx, []string{"sh", "-c", query}, nil, &stdout, nil); err != nil {
+		s.Log().WithField("error", err).Warn("failed to query players of server")
+		s.hibernation.markActive()
+		return
+	}
+	players, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+	if err != nil || players > 0 {
+		s.hibernation.markActive()
+	}
+}
+
+// Hibernate stops the server and replaces it with a pod answering on the ports
+// of the server, starting the server again once the first client connects.
+func (s *Server) Hibernate() error {
+	e, ok := s.Environment.(*docker.Environment)
+	if !ok {
+		return errors.New("server: environment does not support hibernation")
+	}
+
+	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server has been idle for %d minutes, hibernating until the next connection...", config.Get().Cluster.Hibernation.IdleTimeout))
+	if err := s.HandlePowerAction(PowerActionStop); err != nil {
+		return err
+	}
+	if err := e.Hibernate(s.Context(), s.hibernationSettings().Protocol); err != nil {
+		return err
+	}
+
+	go s.waitForWake(e)
+	return nil
+}
+
+// ResumeHibernation waits for clients of the server to connect again if it was
+// hibernating when Kuber was stopped.
+func (s *Server) ResumeHibernation(ctx context.Context) {
+	e, ok := s.Environment.(*docker.Environment)
+	if !ok {
+		return
+	}
+	if hibernating, err := e.Hibernating(ctx); err != nil || !hibernating {
+		return
+	}
+	s.Log().Info("server is hibernating, waiting for clients to connect...")
+	go s.waitForWake(e)
+}
+
+// waitForWake starts the server once a client connects to it while it is
+// hibernating. If the server fails to start it no longer hibernates, otherwise
+// nothing would be left waiting for clients to start it again.
+func (s *Server) waitForWake(e *docker.Environment) {
+	if err := e.WaitForWake(s.Context()); err != nil {
+		if !errors.Is(err, docker.ErrNotHibernating) && !errors.Is(err, context.Canceled) {
+			s.Log().WithField("error", err).Error("failed to wait for clients of hibernating server")
+		}
+		return
+	}
+
+	s.PublishConsoleOutputFromDaemon("Client connected, waking server from hibernation...")
+	err := s.HandlePowerAction(PowerActionStart)
+	if errors.Is(err, ErrIsRunning) {
+		return
+	}
+	if err != nil {
+		s.Log().WithField("error", err).Error("failed to start server after waking from hibernation")
+	}
+	if err != nil || s.Environment.State() == environment.ProcessOfflineState {
+		s.PublishConsoleOutputFromDaemon("Server failed to start, it is no longer hibernating.")
+		e.EndHibernation(s.Context())
+	}
+}
+
+// hibernationSettings returns the hibernation settings defined by the egg of
+// the server.
+func (s *Server) hibernationSettings() remote.Hibernation {
+	if pc := s.ProcessConfiguration(); pc != nil && pc.Hibernation != nil {
+		return *pc.Hibernation
+	}
+	return remote.Hibernation{}
+}
@@ -17,12 +17,12 @@ import (
 
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
+	docker "github.com/kubectyl/kuber/environment/kubernetes"
 	"github.com/kubectyl/kuber/remote"
 	"github.com/kubectyl/kuber/system"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
@@ -34,10 +34,41 @@ import (
 // Pass true as the first argument in order to execute a server sync before the
 // process to ensure the latest information is used.
 func (s *Server) Install() error {
-	return s.install(false)
+	return s.install(false, false)
 }
 
-func (s *Server) install(reinstall bool) error {
+// CloneFrom creates the volume of the server as a copy of the volume of the
+// source server, and then installs the server on top of the copied files. The
+// installation script of the egg only runs if the server does not skip it.
+func (s *Server) CloneFrom(source *Server) error {
+	src, ok := source.Environment.(*docker.Environment)
+	if !ok {
+		return errors.New("install: environment of source server does not support cloning volumes")
+	}
+	dst, ok := s.Environment.(*docker.Environment)
+	if !ok {
+		return errors.New("install: environment does not support cloning volumes")
+	}
+
+	s.Log().WithField("source", source.ID()).Info("cloning volume of server")
+	err := dst.CloneVolume(s.Context(), src, s.StorageTier())
+	// The source is able to be started again once its files have been copied.
+	source.SetCloning(false)
+	if err != nil {
+		// Let the Panel know that the server could not be installed.
+		if serr := s.SyncInstallState(false, false); serr != nil {
+			s.Log().WithField("error", serr).Warn("failed to notify panel of server install state")
+		}
+		return errors.WrapIf(err, "install: failed to clone volume of server")
+	}
+
+	return s.install(false, true)
+}
+
+// install runs the installation script of the egg unless the server skips it. A
+// server whose volume was already created keeps it, otherwise the volume is
+// created from scratch.
+func (s *Server) install(reinstall bool, keepVolume bool) error {
 	var err error
 	if !s.Config().SkipEggScripts {
 		// Send the start event so the Panel can automatically update. We don't
@@ -46,7 +77,7 @@ func (s *Server) install(reinstall bool) error {
 		// install process being executed.
 		s.Events().Publish(InstallStartedEvent, "")
 
-		err = s.internalInstall()
+		err = s.internalInstall(keepVolume)
 	} else {
 		s.Log().Info("server configured to skip running installation scripts for this egg, not executing process")
 	}
@@ -93,11 +124,11 @@ func (s *Server) Reinstall() error {
 		return errors.WrapIf(err, "install: failed to sync server state with Panel")
 	}
 
-	return s.install(true)
+	return s.install(true, false)
 }
 
 // Internal installation function used to simplify reporting back to the Panel.
-func (s *Server) internalInstall() error {
+func (s *Server) internalInstall(keepVolume bool) error {
 	script, err := s.client.GetInstallationScript(s.Context(), s.ID())
 	if err != nil {
 		return err
@@ -106,6 +137,7 @@ func (s *Server) internalInstall() error {
 	if err != nil {
 		return err
 	}
+	p.keepVolume = keepVolume
 
 	s.Log().Info("beginning installation process for server")
 	if err := p.Run(); err != nil {
@@ -120,6 +152,10 @@ type InstallationProcess struct {
 	Server *Server
 	Script *remote.InstallationScript
 	client *kubernetes.Clientset
+
+	// keepVolume runs the installation on the existing volume of the server rather
+	// than on a new one.
+	keepVolume bool
 }
 
 // NewInstallationProcess returns a new installation process struct that will be
@@ -162,6 +198,20 @@ func (s *Server) SetRestoring(state bool) {
 	s.restoring.Store(state)
 }
 
+func (s *Server) IsCloning() bool {
+	return s.cloning.Load()
+}
+
+func (s *Server) SetCloning(state bool) {
+	s.cloning.Store(state)
+}
+
+// StartCloning marks the server as being cloned and returns false if it already
+// was, in which case nothing is changed.
+func (s *Server) StartCloning() bool {
+	return s.cloning.SwapIf(true)
+}
+
 // RemoveContainer removes the installation container for the server.
 func (ip *InstallationProcess) RemoveContainer() error {
 	err := ip.client.CoreV1().Pods(config.Get().Cluster.Namespace).Delete(ip.Server.Context(), ip.Server.ID()+"-installer", metav1.DeleteOptions{})
@@ -256,11 +306,13 @@ func (ip *InstallationProcess) BeforeExecute() error {
 	if err := ip.writeScriptToDisk(); err != nil {
 		return errors.WithMessage(err, "failed to write installation script to disk")
 	}
-	var zero int64 = 0
-	policy := metav1.DeletePropagationForeground
-	if err := ip.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Delete(context.Background(), ip.Server.ID()+"-pvc", metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy}); err != nil {
-		if !apierrors.IsNotFound(err) {
-			return errors.WithMessage(err, "failed to remove pvc before running installation")
+	if !ip.keepVolume {
+		var zero int64 = 0
+		policy := metav1.DeletePropagationForeground
+		if err := ip.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Delete(context.Background(), ip.Server.ID()+"-pvc", metav1.DeleteOptions{GracePeriodSeconds: &zero, PropagationPolicy: &policy}); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return errors.WithMessage(err, "failed to remove pvc before running installation")
+			}
 		}
 	}
 	if err := ip.RemoveContainer(); err != nil {
@@ -339,6 +391,16 @@ func (ip *InstallationProcess) AfterExecute(containerId string) error {
 	return nil
 }
 
+// createVolume creates the persistent volume claim of the server using its
+// storage tier.
+func (ip *InstallationProcess) createVolume(ctx context.Context) error {
+	e, ok := ip.Server.Environment.(*docker.Environment)
+	if !ok {
+		return errors.New("install: server environment does not support volumes")
+	}
+	return e.CreateVolume(ctx, ip.Server.StorageTier())
+}
+
 // Execute executes the installation process inside a specially created docker
 // container.
 func (ip *InstallationProcess) Execute() (string, error) {
@@ -353,13 +415,24 @@ func (ip *InstallationProcess) Execute() (string, error) {
 		return "", err
 	}
 
+	// In operator mode every object created for the installation is owned by the
+	// GameServer resource of the server, except for the claim holding its data.
+	var refs []metav1.OwnerReference
+	if e, ok := ip.Server.Environment.(*docker.Environment); ok {
+		if refs, err = e.OwnerReferences(ctx); err != nil {
+			return "", err
+		}
+	}
+
 	configmap := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: ip.Server.ID() + "-configmap",
+			Name:            ip.Server.ID() + "-configmap",
+			Labels:          environment.ObjectLabels(ip.Server.ID()),
+			OwnerReferences: refs,
 		},
 		Data: map[string]string{
 			"install.sh": string(fileContents),
@@ -371,31 +444,14 @@ func (ip *InstallationProcess) Execute() (string, error) {
 		ip.Server.Log().WithField("error", err).Warn("failed to create configmap")
 	}
 
-	pvc := &corev1.PersistentVolumeClaim{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "PersistentVolumeClaim",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: ip.Server.ID() + "-pvc",
-		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.PersistentVolumeAccessMode("ReadWriteOnce"),
-			},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					"storage": *resource.NewQuantity(ip.Server.DiskSpace(), resource.BinarySI),
-				},
-			},
-			StorageClassName: &[]string{config.Get().Cluster.StorageClass}[0],
-		},
+	if !ip.keepVolume {
+		if err := ip.createVolume(ctx); err != nil {
+			return "", err
+		}
 	}
 
-	_, err = ip.client.CoreV1().PersistentVolumeClaims(config.Get().Cluster.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
-	if err != nil {
-		return "", err
-	}
+	labels := environment.ObjectLabels(ip.Server.ID())
+	labels["ContainerType"] = "server_installer"
 
 	pod := &corev1.Pod{
 		TypeMeta: metav1.TypeMeta{
@@ -403,7 +459,9 @@ func (ip *InstallationProcess) Execute() (string, error) {
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: ip.Server.ID() + "-installer",
+			Name:            ip.Server.ID() + "-installer",
+			Labels:          labels,
+			OwnerReferences: refs,
 		},
 		Spec: corev1.PodSpec{
 			Volumes: []corev1.Volume{
@@ -447,7 +505,8 @@ func (ip *InstallationProcess) Execute() (string, error) {
 					},
 				},
 			},
-			RestartPolicy: corev1.RestartPolicy("Never"),
+			RestartPolicy:     corev1.RestartPolicy("Never"),
+			PriorityClassName: config.Get().Cluster.Priorities.Installer.Name,
 		},
 	}
 
@@ -110,6 +110,7 @@ func (s *Server) StartEventListeners() {
 								return
 							}
 							s.resources.UpdateStats(stats.Data)
+							s.trackActivity(stats.Data)
 							// If there is no disk space available at this point, trigger the server
 							// disk limiter logic which will start to stop the running instance.
 							if !s.Filesystem().HasSpaceAvailable(true) {
@@ -123,6 +124,7 @@ func (s *Server) StartEventListeners() {
 							if e.Data == environment.ProcessStartingState {
 								limit.Reset()
 								s.Throttler().Reset()
+								s.hibernation.reset()
 							}
 							s.OnStateChange()
 						}
@@ -132,6 +134,10 @@ func (s *Server) StartEventListeners() {
 						s.PublishConsoleOutputFromDaemon("Pulling Docker container image, this could take a few minutes to complete...")
 					case environment.DockerImagePullCompleted:
 						s.PublishConsoleOutputFromDaemon("Finished pulling Docker container image")
+					case environment.DaemonMessageEvent:
+						if msg, ok := e.Data.(string); ok {
+							s.PublishConsoleOutputFromDaemon(msg)
+						}
 					default:
 					}
 				}(v, limit)
@@ -17,6 +17,7 @@ import (
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
 	docker "github.com/kubectyl/kuber/environment/kubernetes"
+	"github.com/kubectyl/kuber/internal/ha"
 	"github.com/kubectyl/kuber/remote"
 	"github.com/kubectyl/kuber/server/filesystem"
 )
@@ -145,6 +146,11 @@ func (m *Manager) Remove(filter func(match *Server) bool) {
 // at once. It is fine if this file falls slightly out of sync, it is just here
 // to make recovering from an unexpected system reboot a little easier.
 func (m *Manager) PersistStates() error {
+	// In high availability mode states are written individually whenever they change,
+	// writing every state known to this replica would overwrite those of the others.
+	if ha.Enabled() {
+		return nil
+	}
 	states := map[string]string{}
 	for _, s := range m.All() {
 		states[s.ID()] = s.Environment.State()
@@ -161,6 +167,13 @@ func (m *Manager) PersistStates() error {
 
 // ReadStates returns the state of the servers.
 func (m *Manager) ReadStates() (map[string]string, error) {
+	if ha.Enabled() {
+		states, err := ha.ReadStates(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return m.filterStates(states), nil
+	}
 	f, err := os.OpenFile(config.Get().System.GetStatesPath(), os.O_RDONLY|os.O_CREATE, 0o644)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -170,14 +183,44 @@ func (m *Manager) ReadStates() (map[string]string, error) {
 	if err := json.NewDecoder(f).Decode(&states); err != nil && err != io.EOF {
 		return nil, errors.WithStack(err)
 	}
+	return m.filterStates(states), nil
+}
+
+// filterStates returns only the states for servers that are currently tracked
+// in the system.
+func (m *Manager) filterStates(states map[string]string) map[string]string {
 	out := make(map[string]string, 0)
-	// Only return states for servers that we're currently tracking in the system.
 	for id, state := range states {
 		if _, ok := m.Get(id); ok {
 			out[id] = state
 		}
 	}
-	return out, nil
+	return out
+}
+
+// SyncStates attaches to any server process that was started by another replica
+// of this node. This is only used in high availability mode, and allows every
+// replica to serve console output and stats for all the servers.
+func (m *Manager) SyncStates(ctx context.Context) error {
+	states, err := m.ReadStates()
+	if err != nil {
+		return err
+	}
+	for _, s := range m.All() {
+		st := states[s.ID()]
+		if st != environment.ProcessRunningState || s.IsRunning() || s.ExecutingPowerAction() {
+			continue
+		}
+		if r, err := s.Environment.IsRunning(ctx); err != nil || !r {
+			continue
+		}
+		s.Log().Info("detected server was started by another replica, attaching to process...")
+		s.Environment.SetState(environment.ProcessRunningState)
+		if err := s.Environment.Attach(ctx); err != nil {
+			s.Log().WithField("error", err).Warn("failed to attach to running server environment")
+		}
+	}
+	return nil
 }
 
 // InitServer initializes a server using a data byte array. This will be
@@ -209,7 +252,14 @@ func (m *Manager) InitServer(data remote.ServerConfigurationResponse) (*Server,
 
 	envCfg := environment.NewConfiguration(settings, s.GetEnvironmentVariables())
 	meta := docker.Metadata{
-		Image: s.Config().Container.Image,
+		Image:       s.Config().Container.Image,
+		HealthCheck: s.HealthCheck(),
+		Sidecars:    s.Sidecars(),
+		Tmp:         s.TmpVolume(),
+		Dns:         s.Dns(),
+		HostNetwork: s.HostNetwork(),
+		IPFamilies:  s.IPFamilies(),
+		Private:     s.PrivateNetwork(),
 	}
 
 	if env, err := docker.New(s.ID(), &meta, envCfg); err != nil {
@@ -217,9 +267,19 @@ func (m *Manager) InitServer(data remote.ServerConfigurationResponse) (*Server,
 	} else {
 		s.Environment = env
 		s.StartEventListeners()
+
+		// Server files are stored on the persistent volume in the cluster, so unless configured
+		// otherwise all file operations are performed on the volume itself.
+		if config.Get().Cluster.Files.Backend != "local" {
+			s.fs.SetBackend(env.VolumeBackend(s.fs.Path()))
+		}
 	}
 
-	// If the server's data directory exists, force disk usage calculation.
+	// If the server's data directory exists, force disk usage calculation. This is skipped
+	// for files on a volume since the helper pod is only created once it is needed.
+	if s.Filesystem().IsRemote() {
+		return s, nil
+	}
 	if _, err := os.Stat(s.Filesystem().Path()); err == nil {
 		s.Filesystem().HasSpaceAvailable(true)
 	}
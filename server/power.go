@@ -11,6 +11,7 @@ import (
 
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
+	"github.com/kubectyl/kuber/internal/ha"
 )
 
 type PowerAction string
@@ -44,7 +45,12 @@ func (pa PowerAction) IsStart() bool {
 // ExecutingPowerAction checks if there is currently a power action being
 // processed for the server.
 func (s *Server) ExecutingPowerAction() bool {
-	return s.powerLock.IsLocked()
+	if s.powerLock.IsLocked() {
+		return true
+	}
+	// When running with multiple replicas another replica may be processing a power
+	// action for this server.
+	return ha.Enabled() && s.clusterLock().IsLocked(s.ctx)
 }
 
 // HandlePowerAction is a helper function that can receive a power action and then process the
@@ -55,9 +61,11 @@ func (s *Server) ExecutingPowerAction() bool {
 // function rather than making direct calls to the start/stop/restart functions on the
 // environment struct.
 func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error {
-	if s.IsInstalling() || s.IsTransferring() || s.IsRestoring() {
+	if s.IsInstalling() || s.IsTransferring() || s.IsRestoring() || s.IsCloning() {
 		if s.IsRestoring() {
 			return ErrServerIsRestoring
+		} else if s.IsCloning() {
+			return ErrServerIsCloning
 		} else if s.IsTransferring() {
 			return ErrServerIsTransferring
 		}
@@ -106,6 +114,12 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 
 		log.Info("acquired exclusive lock on power actions, processing event...")
 		defer cleanup()
+
+		release, err := s.acquireClusterLock(wait)
+		if err != nil {
+			return err
+		}
+		defer release()
 	} else {
 		// Still try to acquire the lock if terminating, and it is available, just so that
 		// other power actions are blocked until it has completed. However, if it cannot be
@@ -116,6 +130,10 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 		if err := s.powerLock.Acquire(); err == nil {
 			log.Info("acquired exclusive lock on power actions, processing event...")
 			defer cleanup()
+
+			if release, err := s.acquireClusterLock(0); err == nil {
+				defer release()
+			}
 		} else {
 			log.Warn("failed to acquire exclusive lock, ignoring failure for termination event")
 		}
@@ -201,10 +219,15 @@ func (s *Server) onBeforeStart() error {
 	// is complete. Any errors as a result of this will just be bubbled out in the logger,
 	// we don't need to actively do anything about it at this point, worse comes to worst the
 	// server starts in a weird state and the user can manually adjust.
-	s.PublishConsoleOutputFromDaemon("Updating process configuration files...")
-	s.Log().Debug("updating server configuration files...")
-	s.UpdateConfigurationFiles()
-	s.Log().Debug("updated server configuration files")
+	//
+	// Servers with their files on a volume have them updated by the init container of their
+	// pod instead, which reports any problems to the console once the pod has started.
+	if !s.ParsesConfigurationInPod() {
+		s.PublishConsoleOutputFromDaemon("Updating process configuration files...")
+		s.Log().Debug("updating server configuration files...")
+		s.UpdateConfigurationFiles()
+		s.Log().Debug("updated server configuration files")
+	}
 
 	if config.Get().System.CheckPermissionsOnBoot {
 		s.PublishConsoleOutputFromDaemon("Ensuring file permissions are set correctly, this could take a few seconds...")
@@ -218,3 +241,35 @@ func (s *Server) onBeforeStart() error {
 	s.Log().Info("completed server preflight, starting boot process...")
 	return nil
 }
+
+// acquireClusterLock acquires the power action lock shared between all replicas
+// of this node when running in high availability mode. The returned function must
+// be called to release the lock once the power action has been processed.
+func (s *Server) acquireClusterLock(wait int) (func(), error) {
+	if !ha.Enabled() {
+		return func() {}, nil
+	}
+
+	lock := s.clusterLock()
+	if wait > 0 {
+		ctx, cancel := context.WithTimeout(s.ctx, time.Second*time.Duration(wait))
+		defer cancel()
+
+		if err := lock.TryAcquire(ctx); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("could not acquire cluster lock on power action after %d seconds", wait))
+		}
+	} else if err := lock.Acquire(s.ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to acquire exclusive cluster lock for power actions")
+	}
+	return lock.Release, nil
+}
+
+// clusterLock returns the power action lock shared between all replicas of this
+// node. The same lock is used for the lifetime of the server so that its state is
+// cached between checks.
+func (s *Server) clusterLock() *ha.Lock {
+	s.clusterLockOnce.Do(func() {
+		s.powerClusterLock = ha.NewLock("power", s.ID())
+	})
+	return s.powerClusterLock
+}
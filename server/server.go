@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
@@ -15,7 +16,9 @@ import (
 
 	"github.com/kubectyl/kuber/config"
 	"github.com/kubectyl/kuber/environment"
+	docker "github.com/kubectyl/kuber/environment/kubernetes"
 	"github.com/kubectyl/kuber/events"
+	"github.com/kubectyl/kuber/internal/ha"
 	"github.com/kubectyl/kuber/remote"
 	"github.com/kubectyl/kuber/server/filesystem"
 	"github.com/kubectyl/kuber/system"
@@ -33,6 +36,11 @@ type Server struct {
 	emitterLock sync.Mutex
 	powerLock   *system.Locker
 
+	// The power action lock shared between the replicas of this node in high
+	// availability mode.
+	clusterLockOnce  sync.Once
+	powerClusterLock *ha.Lock
+
 	// Maintains the configuration for the server. This is the data that gets returned by the Panel
 	// such as build settings and container images.
 	cfg    Configuration
@@ -44,6 +52,9 @@ type Server struct {
 	resources   ResourceUsage
 	Environment environment.ProcessEnvironment `json:"-"`
 
+	// Tracks the activity of the server to detect when it is able to hibernate.
+	hibernation hibernation
+
 	fs *filesystem.Filesystem
 
 	// Events emitted by the server instance.
@@ -61,6 +72,9 @@ type Server struct {
 	installing   *system.AtomicBool
 	transferring *system.AtomicBool
 	restoring    *system.AtomicBool
+	// Tracks if the files of the server are being copied to a new server, which
+	// keeps the server from being started until the copy is complete.
+	cloning *system.AtomicBool
 
 	// The console throttler instance used to control outputs.
 	throttler    *ConsoleThrottle
@@ -84,6 +98,7 @@ func New(client remote.Client) (*Server, error) {
 		installing:   system.NewAtomicBool(false),
 		transferring: system.NewAtomicBool(false),
 		restoring:    system.NewAtomicBool(false),
+		cloning:      system.NewAtomicBool(false),
 		powerLock:    system.NewLocker(),
 		sinks: map[system.SinkName]*system.SinkPool{
 			system.LogSink:     system.NewSinkPool(),
@@ -260,6 +275,114 @@ func (s *Server) ProcessConfiguration() *remote.ProcessConfiguration {
 	return s.procConfig
 }
 
+// HealthCheck returns the health check for the server process, preferring the
+// check configured for the server itself over the one defined by its egg.
+func (s *Server) HealthCheck() *remote.HealthCheck {
+	if hc := s.Config().HealthCheck; hc != nil {
+		return hc
+	}
+	if pc := s.ProcessConfiguration(); pc != nil {
+		return pc.HealthCheck
+	}
+	return nil
+}
+
+// TmpVolume returns the volume mounted at /tmp for the server, using the values
+// from the configuration of the node that are not overridden by the server.
+func (s *Server) TmpVolume() config.TmpVolume {
+	tmp := config.Get().Cluster.Tmp
+	if o := s.Config().Tmp; o != nil {
+		if o.Medium != "" {
+			tmp.Medium = o.Medium
+		}
+		if o.Size > 0 {
+			tmp.Size = o.Size
+		}
+	}
+	return tmp
+}
+
+// Dns returns how the server resolves names, using the values from the
+// configuration of the node that are not overridden by the server.
+func (s *Server) Dns() config.DnsConfiguration {
+	n := config.Get().Cluster.Network
+	dns := config.DnsConfiguration{Policy: n.DnsPolicy, Nameservers: n.Dns, Searches: n.DnsSearches}
+	if o := s.Config().Dns; o != nil {
+		if o.Policy != "" {
+			dns.Policy = o.Policy
+		}
+		if len(o.Nameservers) > 0 {
+			dns.Nameservers = o.Nameservers
+		}
+		if len(o.Searches) > 0 {
+			dns.Searches = o.Searches
+		}
+	}
+	return dns
+}
+
+// IPFamilies returns the IP families of the service of the server, using the
+// values from the configuration of the node that are not overridden by the server.
+func (s *Server) IPFamilies() config.IPFamilyConfiguration {
+	n := config.Get().Cluster.Network
+	f := config.IPFamilyConfiguration{Policy: n.IPFamilyPolicy, Families: n.IPFamilies}
+	if o := s.Config().IPFamilies; o != nil {
+		if o.Policy != "" {
+			f.Policy = o.Policy
+		}
+		if len(o.Families) > 0 {
+			f.Families = o.Families
+		}
+	}
+	return f
+}
+
+// HostNetwork reports if the server runs in the network namespace of its node.
+func (s *Server) HostNetwork() bool {
+	return s.Config().HostNetwork && config.Get().Cluster.Network.HostNetwork
+}
+
+// StorageTier returns the storage tier the volume of the server is created
+// with, chosen through the labels or the egg of the server.
+func (s *Server) StorageTier() config.StorageTier {
+	cfg := s.Config()
+	return config.Get().Cluster.StorageTier(cfg.Egg.ID, cfg.Labels)
+}
+
+// PrivateNetwork returns how the server is reachable by the other servers in
+// the cluster. The network group is taken from the labels of the server, and is
+// only shared with the other servers of its owner.
+func (s *Server) PrivateNetwork() docker.PrivateNetwork {
+	cfg := s.Config()
+	return docker.PrivateNetwork{
+		Internal: cfg.Internal,
+		Group:    cfg.Labels[config.Get().Cluster.Network.GroupLabel],
+		Name:     cfg.Meta.Name,
+		Owner:    cfg.Meta.Owner,
+	}
+}
+
+// Sidecars returns the sidecar containers from the configuration of the node
+// that are enabled for the egg or labels of the server.
+func (s *Server) Sidecars() []config.Sidecar {
+	cfg := s.Config()
+
+	var out []config.Sidecar
+	for _, sc := range config.Get().Cluster.Sidecars {
+		if sc.EnabledFor(cfg.Egg.ID, cfg.Labels) {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+// ParsesConfigurationInPod reports if the configuration files of the server are
+// updated by an init container within the pod of the server, rather than being
+// read and written back through the filesystem by Kuber itself.
+func (s *Server) ParsesConfigurationInPod() bool {
+	return config.Get().Cluster.ConfigurationFiles.InitContainer && s.Filesystem().IsRemote()
+}
+
 // Filesystem returns an instance of the filesystem for this server.
 func (s *Server) Filesystem() *filesystem.Filesystem {
 	return s.fs
@@ -268,6 +391,10 @@ func (s *Server) Filesystem() *filesystem.Filesystem {
 // EnsureDataDirectoryExists ensures that the data directory for the server
 // instance exists.
 func (s *Server) EnsureDataDirectoryExists() error {
+	// The root of a remote filesystem is the volume itself, which always exists.
+	if s.fs.IsRemote() {
+		return nil
+	}
 	if _, err := os.Lstat(s.fs.Path()); err != nil {
 		if os.IsNotExist(err) {
 			s.Log().Debug("server: creating root directory and setting permissions")
@@ -297,6 +424,18 @@ func (s *Server) OnStateChange() {
 	if prevState != s.Environment.State() {
 		s.Log().WithField("status", st).Debug("saw server status change event")
 		s.Events().Publish(StatusEvent, st)
+
+		// Share the new state with the other replicas so that they are able to pick up
+		// the process and serve requests for it.
+		if ha.Enabled() {
+			go func(st string) {
+				ctx, cancel := context.WithTimeout(s.Context(), time.Second*5)
+				defer cancel()
+				if err := ha.WriteState(ctx, s.ID(), st); err != nil {
+					s.Log().WithField("error", err).Warn("failed to share server state with other replicas")
+				}
+			}(st)
+		}
 	}
 
 	// Reset the resource usage to 0 when the process fully stops so that all the UI
@@ -314,7 +453,10 @@ func (s *Server) OnStateChange() {
 	// automatically attempt to start the process back up for the user. This is done in a
 	// separate thread as to not block any actions currently taking place in the flow
 	// that called this function.
-	if (prevState == environment.ProcessStartingState || prevState == environment.ProcessRunningState) && s.Environment.State() == environment.ProcessOfflineState {
+	//
+	// When running with multiple replicas every replica sees the crash, only the leader
+	// handles it so that the process is not restarted more than once.
+	if (prevState == environment.ProcessStartingState || prevState == environment.ProcessRunningState) && s.Environment.State() == environment.ProcessOfflineState && ha.IsLeader() {
 		s.Log().Info("detected server as entering a crashed state; running crash handler")
 
 		go func(server *Server) {
@@ -347,15 +489,42 @@ type APIResponse struct {
 	IsSuspended   bool          `json:"is_suspended"`
 	Utilization   ResourceUsage `json:"utilization"`
 	Configuration Configuration `json:"configuration"`
+
+	// EnforcedLimits reports which of the limits in the build configuration of the server
+	// are applied by the environment.
+	EnforcedLimits *environment.EnforcedLimits `json:"enforced_limits,omitempty"`
+
+	// Addresses are the addresses the server is reachable at, by IP family.
+	Addresses *environment.Addresses `json:"addresses,omitempty"`
+
+	// Hostname is the hostname the DNS records of the server are published under.
+	Hostname string `json:"hostname,omitempty"`
+
+	// StorageTier is the storage tier the volume of the server was created with.
+	StorageTier string `json:"storage_tier,omitempty"`
 }
 
 // ToAPIResponse returns the server struct as an API object that can be consumed
 // by callers.
 func (s *Server) ToAPIResponse() APIResponse {
+	var enforced *environment.EnforcedLimits
+	var addresses *environment.Addresses
+	var hostname, tier string
+	if e, ok := s.Environment.(*docker.Environment); ok {
+		l := e.EnforcedLimits()
+		enforced = &l
+		addresses = e.Addresses()
+		hostname = e.Hostname()
+		tier = e.StorageTier()
+	}
 	return APIResponse{
-		State:         s.Environment.State(),
-		IsSuspended:   s.IsSuspended(),
-		Utilization:   s.Proc(),
-		Configuration: *s.Config(),
+		State:          s.Environment.State(),
+		IsSuspended:    s.IsSuspended(),
+		Utilization:    s.Proc(),
+		Configuration:  *s.Config(),
+		EnforcedLimits: enforced,
+		Addresses:      addresses,
+		Hostname:       hostname,
+		StorageTier:    tier,
 	}
 }
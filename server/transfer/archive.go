@@ -36,6 +36,7 @@ func NewArchive(t *Transfer, size uint64) *Archive {
 	return &Archive{
 		archive: &filesystem.Archive{
 			BasePath: t.Server.Filesystem().Path(),
+			Backend:  t.Server.Filesystem().Backend(),
 			Progress: progress.NewProgress(size),
 		},
 	}
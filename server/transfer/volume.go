@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"emperror.dev/errors"
+
+	k8s "github.com/kubectyl/kuber/environment/kubernetes"
+)
+
+// HandoffVolume attempts to hand the persistent volume of the server over to
+// the target node, which is only possible when both nodes manage the same
+// cluster and use the same storage class. If false is returned without an error
+// the volume could not be handed over and the archive should be pushed instead.
+func (t *Transfer) HandoffVolume(url, token string) (bool, error) {
+	env, ok := t.Server.Environment.(*k8s.Environment)
+	if !ok {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	h, err := env.VolumeHandoff(ctx)
+	if err != nil {
+		if !errors.Is(err, k8s.ErrVolumeNotTransferable) {
+			t.Log().WithError(err).Warn("failed to describe volume for handoff")
+		}
+		return false, nil
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(url, "/")+"/volume", bytes.NewReader(b))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	t.SendMessage("Attempting to hand over server volume to destination...")
+	t.SetStatus(StatusProcessing)
+
+	client := http.Client{Timeout: 0}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to hand over volume")
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		t.SendMessage("Handed over server volume to destination.")
+		return true, nil
+	// Destinations that do not share the cluster respond with a conflict, and those that
+	// predate volume handoffs do not know about the endpoint at all.
+	case http.StatusConflict, http.StatusNotFound, http.StatusMethodNotAllowed:
+		t.SendMessage("Destination cannot use the server volume, falling back to streaming the server data.")
+		return false, nil
+	default:
+		v, _ := io.ReadAll(res.Body)
+		return false, errors.Errorf("unexpected status code from destination: %d: %s", res.StatusCode, v)
+	}
+}
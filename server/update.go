@@ -36,6 +36,17 @@ func (s *Server) SyncWithEnvironment() {
 		s.Log().Debug("syncing stop configuration with configured docker environment")
 		e.SetImage(cfg.Container.Image)
 		e.SetStopConfiguration(s.ProcessConfiguration().Stop)
+		e.SetHealthCheck(s.HealthCheck())
+		e.SetSidecars(s.Sidecars())
+		e.SetTmpVolume(s.TmpVolume())
+		e.SetNetwork(s.Dns(), s.HostNetwork())
+		e.SetIPFamilies(s.IPFamilies())
+		e.SetPrivateNetwork(s.PrivateNetwork())
+		if s.ParsesConfigurationInPod() {
+			e.SetConfigurationFiles(s.ProcessConfiguration().ConfigurationFiles)
+		} else {
+			e.SetConfigurationFiles(nil)
+		}
 	}
 
 	// If build limits are changed, environment variables also change. Plus, any modifications to
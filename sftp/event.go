@@ -0,0 +1,70 @@
+package sftp
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/kubectyl/kuber/internal/database"
+	"github.com/kubectyl/kuber/internal/ha"
+	"github.com/kubectyl/kuber/internal/models"
+)
+
+type eventHandler struct {
+	ip     string
+	user   string
+	server string
+}
+
+type FileAction struct {
+	// Entity is the targeted file or directory (depending on the event) that the action
+	// is being performed _against_, such as "/foo/test.txt". This will always be the full
+	// path to the element.
+	Entity string
+	// Target is an optional (often blank) field that only has a value in it when the event
+	// is specifically modifying the entity, such as a rename or move event. In that case
+	// the Target field will be updated to be the expected final path of the entity.
+	Target string
+}
+
+// Log parses a SFTP specific file activity event and then passes it off to be stored
+// in the normal activity database.
+func (eh *eventHandler) Log(e models.Event, fa FileAction) error {
+	metadata := map[string]interface{}{
+		"files": []string{fa.Entity},
+	}
+	if fa.Target != "" {
+		metadata["files"] = []map[string]string{
+			{"from": fa.Entity, "to": fa.Target},
+		}
+	}
+
+	r := models.Activity{
+		Server:   eh.server,
+		Event:    e,
+		Metadata: metadata,
+		IP:       eh.ip,
+	}
+
+	// In high availability mode events are stored in the cluster, so that they are not lost
+	// along with this replica.
+	if ha.Enabled() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		return ha.PushActivity(ctx, r.SetUser(eh.user))
+	}
+	if tx := database.Instance().Create(r.SetUser(eh.user)); tx.Error != nil {
+		return errors.WithStack(tx.Error)
+	}
+	return nil
+}
+
+// MustLog is a wrapper around Log that writes any error encountered while storing the
+// event to the application log rather than returning it.
+func (eh *eventHandler) MustLog(e models.Event, fa FileAction) {
+	if err := eh.Log(e, fa); err != nil {
+		log.WithField("error", errors.Unwrap(err)).WithField("event", e).Error("sftp: failed to store file event")
+	}
+}
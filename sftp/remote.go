@@ -0,0 +1,39 @@
+package sftp
+
+import (
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+
+	"github.com/kubectyl/kuber/server/filesystem"
+)
+
+// remoteFile buffers an upload in a temporary file on the local disk and writes it
+// to the server filesystem once the client closes the file. Files on a remote
+// filesystem cannot be written at random offsets, which SFTP clients rely on.
+type remoteFile struct {
+	*os.File
+	fs   *filesystem.Filesystem
+	path string
+}
+
+func newRemoteFile(fs *filesystem.Filesystem, p string) (*remoteFile, error) {
+	f, err := os.CreateTemp("", "kuber-sftp-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// The file remains usable through the open handle, and is cleaned up automatically
+	// once it has been closed.
+	_ = os.Remove(f.Name())
+	return &remoteFile{File: f, fs: fs, path: p}, nil
+}
+
+// Close uploads the buffered contents of the file to the server filesystem.
+func (f *remoteFile) Close() error {
+	defer f.File.Close()
+	if _, err := f.File.Seek(0, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+	return f.fs.Writefile(f.path, f.File)
+}